@@ -1,6 +1,7 @@
 module github.com/layer5io/meshery-istio
 
-go 1.23
+go 1.23.0
+
 replace (
 	//github.com/docker/docker => github.com/moby/moby v17.12.0-ce-rc1.0.20200618181300-9dc6525e6118+incompatible
 	github.com/kudobuilder/kuttl => github.com/layer5io/kuttl v0.4.1-0.20200723152044-916f10574334
@@ -126,8 +127,8 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gorm.io/gorm v1.25.5 // indirect
 	helm.sh/helm/v3 v3.14.1 // indirect
-	istio.io/api v0.0.0-20230204131218-41d7951eb9e4 // indirect
-	k8s.io/api v0.29.0 // indirect
+	istio.io/api v0.0.0-20230204131218-41d7951eb9e4
+	k8s.io/api v0.29.0
 	k8s.io/apiextensions-apiserver v0.29.0 // indirect
 	k8s.io/apiserver v0.29.0 // indirect
 	k8s.io/component-base v0.29.0 // indirect
@@ -139,7 +140,7 @@ require (
 	sigs.k8s.io/kustomize/api v0.13.5-0.20230601165947-6ce0bf390ce3 // indirect
 	sigs.k8s.io/kustomize/kyaml v0.14.3-0.20230601165947-6ce0bf390ce3 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.4.1 // indirect
-	sigs.k8s.io/yaml v1.4.0 // indirect
+	sigs.k8s.io/yaml v1.4.0
 )
 
 require (
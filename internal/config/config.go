@@ -17,29 +17,58 @@ const (
 	// Constants to use in log statements
 	LabelNamespace = "label-namespace"
 
-	ServicePatchFile = "service-patch-file"
-	CPPatchFile      = "cp-patch-file"
-	ControlPatchFile = "control-patch-file"
-	FilterPatchFile  = "filter-patch-file"
+	// Route of the sample apps through the ingress gateway
+	SampleAppHost    = "sample-app-host"
+	SampleAppPath    = "sample-app-path"
+	SampleAppGateway = "sample-app-gateway"
+
+	// Sample applications bundled with the adapter
+	OnlineBoutiqueOperation = "online-boutique"
+	HelloWorldOperation     = "helloworld"
+	SleepOperation          = "sleep"
+	FortioOperation         = "fortio"
+
+	// Envoy admin API of the proxies
+	EnvoyAdminOperation = "envoy-admin-operation"
 
 	// Istio vet operation
 	IstioVetOperation = "istio-vet"
 
-	// Configure Envoy filter operation
-	EnvoyFilterOperation = "envoy-filter-operation"
+	// Configure WasmPlugin operation
+	WasmPluginOperation = "wasm-plugin-operation"
 
 	// Addons that the adapter supports
-	PrometheusAddon = "prometheus-addon"
-	GrafanaAddon    = "grafana-addon"
-	KialiAddon      = "kiali-addon"
-	JaegerAddon     = "jaeger-addon"
-	ZipkinAddon     = "zipkin-addon"
+	PrometheusAddon    = "prometheus-addon"
+	GrafanaAddon       = "grafana-addon"
+	KialiAddon         = "kiali-addon"
+	JaegerAddon        = "jaeger-addon"
+	ZipkinAddon        = "zipkin-addon"
+	OpenTelemetryAddon = "opentelemetry-collector-addon"
+
+	// Wire the mesh to existing observability backends
+	ExternalObservabilityOperation = "external-observability-operation"
+	TelemetryTracingOperation      = "telemetry-tracing-operation"
+	AccessLoggingOperation         = "access-logging-operation"
+
+	// Traffic management
+	TrafficShiftOperation      = "traffic-shift-operation"
+	FaultInjectionOperation    = "fault-injection-operation"
+	CircuitBreakerOperation    = "circuit-breaker-operation"
+	LocalRateLimitOperation    = "local-rate-limit-operation"
+	GlobalRateLimitOperation   = "global-rate-limit-operation"
+	EgressLockdownOperation    = "egress-lockdown-operation"
+	ServiceEntryOperation      = "service-entry-operation"
+	SidecarGenerationOperation = "sidecar-generation-operation"
 
 	// Policies
-	DenyAllPolicyOperation     = "deny-all-policy-operation"
-	StrictMTLSPolicyOperation  = "strict-mtls-policy-operation"
-	MutualMTLSPolicyOperation  = "mutual-mtls-policy-operation"
-	DisableMTLSPolicyOperation = "disable-mtls-policy-operation"
+	DenyAllPolicyOperation         = "deny-all-policy-operation"
+	StrictMTLSPolicyOperation      = "strict-mtls-policy-operation"
+	MutualMTLSPolicyOperation      = "mutual-mtls-policy-operation"
+	DisableMTLSPolicyOperation     = "disable-mtls-policy-operation"
+	MTLSMigrationOperation         = "mtls-migration-operation"
+	AuthorizationPolicyOperation   = "authorization-policy-operation"
+	RequestAuthenticationOperation = "request-authentication-operation"
+	ExternalAuthorizationOperation = "external-authorization-operation"
 
 	// OAM Metadata constants
 	OAMAdapterNameMetadataKey       = "adapter.meshery.io/name"
@@ -19,11 +19,76 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 	for _, v := range versions {
 		adapterVersions = append(adapterVersions, adapter.Version(v))
 	}
-	// Add Istio networking resources to sample applications
-	dev[common.BookInfoOperation].Templates = append(dev[common.BookInfoOperation].Templates, "file://templates/bookinfo/gateway.yaml")
-	dev[common.HTTPBinOperation].Templates = append(dev[common.HTTPBinOperation].Templates, "file://templates/httpbin/gateway.yaml")
-	dev[common.ImageHubOperation].Templates = append(dev[common.ImageHubOperation].Templates, "file://templates/imagehub/gateway.yaml")
-	dev[common.EmojiVotoOperation].Templates = append(dev[common.EmojiVotoOperation].Templates, "file://templates/emojivoto/gateway.yaml")
+	// Expose the sample applications through the ingress gateway
+	dev[common.BookInfoOperation].AdditionalProperties[SampleAppGateway] = "file://templates/bookinfo/virtualservice.yaml"
+	dev[common.HTTPBinOperation].AdditionalProperties[SampleAppGateway] = "file://templates/httpbin/virtualservice.yaml"
+	dev[common.ImageHubOperation].AdditionalProperties[SampleAppGateway] = "file://templates/imagehub/virtualservice.yaml"
+	dev[common.EmojiVotoOperation].AdditionalProperties[SampleAppGateway] = "file://templates/emojivoto/virtualservice.yaml"
+	dev[common.BookInfoOperation].AdditionalProperties[SampleAppHost] = "bookinfo.meshery.io"
+	dev[common.BookInfoOperation].AdditionalProperties[SampleAppPath] = "/productpage"
+	dev[common.HTTPBinOperation].AdditionalProperties[SampleAppHost] = "httpbin.meshery.io"
+	dev[common.HTTPBinOperation].AdditionalProperties[SampleAppPath] = "/status/200"
+	dev[common.ImageHubOperation].AdditionalProperties[SampleAppHost] = "imagehub.meshery.io"
+	dev[common.ImageHubOperation].AdditionalProperties[SampleAppPath] = "/"
+	dev[common.EmojiVotoOperation].AdditionalProperties[SampleAppHost] = "emojivoto.meshery.io"
+	dev[common.EmojiVotoOperation].AdditionalProperties[SampleAppPath] = "/"
+
+	dev[OnlineBoutiqueOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_SAMPLE_APPLICATION),
+		Description: "Online Boutique Application",
+		Versions:    adapter.NoneVersion,
+		Templates: []adapter.Template{
+			"file://templates/onlineboutique/onlineboutique.yaml",
+		},
+		AdditionalProperties: map[string]string{
+			ServiceName:      OnlineBoutiqueOperation,
+			SampleAppHost:    "onlineboutique.meshery.io",
+			SampleAppPath:    "/",
+			SampleAppGateway: "file://templates/onlineboutique/virtualservice.yaml",
+		},
+	}
+
+	dev[HelloWorldOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_SAMPLE_APPLICATION),
+		Description: "Istio Hello World Application",
+		Versions:    adapter.NoneVersion,
+		Templates: []adapter.Template{
+			"file://templates/helloworld/helloworld.yaml",
+		},
+		AdditionalProperties: map[string]string{
+			ServiceName:      HelloWorldOperation,
+			SampleAppHost:    "helloworld.meshery.io",
+			SampleAppPath:    "/hello",
+			SampleAppGateway: "file://templates/helloworld/virtualservice.yaml",
+		},
+	}
+
+	dev[SleepOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_SAMPLE_APPLICATION),
+		Description: "Sleep Client (curl)",
+		Versions:    adapter.NoneVersion,
+		Templates: []adapter.Template{
+			"file://templates/sleep/sleep.yaml",
+		},
+		AdditionalProperties: map[string]string{
+			ServiceName: SleepOperation,
+		},
+	}
+
+	dev[FortioOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_SAMPLE_APPLICATION),
+		Description: "Fortio Load Client",
+		Versions:    adapter.NoneVersion,
+		Templates: []adapter.Template{
+			"file://templates/fortio/fortio.yaml",
+		},
+		AdditionalProperties: map[string]string{
+			ServiceName:      FortioOperation,
+			SampleAppHost:    "fortio.meshery.io",
+			SampleAppPath:    "/fortio/",
+			SampleAppGateway: "file://templates/fortio/virtualservice.yaml",
+		},
+	}
 
 	dev[IstioOperation] = &adapter.Operation{
 		Type:                 int32(meshes.OpCategory_INSTALL),
@@ -44,8 +109,7 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/addons/prometheus.yaml", version)),
 		},
 		AdditionalProperties: map[string]string{
-			ServiceName:      "prometheus",
-			ServicePatchFile: "file://templates/patches/service-loadbalancer.json",
+			ServiceName: "prometheus",
 		},
 	}
 
@@ -56,8 +120,7 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/addons/grafana.yaml", version)),
 		},
 		AdditionalProperties: map[string]string{
-			ServiceName:      "grafana",
-			ServicePatchFile: "file://templates/patches/service-loadbalancer.json",
+			ServiceName: "grafana",
 		},
 	}
 
@@ -68,8 +131,7 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/addons/kiali.yaml", version)),
 		},
 		AdditionalProperties: map[string]string{
-			ServiceName:      "kiali",
-			ServicePatchFile: "file://templates/patches/service-loadbalancer.json",
+			ServiceName: "kiali",
 		},
 	}
 
@@ -80,8 +142,7 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/addons/jaeger.yaml", version)),
 		},
 		AdditionalProperties: map[string]string{
-			ServiceName:      "jaeger-collector",
-			ServicePatchFile: "file://templates/patches/service-loadbalancer.json",
+			ServiceName: "jaeger-collector",
 		},
 	}
 
@@ -92,27 +153,109 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/addons/extras/zipkin.yaml", version)),
 		},
 		AdditionalProperties: map[string]string{
-			ServiceName:      "zipkin",
-			ServicePatchFile: "file://templates/patches/service-loadbalancer.json",
+			ServiceName: "zipkin",
+		},
+	}
+
+	dev[OpenTelemetryAddon] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Add-on: OpenTelemetry Collector",
+		Templates: []adapter.Template{
+			adapter.Template(fmt.Sprintf("https://raw.githubusercontent.com/istio/istio/%s/samples/open-telemetry/otel.yaml", version)),
+		},
+		AdditionalProperties: map[string]string{
+			ServiceName: "opentelemetry-collector",
 		},
 	}
 
+	dev[ExternalObservabilityOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Observability: Bring Your Own Backends",
+	}
+
+	dev[TelemetryTracingOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Telemetry: Distributed Tracing",
+	}
+
+	dev[AccessLoggingOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Telemetry: Access Logging",
+	}
+
+	dev[TrafficShiftOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Traffic Management: Traffic Shifting",
+	}
+
+	dev[FaultInjectionOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Traffic Management: Fault Injection",
+	}
+
+	dev[CircuitBreakerOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Traffic Management: Circuit Breaking",
+	}
+
+	dev[LocalRateLimitOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Traffic Management: Local Rate Limiting",
+	}
+
+	dev[GlobalRateLimitOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Traffic Management: Global Rate Limiting",
+	}
+
+	dev[EnvoyAdminOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Retrieve Envoy Configuration",
+	}
+
+	dev[AuthorizationPolicyOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Policy: Authorization",
+	}
+
+	dev[MTLSMigrationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Policy: Migrate to Strict MTLS",
+	}
+
+	dev[RequestAuthenticationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Policy: Request Authentication (JWT)",
+	}
+
+	dev[ExternalAuthorizationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Policy: External Authorization (OPA)",
+	}
+
+	dev[EgressLockdownOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Egress: Registry Only",
+	}
+
+	dev[ServiceEntryOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Egress: Service Entries",
+	}
+
+	dev[SidecarGenerationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Sidecar: Generate Scoped Configuration",
+	}
+
 	dev[IstioVetOperation] = &adapter.Operation{
 		Type:        int32(meshes.OpCategory_VALIDATE),
 		Description: "Analyze Running Configuration",
 	}
 
-	dev[EnvoyFilterOperation] = &adapter.Operation{
+	dev[WasmPluginOperation] = &adapter.Operation{
 		Type:        int32(meshes.OpCategory_CONFIGURE),
-		Description: "Envoy Filter for Image Hub",
-		Versions:    adapter.NoneVersion,
-		Templates: []adapter.Template{
-			"file://templates/imagehub/rate_limit_filter.yaml",
-		},
-		AdditionalProperties: map[string]string{
-			ServiceName:     "api-v1",
-			FilterPatchFile: "file://templates/imagehub/filter_patch.json",
-		},
+		Description: "Wasm Plugin",
 	}
 
 	dev[DenyAllPolicyOperation] = &adapter.Operation{
@@ -126,25 +269,16 @@ func GetOperations(dev adapter.Operations, version string) adapter.Operations {
 	dev[StrictMTLSPolicyOperation] = &adapter.Operation{
 		Type:        int32(meshes.OpCategory_CONFIGURE),
 		Description: "Policy: Strict MTLS",
-		Templates: []adapter.Template{
-			"file://templates/policies/strict.yaml",
-		},
 	}
 
 	dev[MutualMTLSPolicyOperation] = &adapter.Operation{
 		Type:        int32(meshes.OpCategory_CONFIGURE),
 		Description: "Policy: Mutual MTLS",
-		Templates: []adapter.Template{
-			"file://templates/policies/mutual.yaml",
-		},
 	}
 
 	dev[DisableMTLSPolicyOperation] = &adapter.Operation{
 		Type:        int32(meshes.OpCategory_CONFIGURE),
 		Description: "Policy: Disable MTLS",
-		Templates: []adapter.Template{
-			"file://templates/policies/disable.yaml",
-		},
 	}
 
 	return dev
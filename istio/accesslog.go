@@ -0,0 +1,271 @@
+package istio
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+)
+
+// Access log formats
+const (
+	AccessLogFormatText = "text"
+	AccessLogFormatJSON = "json"
+
+	accessLoggingTelemetryName = "meshery-access-logging"
+	// builtin provider of istio writing text access logs to the proxy stdout
+	envoyAccessLogProvider = "envoy"
+)
+
+// accessLogJSONLabels are the fields of the JSON access logs, matching the
+// default text format of envoy
+var accessLogJSONLabels = map[string]string{
+	"start_time":                "%START_TIME%",
+	"method":                    "%REQ(:METHOD)%",
+	"path":                      "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+	"protocol":                  "%PROTOCOL%",
+	"response_code":             "%RESPONSE_CODE%",
+	"response_flags":            "%RESPONSE_FLAGS%",
+	"bytes_received":            "%BYTES_RECEIVED%",
+	"bytes_sent":                "%BYTES_SENT%",
+	"duration":                  "%DURATION%",
+	"upstream_host":             "%UPSTREAM_HOST%",
+	"upstream_cluster":          "%UPSTREAM_CLUSTER%",
+	"downstream_remote_address": "%DOWNSTREAM_REMOTE_ADDRESS%",
+	"authority":                 "%REQ(:AUTHORITY)%",
+	"request_id":                "%REQ(X-REQUEST-ID)%",
+	"user_agent":                "%REQ(USER-AGENT)%",
+}
+
+// accessLogging describes the access logging configuration of the mesh, a
+// namespace or the workloads matching a selector
+type accessLogging struct {
+	// Name of the Telemetry resource, allowing several workload scoped
+	// configurations in a namespace
+	Name string `yaml:"name,omitempty"`
+	// Namespace to configure, the whole mesh is configured when empty
+	Namespace string `yaml:"namespace,omitempty"`
+	// Labels of the workloads to configure in the namespace
+	Selector map[string]string `yaml:"selector,omitempty"`
+	// Turns access logging off for the scope
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Format of the log entries: text or json
+	Format string `yaml:"format,omitempty"`
+	// CEL expression selecting the requests to log, e.g. response.code >= 400
+	Filter string `yaml:"filter,omitempty"`
+	// Sends the logs to an OpenTelemetry collector instead of the proxy stdout
+	OpenTelemetry *struct {
+		Service string `yaml:"service,omitempty"`
+		Port    int    `yaml:"port,omitempty"`
+	} `yaml:"openTelemetry,omitempty"`
+}
+
+func defaultAccessLogging() accessLogging {
+	return accessLogging{
+		Name:   accessLoggingTelemetryName,
+		Format: AccessLogFormatText,
+	}
+}
+
+func (l accessLogging) validate() error {
+	if l.Name == "" {
+		return ErrTelemetry(fmt.Errorf("access logging name is required"))
+	}
+	switch l.Format {
+	case AccessLogFormatText, AccessLogFormatJSON:
+	default:
+		return ErrTelemetry(fmt.Errorf("unsupported access log format: %s", l.Format))
+	}
+	if len(l.Selector) > 0 && l.Namespace == "" {
+		return ErrTelemetry(fmt.Errorf("a namespace is required along with a workload selector"))
+	}
+	if l.OpenTelemetry != nil {
+		if l.OpenTelemetry.Service == "" {
+			return ErrTelemetry(fmt.Errorf("OpenTelemetry collector service is required"))
+		}
+		if l.OpenTelemetry.Port <= 0 || l.OpenTelemetry.Port > 65535 {
+			return ErrTelemetry(fmt.Errorf("invalid OpenTelemetry collector port: %d", l.OpenTelemetry.Port))
+		}
+	}
+	return nil
+}
+
+// providerName returns the name of the extension provider used by the
+// Telemetry resource in the namespace. Text logs to stdout go through the
+// builtin provider, any other sink gets a provider of its own so that it
+// can be removed along with the resource.
+func (l accessLogging) providerName(namespace string) string {
+	if l.OpenTelemetry == nil && l.Format == AccessLogFormatText {
+		return envoyAccessLogProvider
+	}
+	return fmt.Sprintf("%s-%s", namespace, l.Name)
+}
+
+// extensionProvider returns the extension provider writing the logs in the
+// requested format to the requested sink, or nil if the builtin one is used
+func (l accessLogging) extensionProvider(namespace string) map[string]interface{} {
+	name := l.providerName(namespace)
+	if name == envoyAccessLogProvider {
+		return nil
+	}
+
+	logFormat := map[string]interface{}{}
+	if l.Format == AccessLogFormatJSON {
+		labels := map[string]interface{}{}
+		for k, v := range accessLogJSONLabels {
+			labels[k] = v
+		}
+		logFormat["labels"] = labels
+	}
+
+	if l.OpenTelemetry != nil {
+		otel := map[string]interface{}{
+			"service": l.OpenTelemetry.Service,
+			"port":    l.OpenTelemetry.Port,
+		}
+		if len(logFormat) > 0 {
+			otel["logFormat"] = logFormat
+		}
+		return map[string]interface{}{"name": name, "envoyOtelAls": otel}
+	}
+	return map[string]interface{}{
+		"name": name,
+		"envoyFileAccessLog": map[string]interface{}{
+			"path":      "/dev/stdout",
+			"logFormat": logFormat,
+		},
+	}
+}
+
+// manifest renders the Telemetry resource configuring access logging in
+// the namespace
+func (l accessLogging) manifest(namespace string) (string, error) {
+	logging := map[string]interface{}{
+		"providers": []interface{}{
+			map[string]interface{}{"name": l.providerName(namespace)},
+		},
+	}
+	if l.Disabled {
+		logging["disabled"] = true
+	}
+	if l.Filter != "" {
+		logging["filter"] = map[string]interface{}{"expression": l.Filter}
+	}
+
+	spec := map[string]interface{}{
+		"accessLogging": []interface{}{logging},
+	}
+	if len(l.Selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": l.Selector}
+	}
+
+	telemetry := map[string]interface{}{
+		"apiVersion": telemetryAPIVersion,
+		"kind":       "Telemetry",
+		"metadata": map[string]interface{}{
+			"name":      l.Name,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+	byt, err := yaml.Marshal(telemetry)
+	if err != nil {
+		return "", ErrTelemetry(err)
+	}
+	return string(byt), nil
+}
+
+// configureAccessLogging enables, disables or filters the access logs of
+// the proxies through the Telemetry API
+func (istio *Istio) configureAccessLogging(del bool, logging accessLogging, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := logging.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureAccessLoggingOnSingleCluster(del, logging, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrTelemetry(mergeErrors(errs))
+}
+
+func (istio *Istio) configureAccessLoggingOnSingleCluster(del bool, logging accessLogging, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+
+	namespace := logging.Namespace
+	if namespace == "" {
+		mesh, err := getMeshConfig(mclient)
+		if err != nil {
+			return msgs, err
+		}
+		namespace = mesh.rootNamespace()
+	}
+	provider := logging.extensionProvider(namespace)
+
+	if !del && provider != nil {
+		err := updateMeshConfig(mclient, func(mesh meshConfig) error {
+			mesh.setExtensionProvider(provider)
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("access log provider %s registered in the mesh config", provider["name"]))
+	}
+
+	manifest, err := logging.manifest(namespace)
+	if err != nil {
+		return msgs, err
+	}
+	if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, namespace, mclient); err != nil {
+		return msgs, ErrTelemetry(err)
+	}
+	msgs = append(msgs, fmt.Sprintf("access logging Telemetry %s/%s %s", namespace, logging.Name, pastTense(del)))
+
+	if del && provider != nil {
+		err := updateMeshConfig(mclient, func(mesh meshConfig) error {
+			mesh.removeExtensionProvider(logging.providerName(namespace))
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("access log provider %s removed from the mesh config", provider["name"]))
+	}
+	return msgs, nil
+}
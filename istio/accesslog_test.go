@@ -0,0 +1,109 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestAccessLogging_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:    "defaults are valid",
+			params:  "",
+			wantErr: false,
+		},
+		{
+			name:    "unsupported format",
+			params:  "format: xml",
+			wantErr: true,
+		},
+		{
+			name:    "selector without namespace",
+			params:  "selector: {app: reviews}",
+			wantErr: true,
+		},
+		{
+			name:    "OpenTelemetry sink without port",
+			params:  "openTelemetry: {service: opentelemetry-collector.istio-system.svc.cluster.local}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := defaultAccessLogging()
+			if err := parseOperationParams(tt.params, &logging); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := logging.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("accessLogging.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessLogging_manifest(t *testing.T) {
+	tests := []struct {
+		name         string
+		params       string
+		wantSpec     map[string]interface{}
+		wantProvider bool
+	}{
+		{
+			name:   "text logs use the builtin provider",
+			params: "",
+			wantSpec: map[string]interface{}{
+				"accessLogging": []interface{}{
+					map[string]interface{}{"providers": []interface{}{map[string]interface{}{"name": "envoy"}}},
+				},
+			},
+			wantProvider: false,
+		},
+		{
+			name: "filtered JSON logs of a workload",
+			params: `
+namespace: bookinfo
+selector: {app: reviews}
+format: json
+filter: response.code >= 400
+`,
+			wantSpec: map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "reviews"}},
+				"accessLogging": []interface{}{
+					map[string]interface{}{
+						"providers": []interface{}{map[string]interface{}{"name": "bookinfo-meshery-access-logging"}},
+						"filter":    map[string]interface{}{"expression": "response.code >= 400"},
+					},
+				},
+			},
+			wantProvider: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := defaultAccessLogging()
+			if err := parseOperationParams(tt.params, &logging); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			manifest, err := logging.manifest("bookinfo")
+			if err != nil {
+				t.Fatalf("accessLogging.manifest() error = %v", err)
+			}
+			got := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(manifest), &got); err != nil {
+				t.Fatalf("failed to decode manifest: %v", err)
+			}
+			if !reflect.DeepEqual(got["spec"], tt.wantSpec) {
+				t.Errorf("accessLogging.manifest() spec = %v, want %v", got["spec"], tt.wantSpec)
+			}
+			if provider := logging.extensionProvider("bookinfo"); (provider != nil) != tt.wantProvider {
+				t.Errorf("accessLogging.extensionProvider() = %v, wantProvider %v", provider, tt.wantProvider)
+			}
+		})
+	}
+}
@@ -3,93 +3,340 @@ package istio
 import (
 	"context"
 	"fmt"
-	"net/url"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
 	"github.com/layer5io/meshkit/utils"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
+// Exposure modes supported for the addon dashboards
+const (
+	ExposureClusterIP      = "ClusterIP"
+	ExposureNodePort       = "NodePort"
+	ExposureLoadBalancer   = "LoadBalancer"
+	ExposureIngressGateway = "IngressGateway"
+
+	loadBalancerPatchFile  = "file://templates/patches/service-loadbalancer.json"
+	addonRouteTemplateFile = "file://templates/addons/virtualservice.yaml"
+
+	loadBalancerTimeout = 60 // time in seconds to wait for a load balancer address
+
+	// range of the node ports allocated by the API server by default
+	minNodePort = 30000
+	maxNodePort = 32767
+)
+
+// addonGatewaySelector selects the ingress gateway serving the addons
+// exposed with the IngressGateway mode
+var addonGatewaySelector = map[string]string{"istio": "ingressgateway"}
+
+// addonExposure describes how an addon is made reachable from outside
+// the cluster
+type addonExposure struct {
+	Mode     string `yaml:"exposure,omitempty"`
+	NodePort int32  `yaml:"nodePort,omitempty"`
+	Host     string `yaml:"host,omitempty"`
+}
+
+// defaultAddonExposure keeps the behaviour of the adapter before exposure
+// became configurable
+func defaultAddonExposure() addonExposure {
+	return addonExposure{Mode: ExposureLoadBalancer}
+}
+
+func (e addonExposure) validate() error {
+	switch e.Mode {
+	case ExposureClusterIP, ExposureLoadBalancer, ExposureIngressGateway:
+	case ExposureNodePort:
+		// zero lets the API server allocate the node port
+		if e.NodePort != 0 && (e.NodePort < minNodePort || e.NodePort > maxNodePort) {
+			return ErrAddonExposure(fmt.Errorf("invalid node port %d, use a port in %d-%d", e.NodePort, minNodePort, maxNodePort))
+		}
+	default:
+		return ErrAddonExposure(fmt.Errorf("invalid exposure mode: %s", e.Mode))
+	}
+	return nil
+}
+
+// addonEndpoint holds the addresses at which an addon can be reached
+type addonEndpoint struct {
+	Name     string
+	Internal string
+	External string
+	// Warning explains why the external address is not known yet
+	Warning string
+}
+
+func (e addonEndpoint) String() string {
+	msg := fmt.Sprintf("%s: in-cluster %s", e.Name, e.Internal)
+	switch {
+	case e.External != "":
+		msg = fmt.Sprintf("%s, external %s", msg, e.External)
+	case e.Warning != "":
+		msg = fmt.Sprintf("%s, external address pending", msg)
+	}
+	if e.Warning != "" {
+		msg = fmt.Sprintf("%s\nwarning: %s", msg, e.Warning)
+	}
+	return msg
+}
+
 // installAddon installs/uninstalls an addon in the given namespace
 //
 // the template defines the manifest's link/location which needs to be used to
-// install the addon
-func (istio *Istio) installAddon(namespace string, del bool, service string, patches []string, templates []adapter.Template, kubeconfigs []string) (string, error) {
+// install the addon. Once the Deployments of the addon are available, its
+// service is exposed as requested and the endpoints of the addon are returned.
+func (istio *Istio) installAddon(namespace string, del bool, service string, exposure addonExposure, templates []adapter.Template, kubeconfigs []string) (string, []addonEndpoint, error) {
 	st := status.Installing
 
 	if del {
 		st = status.Removing
 	}
 
+	if err := exposure.validate(); err != nil {
+		return st, nil, err
+	}
+
 	istio.Log.Debug(fmt.Sprintf("Overidden namespace: %s", namespace))
 	namespace = "istio-system"
+
+	manifests := make([]string, 0, len(templates))
+	for _, template := range templates {
+		manifests = append(manifests, template.String())
+	}
+
 	var wg sync.WaitGroup
-	var errMx sync.Mutex
+	var mx sync.Mutex
 	var errs []error
+	var endpoints []addonEndpoint
 	for _, k8sconfig := range kubeconfigs {
 		wg.Add(1)
 		go func(k8sconfig string) {
 			defer wg.Done()
 			mclient, err := mesherykube.New([]byte(k8sconfig))
 			if err != nil {
-				errMx.Lock()
+				mx.Lock()
 				errs = append(errs, err)
-				errMx.Unlock()
+				mx.Unlock()
 				return
 			}
-			for _, template := range templates {
-				err := istio.applyManifestOnSingleCluster([]byte(template.String()), del, namespace, mclient)
-				// Specifically choosing to ignore kiali dashboard's error.
-				// Referring to: https://github.com/kiali/kiali/issues/3112
-				if err != nil && !strings.Contains(err.Error(), "no matches for kind \"MonitoringDashboard\" in version \"monitoring.kiali.io/v1alpha1\"") {
-					if !strings.Contains(err.Error(), "clusterIP") {
-						errMx.Lock()
-						errs = append(errs, err)
-						errMx.Unlock()
-					}
-				}
-			}
 
-			for _, patch := range patches {
-				if patch == "" {
-					continue //avoid throwing error when a given patch key didn't exist for a specific addon type in operations
-				}
-				if !del {
-					_, err := url.ParseRequestURI(patch)
-					if err != nil {
-						errMx.Lock()
-						errs = append(errs, err)
-						errMx.Unlock()
-						return
-					}
-
-					content, err := utils.ReadFileSource(patch)
-					if err != nil {
-						errMx.Lock()
-						errs = append(errs, err)
-						errMx.Unlock()
-						return
-					}
-
-					_, err = mclient.KubeClient.CoreV1().Services(namespace).Patch(context.TODO(), service, types.MergePatchType, []byte(content), metav1.PatchOptions{})
-					if err != nil {
-						errMx.Lock()
-						errs = append(errs, err)
-						errMx.Unlock()
-						return
-					}
-				}
+			endpoint, err := istio.installAddonOnSingleCluster(namespace, del, service, exposure, manifests, mclient)
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			if endpoint != nil {
+				mx.Lock()
+				endpoints = append(endpoints, *endpoint)
+				mx.Unlock()
 			}
 		}(k8sconfig)
 	}
 	wg.Wait()
 	if len(errs) == 0 {
-		return status.Installed, nil
+		return status.Installed, endpoints, nil
+	}
+	return st, endpoints, ErrAddonFromTemplate(mergeErrors(errs))
+}
+
+func (istio *Istio) installAddonOnSingleCluster(namespace string, del bool, service string, exposure addonExposure, manifests []string, mclient *mesherykube.Client) (*addonEndpoint, error) {
+	var resources []manifestResource
+	for _, manifest := range manifests {
+		resources = append(resources, parseManifestResources(manifest)...)
+	}
+
+	if !del {
+		missing, err := missingKinds(mclient, resources)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			return nil, ErrMissingCRD(missing)
+		}
+	}
+
+	for _, manifest := range manifests {
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, namespace, mclient); err != nil {
+			return nil, err
+		}
+	}
+
+	if !del {
+		if err := waitForDeployments(mclient, namespace, deploymentNames(resources)); err != nil {
+			return nil, err
+		}
+	}
+
+	return istio.exposeAddon(namespace, del, service, exposure, mclient)
+}
+
+// exposeAddon makes the service of an addon reachable according to the
+// exposure mode and returns the resolved endpoint
+func (istio *Istio) exposeAddon(namespace string, del bool, service string, exposure addonExposure, mclient *mesherykube.Client) (*addonEndpoint, error) {
+	if exposure.Mode == ExposureIngressGateway {
+		host := exposure.Host
+		if host == "" {
+			host = fmt.Sprintf("%s.meshery.io", service)
+		}
+		// The gateway resources need to be removed even if the addon is already gone
+		port := int32(80)
+		if !del {
+			svc, err := mclient.KubeClient.CoreV1().Services(namespace).Get(context.TODO(), service, metav1.GetOptions{})
+			if err != nil {
+				return nil, ErrAddonExposure(err)
+			}
+			if len(svc.Spec.Ports) > 0 {
+				port = svc.Spec.Ports[0].Port
+			}
+		}
+		gateway, err := renderTemplate(gatewayTemplateFile, sampleAppGateway{
+			Name:     fmt.Sprintf("%s-gateway", service),
+			Host:     host,
+			Selector: addonGatewaySelector,
+			Port:     80,
+		})
+		if err != nil {
+			return nil, err
+		}
+		route, err := renderTemplate(addonRouteTemplateFile, map[string]interface{}{
+			"Name":    service,
+			"Host":    host,
+			"Service": service,
+			"Port":    port,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range []string{gateway, route} {
+			if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, namespace, mclient); err != nil {
+				return nil, ErrAddonExposure(err)
+			}
+		}
+		if del {
+			return nil, nil
+		}
+		return resolveAddonEndpoint(namespace, service, exposure.Mode, host, mclient)
+	}
+
+	if del {
+		return nil, nil
+	}
+
+	svcClient := mclient.KubeClient.CoreV1().Services(namespace)
+	switch exposure.Mode {
+	case ExposureLoadBalancer:
+		content, err := utils.ReadFileSource(loadBalancerPatchFile)
+		if err != nil {
+			return nil, ErrAddonExposure(err)
+		}
+		if _, err := svcClient.Patch(context.TODO(), service, types.MergePatchType, []byte(content), metav1.PatchOptions{}); err != nil {
+			return nil, ErrAddonExposure(err)
+		}
+	case ExposureNodePort:
+		svc, err := svcClient.Get(context.TODO(), service, metav1.GetOptions{})
+		if err != nil {
+			return nil, ErrAddonExposure(err)
+		}
+		svc.Spec.Type = corev1.ServiceTypeNodePort
+		if exposure.NodePort != 0 && len(svc.Spec.Ports) > 0 {
+			svc.Spec.Ports[0].NodePort = exposure.NodePort
+		}
+		if _, err := svcClient.Update(context.TODO(), svc, metav1.UpdateOptions{}); err != nil {
+			return nil, ErrAddonExposure(fmt.Errorf("failed to expose %s/%s as a NodePort service: %w", namespace, service, err))
+		}
+	}
+
+	return resolveAddonEndpoint(namespace, service, exposure.Mode, "", mclient)
+}
+
+// resolveAddonEndpoint returns the in-cluster address of the service of an
+// addon along with the URL at which it can be reached from outside the
+// cluster for the given exposure mode
+func resolveAddonEndpoint(namespace, service, mode, host string, mclient *mesherykube.Client) (*addonEndpoint, error) {
+	svcClient := mclient.KubeClient.CoreV1().Services(namespace)
+	svc, err := svcClient.Get(context.TODO(), service, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrAddonExposure(err)
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return nil, ErrAddonExposure(fmt.Errorf("service %s/%s does not expose any port", namespace, service))
+	}
+	port := svc.Spec.Ports[0]
+	endpoint := &addonEndpoint{
+		Name:     service,
+		Internal: fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", service, namespace, port.Port),
+	}
+
+	switch mode {
+	case ExposureIngressGateway:
+		address, err := gatewayAddress(mclient, ingressGatewayNamespace, addonGatewaySelector, 80)
+		if err != nil {
+			return nil, ErrAddonExposure(err)
+		}
+		endpoint.External = fmt.Sprintf("http://%s (Host: %s)", address, host)
+	case ExposureNodePort:
+		nodes, err := mclient.KubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, ErrAddonExposure(err)
+		}
+		endpoint.External = fmt.Sprintf("http://%s:%d", nodeAddress(nodes.Items), port.NodePort)
+	case ExposureLoadBalancer:
+		for i := 0; i < loadBalancerTimeout; i++ {
+			if ingress := svc.Status.LoadBalancer.Ingress; len(ingress) > 0 {
+				addr := ingress[0].IP
+				if addr == "" {
+					addr = ingress[0].Hostname
+				}
+				endpoint.External = fmt.Sprintf("http://%s:%d", addr, port.Port)
+				return endpoint, nil
+			}
+			time.Sleep(time.Second)
+			svc, err = svcClient.Get(context.TODO(), service, metav1.GetOptions{})
+			if err != nil {
+				return nil, ErrAddonExposure(err)
+			}
+		}
+		// Clusters without a load balancer controller, such as kind or
+		// minikube, never assign one: the addon is installed nonetheless
+		endpoint.Warning = fmt.Sprintf("no load balancer address was assigned to %s/%s after %ds, the cluster may have no load balancer controller", namespace, service, loadBalancerTimeout)
+		if nodePort := svc.Spec.Ports[0].NodePort; nodePort != 0 {
+			nodes, err := mclient.KubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return nil, ErrAddonExposure(err)
+			}
+			endpoint.Warning = fmt.Sprintf("%s; meanwhile it can be reached at http://%s:%d", endpoint.Warning, nodeAddress(nodes.Items), nodePort)
+		}
+	}
+	return endpoint, nil
+}
+
+// nodeAddress returns an address at which the nodes of the cluster can be
+// reached, preferring external addresses over internal ones
+func nodeAddress(nodes []corev1.Node) string {
+	internal := ""
+	for _, node := range nodes {
+		for _, addr := range node.Status.Addresses {
+			switch addr.Type {
+			case corev1.NodeExternalIP:
+				return addr.Address
+			case corev1.NodeInternalIP:
+				if internal == "" {
+					internal = addr.Address
+				}
+			}
+		}
+	}
+	if internal == "" {
+		return "localhost"
 	}
-	return st, ErrAddonFromTemplate(mergeErrors(errs))
+	return internal
 }
@@ -12,7 +12,7 @@ func TestIstio_installAddon(t *testing.T) {
 		namespace string
 		del       bool
 		service   string
-		patches   []string
+		exposure  addonExposure
 		templates []adapter.Template
 	}
 
@@ -30,7 +30,7 @@ func TestIstio_installAddon(t *testing.T) {
 				namespace: "default",
 				del:       false,
 				service:   "test",
-				patches:   nil,
+				exposure:  defaultAddonExposure(),
 				templates: []adapter.Template{
 					"https://raw.githubusercontent.com/istio/istio/master/samples/addons/jaeger.yaml",
 				},
@@ -44,7 +44,7 @@ func TestIstio_installAddon(t *testing.T) {
 				namespace: "default",
 				del:       false,
 				service:   "test",
-				patches:   nil,
+				exposure:  defaultAddonExposure(),
 				templates: nil,
 			},
 			want:    status.Installed,
@@ -56,7 +56,7 @@ func TestIstio_installAddon(t *testing.T) {
 				namespace: "default",
 				del:       true,
 				service:   "test",
-				patches:   nil,
+				exposure:  defaultAddonExposure(),
 				templates: nil,
 			},
 			want:    status.Installed,
@@ -71,7 +71,7 @@ func TestIstio_installAddon(t *testing.T) {
 					Log:    getLoggerHandler(t),
 				},
 			}
-			got, err := istio.installAddon(tt.args.namespace, tt.args.del, tt.args.service, tt.args.patches, tt.args.templates, tt.kubeconfigs)
+			got, _, err := istio.installAddon(tt.args.namespace, tt.args.del, tt.args.service, tt.args.exposure, tt.args.templates, tt.kubeconfigs)
 			if (err != nil) == tt.wantErr {
 				t.Errorf("Istio.installAddon() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -82,3 +82,128 @@ func TestIstio_installAddon(t *testing.T) {
 		})
 	}
 }
+
+func TestAddonExposure_validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		exposure addonExposure
+		wantErr  bool
+	}{
+		{
+			name:     "cluster ip",
+			exposure: addonExposure{Mode: ExposureClusterIP},
+			wantErr:  false,
+		},
+		{
+			name:     "node port with chosen port",
+			exposure: addonExposure{Mode: ExposureNodePort, NodePort: 30090},
+			wantErr:  false,
+		},
+		{
+			name:     "node port out of range",
+			exposure: addonExposure{Mode: ExposureNodePort, NodePort: 70000},
+			wantErr:  true,
+		},
+		{
+			name:     "node port outside the node port range",
+			exposure: addonExposure{Mode: ExposureNodePort, NodePort: 8080},
+			wantErr:  true,
+		},
+		{
+			name:     "node port allocated by the API server",
+			exposure: addonExposure{Mode: ExposureNodePort},
+		},
+		{
+			name:     "ingress gateway",
+			exposure: addonExposure{Mode: ExposureIngressGateway, Host: "grafana.example.com"},
+			wantErr:  false,
+		},
+		{
+			name:     "unknown mode",
+			exposure: addonExposure{Mode: "Ingress"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.exposure.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("addonExposure.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOperationParams_addonExposure(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    addonExposure
+		wantErr bool
+	}{
+		{
+			name: "empty body keeps defaults",
+			body: "",
+			want: defaultAddonExposure(),
+		},
+		{
+			name: "yaml body",
+			body: "exposure: NodePort\nnodePort: 30300\n",
+			want: addonExposure{Mode: ExposureNodePort, NodePort: 30300},
+		},
+		{
+			name: "json body",
+			body: `{"exposure": "IngressGateway", "host": "kiali.example.com"}`,
+			want: addonExposure{Mode: ExposureIngressGateway, Host: "kiali.example.com"},
+		},
+		{
+			name:    "malformed body",
+			body:    "exposure: [",
+			want:    defaultAddonExposure(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := defaultAddonExposure()
+			err := parseOperationParams(tt.body, &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseOperationParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseOperationParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddonEndpoint_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint addonEndpoint
+		want     string
+	}{
+		{
+			name:     "in-cluster only",
+			endpoint: addonEndpoint{Name: "grafana", Internal: "http://grafana.istio-system.svc.cluster.local:3000"},
+			want:     "grafana: in-cluster http://grafana.istio-system.svc.cluster.local:3000",
+		},
+		{
+			name:     "external address",
+			endpoint: addonEndpoint{Name: "grafana", Internal: "http://grafana.istio-system.svc.cluster.local:3000", External: "http://1.2.3.4:3000"},
+			want:     "grafana: in-cluster http://grafana.istio-system.svc.cluster.local:3000, external http://1.2.3.4:3000",
+		},
+		{
+			name:     "pending load balancer",
+			endpoint: addonEndpoint{Name: "grafana", Internal: "http://grafana.istio-system.svc.cluster.local:3000", Warning: "no load balancer address"},
+			want:     "grafana: in-cluster http://grafana.istio-system.svc.cluster.local:3000, external address pending\nwarning: no load balancer address",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.String(); got != tt.want {
+				t.Errorf("addonEndpoint.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
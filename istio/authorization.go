@@ -0,0 +1,281 @@
+package istio
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+)
+
+// Actions of an AuthorizationPolicy
+const (
+	AuthorizationAllow  = "ALLOW"
+	AuthorizationDeny   = "DENY"
+	AuthorizationAudit  = "AUDIT"
+	AuthorizationCustom = "CUSTOM"
+
+	securityAPIVersion = "security.istio.io/v1beta1"
+)
+
+// authorizationRule matches the requests coming from any of the sources, to
+// any of the operations, carrying all the claims. The fields left empty
+// match every request.
+type authorizationRule struct {
+	// Principals are the identities of the peers, e.g.
+	// cluster.local/ns/default/sa/sleep
+	Principals []string `yaml:"principals,omitempty"`
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// IPBlocks are IPs or CIDR ranges of the peers
+	IPBlocks []string `yaml:"ipBlocks,omitempty"`
+	// RequestPrincipals are the issuer/subject of the JWT of the request,
+	// NotRequestPrincipals the ones it must not match
+	RequestPrincipals    []string `yaml:"requestPrincipals,omitempty"`
+	NotRequestPrincipals []string `yaml:"notRequestPrincipals,omitempty"`
+	Methods              []string `yaml:"methods,omitempty"`
+	Paths                []string `yaml:"paths,omitempty"`
+	Ports                []string `yaml:"ports,omitempty"`
+	// Claims are the accepted values of the claims of the JWT of the
+	// request, which must be validated by a RequestAuthentication
+	Claims map[string][]string `yaml:"claims,omitempty"`
+}
+
+// authorizationPolicy are the parameters of the AuthorizationPolicy
+// operation and trait
+type authorizationPolicy struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Selector of the workloads, every workload of the namespace when empty
+	Selector map[string]string `yaml:"selector,omitempty"`
+	Action   string            `yaml:"action"`
+	// Provider is the extension provider handling the CUSTOM action
+	Provider string              `yaml:"provider,omitempty"`
+	Rules    []authorizationRule `yaml:"rules,omitempty"`
+}
+
+func defaultAuthorizationPolicy() authorizationPolicy {
+	return authorizationPolicy{
+		Action: AuthorizationAllow,
+	}
+}
+
+func (p authorizationPolicy) validate() error {
+	if p.Name == "" {
+		return ErrAuthorizationPolicy(fmt.Errorf("a name is required"))
+	}
+	switch p.Action {
+	case AuthorizationAllow:
+	case AuthorizationDeny, AuthorizationAudit, AuthorizationCustom:
+		// without rules the policy never matches, unlike an ALLOW policy
+		// which then denies every request
+		if len(p.Rules) == 0 {
+			return ErrAuthorizationPolicy(fmt.Errorf("a %s policy requires at least one rule", p.Action))
+		}
+	default:
+		return ErrAuthorizationPolicy(fmt.Errorf("invalid action %s, use %s", p.Action, strings.Join([]string{AuthorizationAllow, AuthorizationDeny, AuthorizationAudit, AuthorizationCustom}, ", ")))
+	}
+	if p.Action == AuthorizationCustom && p.Provider == "" {
+		return ErrAuthorizationPolicy(fmt.Errorf("the %s action requires a provider", AuthorizationCustom))
+	}
+	if p.Action != AuthorizationCustom && p.Provider != "" {
+		return ErrAuthorizationPolicy(fmt.Errorf("a provider only applies to the %s action", AuthorizationCustom))
+	}
+	for i, rule := range p.Rules {
+		for _, block := range rule.IPBlocks {
+			if net.ParseIP(block) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(block); err != nil {
+				return ErrAuthorizationPolicy(fmt.Errorf("rule %d: invalid IP block %s", i, block))
+			}
+		}
+		for claim, values := range rule.Claims {
+			if len(values) == 0 {
+				return ErrAuthorizationPolicy(fmt.Errorf("rule %d: the claim %s has no value", i, claim))
+			}
+		}
+	}
+	return nil
+}
+
+// spec renders the rule in the format of the AuthorizationPolicy
+func (r authorizationRule) spec() map[string]interface{} {
+	rule := map[string]interface{}{}
+	source := map[string]interface{}{}
+	if len(r.Principals) > 0 {
+		source["principals"] = r.Principals
+	}
+	if len(r.Namespaces) > 0 {
+		source["namespaces"] = r.Namespaces
+	}
+	if len(r.IPBlocks) > 0 {
+		source["ipBlocks"] = r.IPBlocks
+	}
+	if len(r.RequestPrincipals) > 0 {
+		source["requestPrincipals"] = r.RequestPrincipals
+	}
+	if len(r.NotRequestPrincipals) > 0 {
+		source["notRequestPrincipals"] = r.NotRequestPrincipals
+	}
+	if len(source) > 0 {
+		rule["from"] = []interface{}{map[string]interface{}{"source": source}}
+	}
+
+	operation := map[string]interface{}{}
+	if len(r.Methods) > 0 {
+		operation["methods"] = r.Methods
+	}
+	if len(r.Paths) > 0 {
+		operation["paths"] = r.Paths
+	}
+	if len(r.Ports) > 0 {
+		operation["ports"] = r.Ports
+	}
+	if len(operation) > 0 {
+		rule["to"] = []interface{}{map[string]interface{}{"operation": operation}}
+	}
+
+	if len(r.Claims) > 0 {
+		claims := make([]string, 0, len(r.Claims))
+		for claim := range r.Claims {
+			claims = append(claims, claim)
+		}
+		sort.Strings(claims)
+		var conditions []interface{}
+		for _, claim := range claims {
+			conditions = append(conditions, map[string]interface{}{
+				"key":    fmt.Sprintf("request.auth.claims[%s]", claim),
+				"values": r.Claims[claim],
+			})
+		}
+		rule["when"] = conditions
+	}
+	return rule
+}
+
+// resource returns the AuthorizationPolicy in the given namespace
+func (p authorizationPolicy) resource(namespace string) map[string]interface{} {
+	spec := map[string]interface{}{
+		"action": p.Action,
+	}
+	if len(p.Selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": p.Selector}
+	}
+	if p.Provider != "" {
+		spec["provider"] = map[string]interface{}{"name": p.Provider}
+	}
+	if len(p.Rules) > 0 {
+		rules := make([]interface{}, 0, len(p.Rules))
+		for _, rule := range p.Rules {
+			rules = append(rules, rule.spec())
+		}
+		spec["rules"] = rules
+	}
+	return map[string]interface{}{
+		"apiVersion": securityAPIVersion,
+		"kind":       "AuthorizationPolicy",
+		"metadata": map[string]interface{}{
+			"name":      p.Name,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+}
+
+func (p authorizationPolicy) describe(namespace string) string {
+	target := "every workload"
+	if len(p.Selector) > 0 {
+		target = "the workloads matching " + formatSelector(p.Selector)
+	}
+	if p.Action == AuthorizationAllow && len(p.Rules) == 0 {
+		return fmt.Sprintf("AuthorizationPolicy %s/%s applied, denying every request to %s", namespace, p.Name, target)
+	}
+	return fmt.Sprintf("AuthorizationPolicy %s/%s applied with %d %s rule(s) on %s", namespace, p.Name, len(p.Rules), p.Action, target)
+}
+
+// formatSelector returns the selector in its label selector form
+func formatSelector(selector map[string]string) string {
+	pairs := make([]string, 0, len(selector))
+	for _, k := range sortedStringKeys(selector) {
+		pairs = append(pairs, k+"="+selector[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// configureAuthorizationPolicy renders the AuthorizationPolicy, validates it
+// against the schema of the installed Istio version and applies it
+func (istio *Istio) configureAuthorizationPolicy(namespace string, del bool, policy authorizationPolicy, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+		if policy.Name == "" {
+			return st, nil, ErrAuthorizationPolicy(fmt.Errorf("a name is required"))
+		}
+	} else if err := policy.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			msg, err := istio.configureAuthorizationPolicyOnSingleCluster(namespace, del, policy, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			msgs = append(msgs, msg)
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrAuthorizationPolicy(mergeErrors(errs))
+}
+
+func (istio *Istio) configureAuthorizationPolicyOnSingleCluster(namespace string, del bool, policy authorizationPolicy, mclient *mesherykube.Client) (string, error) {
+	resource := policy.resource(namespace)
+	if !del {
+		version, err := controlPlaneVersion(mclient)
+		if err != nil {
+			return "", err
+		}
+		if err := validateAgainstMeshmodel("AuthorizationPolicy", version, resource); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := yaml.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	if err := istio.applyManifestOnSingleCluster(manifest, del, namespace, mclient); err != nil {
+		return "", err
+	}
+	if del {
+		return fmt.Sprintf("AuthorizationPolicy %s/%s deleted", namespace, policy.Name), nil
+	}
+	return policy.describe(namespace), nil
+}
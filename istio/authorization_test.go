@@ -0,0 +1,117 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthorizationPolicy_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "allow without rules",
+			params: "{name: deny-all}",
+		},
+		{
+			name:   "deny from an IP block",
+			params: "{name: block, action: DENY, rules: [{ipBlocks: [10.0.0.0/8, 192.168.1.1]}]}",
+		},
+		{
+			name:    "deny without rules",
+			params:  "{name: block, action: DENY}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid action",
+			params:  "{name: block, action: REJECT, rules: [{methods: [GET]}]}",
+			wantErr: true,
+		},
+		{
+			name:    "custom without provider",
+			params:  "{name: ext, action: CUSTOM, rules: [{paths: [/admin]}]}",
+			wantErr: true,
+		},
+		{
+			name:    "provider with allow",
+			params:  "{name: ext, provider: opa, rules: [{paths: [/admin]}]}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid IP block",
+			params:  "{name: block, action: DENY, rules: [{ipBlocks: [10.0.0.0/33]}]}",
+			wantErr: true,
+		},
+		{
+			name:    "claim without value",
+			params:  "{name: jwt, rules: [{claims: {iss: []}}]}",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			params:  "{action: ALLOW}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := defaultAuthorizationPolicy()
+			if err := parseOperationParams(tt.params, &policy); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := policy.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("authorizationPolicy.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizationPolicy_resource(t *testing.T) {
+	policy := defaultAuthorizationPolicy()
+	params := `
+name: productpage-viewer
+selector: {app: productpage}
+rules:
+- principals: [cluster.local/ns/bookinfo/sa/bookinfo-gateway-istio]
+  namespaces: [bookinfo]
+  methods: [GET]
+  paths: [/productpage, /static/*]
+  ports: [9080]
+  claims: {iss: [https://issuer.example.com], groups: [viewers]}
+`
+	if err := parseOperationParams(params, &policy); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	if err := policy.validate(); err != nil {
+		t.Fatalf("authorizationPolicy.validate() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"action":   "ALLOW",
+		"selector": map[string]interface{}{"matchLabels": map[string]string{"app": "productpage"}},
+		"rules": []interface{}{map[string]interface{}{
+			"from": []interface{}{map[string]interface{}{"source": map[string]interface{}{
+				"principals": []string{"cluster.local/ns/bookinfo/sa/bookinfo-gateway-istio"},
+				"namespaces": []string{"bookinfo"},
+			}}},
+			"to": []interface{}{map[string]interface{}{"operation": map[string]interface{}{
+				"methods": []string{"GET"},
+				"paths":   []string{"/productpage", "/static/*"},
+				"ports":   []string{"9080"},
+			}}},
+			"when": []interface{}{
+				map[string]interface{}{"key": "request.auth.claims[groups]", "values": []string{"viewers"}},
+				map[string]interface{}{"key": "request.auth.claims[iss]", "values": []string{"https://issuer.example.com"}},
+			},
+		}},
+	}
+	resource := policy.resource("bookinfo")
+	if got := resource["spec"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("spec = %v, want %v", got, want)
+	}
+	if err := validateAgainstMeshmodel("AuthorizationPolicy", minorVersion{Major: 1, Minor: 20}, resource); err != nil {
+		t.Errorf("validateAgainstMeshmodel() error = %v", err)
+	}
+}
@@ -0,0 +1,524 @@
+package istio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/common"
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// circuitBreakerAnnotation records on a DestinationRule the traffic
+	// policy fields replaced by the circuit breaker, so that they can be
+	// restored
+	circuitBreakerAnnotation = "meshery.io/circuit-breaker"
+
+	fortioManifestFile = "file://templates/fortio/fortio.yaml"
+	fortioDeployment   = "fortio-deploy"
+	httpbinDeployment  = "httpbin"
+	httpbinURL         = "http://httpbin:8000/get"
+)
+
+var destinationRuleGVR = virtualServiceGVR.GroupVersion().WithResource("destinationrules")
+
+// circuitBreaker describes the connection pool limits and the outlier
+// detection of a host
+type circuitBreaker struct {
+	// Namespace of the DestinationRules, only used by the OAM trait
+	Namespace string `yaml:"namespace,omitempty"`
+	// Host the traffic policy applies to
+	Host string `yaml:"host,omitempty"`
+
+	MaxConnections           int `yaml:"maxConnections,omitempty"`
+	MaxPendingRequests       int `yaml:"maxPendingRequests,omitempty"`
+	MaxRequestsPerConnection int `yaml:"maxRequestsPerConnection,omitempty"`
+
+	// Number of consecutive 5xx errors before a host is ejected
+	ConsecutiveErrors int `yaml:"consecutiveErrors,omitempty"`
+	// Time between two analysis sweeps, e.g. 1s
+	Interval string `yaml:"interval,omitempty"`
+	// Minimum ejection duration, e.g. 3m
+	BaseEjectionTime   string `yaml:"baseEjectionTime,omitempty"`
+	MaxEjectionPercent int    `yaml:"maxEjectionPercent,omitempty"`
+
+	// Runs fortio against httpbin once configured to show the breaker trip
+	LoadTest *loadTest `yaml:"loadTest,omitempty"`
+}
+
+// loadTest is the fortio run showing the circuit breaker at work
+type loadTest struct {
+	Connections int `yaml:"connections,omitempty"`
+	Requests    int `yaml:"requests,omitempty"`
+}
+
+// circuitBreakerRecord holds the traffic policy fields of a DestinationRule
+// before the circuit breaker was configured
+type circuitBreakerRecord struct {
+	Created bool `json:"created,omitempty"`
+	// Traffic policy fields set by the circuit breaker
+	Replaced []string `json:"replaced,omitempty"`
+	// Previous values of the replaced fields which were set
+	Previous map[string]interface{} `json:"previous,omitempty"`
+}
+
+func (c circuitBreaker) validate() error {
+	if c.Host == "" {
+		return ErrCircuitBreaker(fmt.Errorf("host is required"))
+	}
+	for name, value := range map[string]int{
+		"maxConnections":           c.MaxConnections,
+		"maxPendingRequests":       c.MaxPendingRequests,
+		"maxRequestsPerConnection": c.MaxRequestsPerConnection,
+		"consecutiveErrors":        c.ConsecutiveErrors,
+	} {
+		if value < 0 {
+			return ErrCircuitBreaker(fmt.Errorf("%s must be positive, got %d", name, value))
+		}
+	}
+	if c.MaxEjectionPercent < 0 || c.MaxEjectionPercent > 100 {
+		return ErrCircuitBreaker(fmt.Errorf("maxEjectionPercent must be between 0 and 100, got %d", c.MaxEjectionPercent))
+	}
+	for name, value := range map[string]string{"interval": c.Interval, "baseEjectionTime": c.BaseEjectionTime} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return ErrCircuitBreaker(fmt.Errorf("invalid %s %s: %w", name, value, err))
+		}
+	}
+	if c.connectionPool() == nil && c.outlierDetection() == nil {
+		return ErrCircuitBreaker(fmt.Errorf("neither connection pool limits nor outlier detection settings were given"))
+	}
+	return nil
+}
+
+func (c circuitBreaker) connectionPool() map[string]interface{} {
+	pool := map[string]interface{}{}
+	if c.MaxConnections > 0 {
+		pool["tcp"] = map[string]interface{}{"maxConnections": int64(c.MaxConnections)}
+	}
+	httpPool := map[string]interface{}{}
+	if c.MaxPendingRequests > 0 {
+		httpPool["http1MaxPendingRequests"] = int64(c.MaxPendingRequests)
+	}
+	if c.MaxRequestsPerConnection > 0 {
+		httpPool["maxRequestsPerConnection"] = int64(c.MaxRequestsPerConnection)
+	}
+	if len(httpPool) > 0 {
+		pool["http"] = httpPool
+	}
+	if len(pool) == 0 {
+		return nil
+	}
+	return pool
+}
+
+func (c circuitBreaker) outlierDetection() map[string]interface{} {
+	detection := map[string]interface{}{}
+	if c.ConsecutiveErrors > 0 {
+		detection["consecutive5xxErrors"] = int64(c.ConsecutiveErrors)
+	}
+	if c.Interval != "" {
+		detection["interval"] = c.Interval
+	}
+	if c.BaseEjectionTime != "" {
+		detection["baseEjectionTime"] = c.BaseEjectionTime
+	}
+	if c.MaxEjectionPercent > 0 {
+		detection["maxEjectionPercent"] = int64(c.MaxEjectionPercent)
+	}
+	if len(detection) == 0 {
+		return nil
+	}
+	return detection
+}
+
+// applyCircuitBreaker sets the connection pool and outlier detection of the
+// traffic policy of the DestinationRule, keeping its other settings such as
+// the subsets and TLS, and records the replaced values
+func applyCircuitBreaker(dr *unstructured.Unstructured, c circuitBreaker) error {
+	if _, ok := dr.GetAnnotations()[circuitBreakerAnnotation]; ok {
+		return ErrCircuitBreaker(fmt.Errorf("a circuit breaker is already configured by DestinationRule %s, remove it first", dr.GetName()))
+	}
+	record, err := setCircuitBreakerFields(dr, c)
+	if err != nil {
+		return err
+	}
+	return setCircuitBreakerRecord(dr, record)
+}
+
+// setCircuitBreakerFields sets the traffic policy fields of the circuit
+// breaker and returns the record of the replaced values
+func setCircuitBreakerFields(dr *unstructured.Unstructured, c circuitBreaker) (circuitBreakerRecord, error) {
+	record := circuitBreakerRecord{Previous: map[string]interface{}{}}
+	for field, value := range map[string]map[string]interface{}{
+		"connectionPool":   c.connectionPool(),
+		"outlierDetection": c.outlierDetection(),
+	} {
+		if value == nil {
+			continue
+		}
+		if previous, found, _ := unstructured.NestedFieldCopy(dr.Object, "spec", "trafficPolicy", field); found {
+			record.Previous[field] = previous
+		}
+		if err := unstructured.SetNestedMap(dr.Object, value, "spec", "trafficPolicy", field); err != nil {
+			return record, ErrCircuitBreaker(err)
+		}
+		record.Replaced = append(record.Replaced, field)
+	}
+	return record, nil
+}
+
+// revertCircuitBreaker restores the traffic policy of the DestinationRule.
+// It reports whether the DestinationRule was created by the circuit breaker
+// and holds nothing else, a traffic shift may have added its subsets since,
+// in which case the DestinationRule is kept.
+func revertCircuitBreaker(dr *unstructured.Unstructured) (bool, error) {
+	annotations := dr.GetAnnotations()
+	raw, ok := annotations[circuitBreakerAnnotation]
+	if !ok {
+		return false, nil
+	}
+	record := circuitBreakerRecord{}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false, ErrCircuitBreaker(err)
+	}
+	for _, field := range record.Replaced {
+		if previous, ok := record.Previous[field]; ok {
+			if err := unstructured.SetNestedField(dr.Object, runtime.DeepCopyJSONValue(previous), "spec", "trafficPolicy", field); err != nil {
+				return false, ErrCircuitBreaker(err)
+			}
+			continue
+		}
+		unstructured.RemoveNestedField(dr.Object, "spec", "trafficPolicy", field)
+	}
+	if policy, found, _ := unstructured.NestedMap(dr.Object, "spec", "trafficPolicy"); found && len(policy) == 0 {
+		unstructured.RemoveNestedField(dr.Object, "spec", "trafficPolicy")
+	}
+
+	delete(annotations, circuitBreakerAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	dr.SetAnnotations(annotations)
+	return record.Created && hasOnlyHosts(dr), nil
+}
+
+func setCircuitBreakerRecord(dr *unstructured.Unstructured, record circuitBreakerRecord) error {
+	byt, err := json.Marshal(record)
+	if err != nil {
+		return ErrCircuitBreaker(err)
+	}
+	annotations := dr.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[circuitBreakerAnnotation] = string(byt)
+	dr.SetAnnotations(annotations)
+	return nil
+}
+
+// newCircuitBreakerDestinationRule returns a DestinationRule holding the
+// circuit breaker, for hosts without any DestinationRule yet
+func newCircuitBreakerDestinationRule(namespace string, c circuitBreaker) (*unstructured.Unstructured, error) {
+	dr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       "DestinationRule",
+		"metadata": map[string]interface{}{
+			"name":      fmt.Sprintf("%s-circuit-breaker", subsetName(c.Host)),
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"host": c.Host,
+		},
+	}}
+	record, err := setCircuitBreakerFields(dr, c)
+	if err != nil {
+		return nil, err
+	}
+	record.Created = true
+	return dr, setCircuitBreakerRecord(dr, record)
+}
+
+// destinationRulesForHost returns the DestinationRules of the namespace
+// which apply to the host
+func destinationRulesForHost(mclient *mesherykube.Client, namespace, host string) ([]unstructured.Unstructured, error) {
+	list, err := mclient.DynamicKubeClient.Resource(destinationRuleGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	target := qualifiedHost(host, namespace)
+	var matching []unstructured.Unstructured
+	for _, dr := range list.Items {
+		if h, _, _ := unstructured.NestedString(dr.Object, "spec", "host"); qualifiedHost(h, namespace) == target {
+			matching = append(matching, dr)
+		}
+	}
+	return matching, nil
+}
+
+// configureCircuitBreaker sets or reverts the connection pool limits and
+// outlier detection of the host
+func (istio *Istio) configureCircuitBreaker(namespace string, del bool, breaker circuitBreaker, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if del && breaker.Host == "" {
+		return st, nil, ErrCircuitBreaker(fmt.Errorf("host is required"))
+	}
+	if !del {
+		if err := breaker.validate(); err != nil {
+			return st, nil, err
+		}
+	}
+	if breaker.LoadTest != nil && qualifiedHost(breaker.Host, namespace) != qualifiedHost(httpbinDeployment, namespace) {
+		return st, nil, ErrCircuitBreaker(fmt.Errorf("the load test runs against httpbin, the circuit breaker is configured for %s", breaker.Host))
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureCircuitBreakerOnSingleCluster(namespace, del, breaker, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrCircuitBreaker(mergeErrors(errs))
+}
+
+func (istio *Istio) configureCircuitBreakerOnSingleCluster(namespace string, del bool, breaker circuitBreaker, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	drClient := mclient.DynamicKubeClient.Resource(destinationRuleGVR).Namespace(namespace)
+
+	if !del && breaker.LoadTest != nil {
+		if err := istio.deployLoadTestApps(namespace, mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("fortio and httpbin running in namespace %s", namespace))
+	}
+
+	rules, err := destinationRulesForHost(mclient, namespace, breaker.Host)
+	if err != nil {
+		return msgs, ErrCircuitBreaker(err)
+	}
+
+	switch {
+	case del:
+		for i := range rules {
+			dr := &rules[i]
+			if _, ok := dr.GetAnnotations()[circuitBreakerAnnotation]; !ok {
+				continue
+			}
+			remove, err := revertCircuitBreaker(dr)
+			if err != nil {
+				return msgs, err
+			}
+			if remove {
+				err = drClient.Delete(context.TODO(), dr.GetName(), metav1.DeleteOptions{})
+			} else {
+				_, err = drClient.Update(context.TODO(), dr, metav1.UpdateOptions{})
+			}
+			if err != nil && !kubeerror.IsNotFound(err) {
+				return msgs, ErrCircuitBreaker(err)
+			}
+			if remove {
+				msgs = append(msgs, fmt.Sprintf("DestinationRule %s/%s of the circuit breaker deleted", namespace, dr.GetName()))
+				continue
+			}
+			msgs = append(msgs, fmt.Sprintf("circuit breaker removed from DestinationRule %s/%s", namespace, dr.GetName()))
+		}
+		return msgs, nil
+	case len(rules) == 0:
+		dr, err := newCircuitBreakerDestinationRule(namespace, breaker)
+		if err != nil {
+			return msgs, err
+		}
+		if _, err := drClient.Create(context.TODO(), dr, metav1.CreateOptions{}); err != nil {
+			return msgs, ErrCircuitBreaker(err)
+		}
+		msgs = append(msgs, fmt.Sprintf("DestinationRule %s/%s created with a circuit breaker for %s", namespace, dr.GetName(), breaker.Host))
+	default:
+		for i := range rules {
+			dr := &rules[i]
+			if err := applyCircuitBreaker(dr, breaker); err != nil {
+				return msgs, err
+			}
+			if _, err := drClient.Update(context.TODO(), dr, metav1.UpdateOptions{}); err != nil {
+				return msgs, ErrCircuitBreaker(err)
+			}
+			msgs = append(msgs, fmt.Sprintf("circuit breaker merged into DestinationRule %s/%s", namespace, dr.GetName()))
+		}
+	}
+
+	if breaker.LoadTest == nil {
+		return msgs, nil
+	}
+	// Leave the proxies some time to receive the new configuration
+	time.Sleep(readinessPollInterval * time.Second)
+	result, err := runFortioLoadTest(namespace, *breaker.LoadTest, mclient)
+	if err != nil {
+		return msgs, err
+	}
+	return append(msgs, result.String()), nil
+}
+
+// deployLoadTestApps deploys fortio and httpbin in the namespace, labeled
+// for injection, and waits for them to be ready
+func (istio *Istio) deployLoadTestApps(namespace string, mclient *mesherykube.Client) error {
+	if err := prepareNamespace(mclient, namespace, ""); err != nil {
+		return err
+	}
+	manifests := []string{
+		common.Operations[common.HTTPBinOperation].Templates[0].String(),
+		adapter.Template(fortioManifestFile).String(),
+	}
+	for _, manifest := range manifests {
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), false, namespace, mclient); err != nil {
+			return ErrLoadTest(err)
+		}
+	}
+	if err := waitForDeployments(mclient, namespace, []string{httpbinDeployment, fortioDeployment}); err != nil {
+		return err
+	}
+	return waitForSidecars(mclient, namespace, []string{httpbinDeployment, fortioDeployment})
+}
+
+// loadTestResult summarizes a fortio run
+type loadTestResult struct {
+	RetCodes map[string]int64
+	Overflow int64
+}
+
+func (r loadTestResult) total() int64 {
+	var total int64
+	for _, count := range r.RetCodes {
+		total += count
+	}
+	return total
+}
+
+func (r loadTestResult) String() string {
+	total := r.total()
+	codes := make([]string, 0, len(r.RetCodes))
+	for code := range r.RetCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	var counts []string
+	for _, code := range codes {
+		counts = append(counts, fmt.Sprintf("%s: %d", code, r.RetCodes[code]))
+	}
+	rate := 0.0
+	if total > 0 {
+		rate = float64(r.RetCodes["503"]) * 100 / float64(total)
+	}
+	return fmt.Sprintf("fortio sent %d requests to httpbin (%s), 503 rate %.1f%%, %d requests overflowed the connection pool", total, strings.Join(counts, ", "), rate, r.Overflow)
+}
+
+// runFortioLoadTest runs fortio against httpbin and collects the response
+// codes along with the pending requests overflow reported by its sidecar
+func runFortioLoadTest(namespace string, test loadTest, mclient *mesherykube.Client) (*loadTestResult, error) {
+	if test.Connections <= 0 {
+		test.Connections = 3
+	}
+	if test.Requests <= 0 {
+		test.Requests = 30
+	}
+	pod, err := runningPod(mclient, namespace, "app=fortio")
+	if err != nil {
+		return nil, ErrLoadTest(err)
+	}
+
+	out, err := execInPod(mclient, namespace, pod, "fortio", []string{
+		"fortio", "load", "-c", strconv.Itoa(test.Connections), "-qps", "0", "-n", strconv.Itoa(test.Requests),
+		"-loglevel", "Warning", "-json", "-", httpbinURL,
+	})
+	if err != nil {
+		return nil, ErrLoadTest(err)
+	}
+	result, err := parseFortioResult(out)
+	if err != nil {
+		return nil, ErrLoadTest(err)
+	}
+
+	stats, err := execInPod(mclient, namespace, pod, sidecarContainerName, []string{"pilot-agent", "request", "GET", "stats"})
+	if err != nil {
+		return nil, ErrLoadTest(err)
+	}
+	result.Overflow = pendingOverflow(stats, httpbinDeployment)
+	return result, nil
+}
+
+// parseFortioResult extracts the response codes from the JSON output of fortio
+func parseFortioResult(out string) (*loadTestResult, error) {
+	// fortio may print log lines before the JSON result
+	if i := strings.Index(out, "{"); i > 0 {
+		out = out[i:]
+	}
+	result := &loadTestResult{}
+	if err := json.Unmarshal([]byte(out), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// pendingOverflow sums the requests which overflowed the connection pool of
+// the outbound clusters of the service, from the envoy stats
+func pendingOverflow(stats, service string) int64 {
+	var overflow int64
+	scanner := bufio.NewScanner(strings.NewReader(stats))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "cluster.outbound|") || !strings.Contains(line, "|"+service+".") {
+			continue
+		}
+		name, value, found := strings.Cut(line, ": ")
+		if !found || !strings.HasSuffix(name, ".upstream_rq_pending_overflow") {
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			overflow += n
+		}
+	}
+	return overflow
+}
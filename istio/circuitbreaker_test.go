@@ -0,0 +1,152 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const testHTTPBinDestinationRule = `
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: httpbin
+  namespace: default
+spec:
+  host: httpbin
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+    outlierDetection:
+      consecutive5xxErrors: 7
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+`
+
+func TestApplyCircuitBreaker_revert(t *testing.T) {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(testHTTPBinDestinationRule), &obj); err != nil {
+		t.Fatalf("failed to decode test DestinationRule: %v", err)
+	}
+	original := &unstructured.Unstructured{Object: obj}
+
+	tests := []struct {
+		name    string
+		breaker circuitBreaker
+	}{
+		{
+			name:    "connection pool only keeps the outlier detection",
+			breaker: circuitBreaker{Host: "httpbin", MaxConnections: 1, MaxPendingRequests: 1},
+		},
+		{
+			name:    "outlier detection replaces the existing one",
+			breaker: circuitBreaker{Host: "httpbin", ConsecutiveErrors: 1, Interval: "1s", BaseEjectionTime: "3m", MaxEjectionPercent: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.breaker.validate(); err != nil {
+				t.Fatalf("circuitBreaker.validate() error = %v", err)
+			}
+			dr := original.DeepCopy()
+			if err := applyCircuitBreaker(dr, tt.breaker); err != nil {
+				t.Fatalf("applyCircuitBreaker() error = %v", err)
+			}
+			for _, field := range []string{"tls", "outlierDetection"} {
+				if _, found, _ := unstructured.NestedFieldNoCopy(dr.Object, "spec", "trafficPolicy", field); !found {
+					t.Errorf("applyCircuitBreaker() dropped trafficPolicy.%s", field)
+				}
+			}
+			if subsets, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets"); len(subsets) != 1 {
+				t.Errorf("applyCircuitBreaker() changed the subsets: %v", subsets)
+			}
+			if err := applyCircuitBreaker(dr.DeepCopy(), tt.breaker); err == nil {
+				t.Errorf("applyCircuitBreaker() twice should fail")
+			}
+
+			created, err := revertCircuitBreaker(dr)
+			if err != nil || created {
+				t.Fatalf("revertCircuitBreaker() = %v, %v, want false, nil", created, err)
+			}
+			if !reflect.DeepEqual(dr.Object, original.Object) {
+				t.Errorf("revertCircuitBreaker() = %v, want %v", dr.Object, original.Object)
+			}
+		})
+	}
+}
+
+func TestRevertCircuitBreaker_created(t *testing.T) {
+	breaker := circuitBreaker{Host: "httpbin", MaxConnections: 1}
+	dr, err := newCircuitBreakerDestinationRule("default", breaker)
+	if err != nil {
+		t.Fatalf("newCircuitBreakerDestinationRule() error = %v", err)
+	}
+	if remove, err := revertCircuitBreaker(dr.DeepCopy()); err != nil || !remove {
+		t.Errorf("revertCircuitBreaker() = %v, %v, want true, nil", remove, err)
+	}
+
+	subsets := []interface{}{map[string]interface{}{"name": "v1", "labels": map[string]interface{}{"version": "v1"}}}
+	if err := unstructured.SetNestedSlice(dr.Object, subsets, "spec", "subsets"); err != nil {
+		t.Fatalf("failed to set the subsets: %v", err)
+	}
+	remove, err := revertCircuitBreaker(dr)
+	if err != nil || remove {
+		t.Fatalf("revertCircuitBreaker() = %v, %v, want false, nil", remove, err)
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(dr.Object, "spec", "trafficPolicy"); found {
+		t.Errorf("revertCircuitBreaker() kept the traffic policy: %v", dr.Object)
+	}
+	if got, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets"); !reflect.DeepEqual(got, subsets) {
+		t.Errorf("revertCircuitBreaker() subsets = %v, want %v", got, subsets)
+	}
+	if len(dr.GetAnnotations()) != 0 {
+		t.Errorf("revertCircuitBreaker() kept the annotations %v", dr.GetAnnotations())
+	}
+}
+
+func TestCircuitBreaker_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		breaker circuitBreaker
+		wantErr bool
+	}{
+		{name: "no settings", breaker: circuitBreaker{Host: "httpbin"}, wantErr: true},
+		{name: "invalid interval", breaker: circuitBreaker{Host: "httpbin", ConsecutiveErrors: 1, Interval: "soon"}, wantErr: true},
+		{name: "invalid ejection percent", breaker: circuitBreaker{Host: "httpbin", MaxEjectionPercent: 120}, wantErr: true},
+		{name: "valid", breaker: circuitBreaker{Host: "httpbin", MaxConnections: 1}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.breaker.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("circuitBreaker.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFortioResult(t *testing.T) {
+	out := `Fortio 1.63.0 running at 0 queries per second
+{
+  "RunType": "HTTP",
+  "RetCodes": {
+    "200": 17,
+    "503": 13
+  }
+}`
+	result, err := parseFortioResult(out)
+	if err != nil {
+		t.Fatalf("parseFortioResult() error = %v", err)
+	}
+	result.Overflow = pendingOverflow(`cluster.outbound|8000||httpbin.default.svc.cluster.local.upstream_rq_pending_overflow: 12
+cluster.outbound|8000||httpbin.default.svc.cluster.local.upstream_rq_pending_total: 30
+cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_rq_pending_overflow: 4`, "httpbin")
+
+	want := "fortio sent 30 requests to httpbin (200: 17, 503: 13), 503 rate 43.3%, 12 requests overflowed the connection pool"
+	if got := result.String(); got != want {
+		t.Errorf("loadTestResult.String() = %v, want %v", got, want)
+	}
+}
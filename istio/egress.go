@@ -0,0 +1,579 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Scopes of the egress lockdown
+const (
+	EgressScopeMesh      = "mesh"
+	EgressScopeNamespace = "namespace"
+
+	outboundRegistryOnly = "REGISTRY_ONLY"
+	outboundAllowAny     = "ALLOW_ANY"
+
+	// egressLockdownSidecar is the name of the namespace-wide Sidecar
+	// restricting the outbound traffic
+	egressLockdownSidecar = "default"
+	// egressLockdownLabel marks the Sidecars carrying the egress lockdown,
+	// which are the ones lifted by the delete operation
+	egressLockdownLabel = "meshery.io/egress-lockdown"
+	// egressLockdownAnnotation records on the mesh config map the outbound
+	// traffic policy of the mesh before the lockdown, so that it can be
+	// restored
+	egressLockdownAnnotation = "meshery.io/egress-lockdown"
+
+	egressGatewayService   = "istio-egressgateway"
+	egressGatewayNamespace = "istio-system"
+)
+
+var sidecarGVR = virtualServiceGVR.GroupVersion().WithResource("sidecars")
+
+// serviceEntryProtocols are the protocols of the ports of a ServiceEntry,
+// with the ones which can be routed through the egress gateway
+var serviceEntryProtocols = map[string]bool{
+	"HTTP":  true,
+	"HTTPS": true,
+	"TLS":   true,
+	"HTTP2": false,
+	"GRPC":  false,
+	"TCP":   false,
+	"MONGO": false,
+}
+
+// egressLockdown are the parameters of the egress lockdown operation
+type egressLockdown struct {
+	// Scope is mesh, through the mesh config, or namespace, through a
+	// Sidecar in each of the namespaces
+	Scope string `yaml:"scope"`
+	// Namespaces locked down, the namespace of the operation when empty
+	Namespaces []string `yaml:"namespaces,omitempty"`
+}
+
+func defaultEgressLockdown() egressLockdown {
+	return egressLockdown{
+		Scope: EgressScopeMesh,
+	}
+}
+
+func (l egressLockdown) validate() error {
+	switch l.Scope {
+	case EgressScopeMesh:
+		if len(l.Namespaces) > 0 {
+			return ErrEgress(fmt.Errorf("namespaces only apply to the %s scope", EgressScopeNamespace))
+		}
+	case EgressScopeNamespace:
+		if len(l.Namespaces) == 0 {
+			return ErrEgress(fmt.Errorf("at least one namespace is required"))
+		}
+	default:
+		return ErrEgress(fmt.Errorf("invalid scope %s, use %s or %s", l.Scope, EgressScopeMesh, EgressScopeNamespace))
+	}
+	return nil
+}
+
+// sidecar returns the Sidecar restricting the outbound traffic of the
+// workloads of the namespace to the services of the registry
+func (l egressLockdown) sidecar(namespace string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       "Sidecar",
+		"metadata": map[string]interface{}{
+			"name":      egressLockdownSidecar,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{egressLockdownLabel: "true"},
+		},
+		"spec": map[string]interface{}{
+			"egress": []interface{}{
+				map[string]interface{}{"hosts": []string{"*/*"}},
+			},
+			"outboundTrafficPolicy": map[string]interface{}{"mode": outboundRegistryOnly},
+		},
+	}
+}
+
+// lockDownEgress restricts the outbound traffic of the mesh, or of the
+// namespaces, to the services of the registry, or lifts the restriction
+func (istio *Istio) lockDownEgress(namespace string, del bool, lockdown egressLockdown, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if lockdown.Scope == EgressScopeNamespace && len(lockdown.Namespaces) == 0 && namespace != "" {
+		lockdown.Namespaces = []string{namespace}
+	}
+	if err := lockdown.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.lockDownEgressOnSingleCluster(del, lockdown, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrEgress(mergeErrors(errs))
+}
+
+func (istio *Istio) lockDownEgressOnSingleCluster(del bool, lockdown egressLockdown, mclient *mesherykube.Client) ([]string, error) {
+	if lockdown.Scope == EgressScopeMesh {
+		return lockDownMeshEgress(del, mclient)
+	}
+
+	var msgs []string
+	for _, ns := range lockdown.Namespaces {
+		// a namespace has at most one Sidecar without workload selector
+		existing, err := namespaceSidecar(mclient, ns)
+		if err != nil {
+			return msgs, err
+		}
+		nsMsg, err := istio.lockDownNamespaceEgress(ns, del, lockdown, existing, mclient)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, nsMsg)
+	}
+	return msgs, nil
+}
+
+// lockDownMeshEgress sets the outbound traffic policy of the mesh to
+// REGISTRY_ONLY, recording the previous one, or restores it
+func lockDownMeshEgress(del bool, mclient *mesherykube.Client) ([]string, error) {
+	msg := fmt.Sprintf("outbound traffic policy of the mesh set to %s", outboundRegistryOnly)
+	err := updateRecordedMeshConfig(mclient, func(mesh meshConfig, annotations map[string]string) error {
+		raw, recorded := annotations[egressLockdownAnnotation]
+		if !del {
+			if !recorded {
+				byt, err := json.Marshal(newFieldsRecord(mesh, "outboundTrafficPolicy"))
+				if err != nil {
+					return err
+				}
+				annotations[egressLockdownAnnotation] = string(byt)
+			}
+			mesh["outboundTrafficPolicy"] = map[string]interface{}{"mode": outboundRegistryOnly}
+			return nil
+		}
+		if !recorded {
+			return fmt.Errorf("the outbound traffic policy of the mesh was not set by the egress lockdown")
+		}
+		record := fieldsRecord{}
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			return err
+		}
+		if err := record.restore(mesh); err != nil {
+			return err
+		}
+		delete(annotations, egressLockdownAnnotation)
+		mode, _, _ := unstructured.NestedString(mesh, "outboundTrafficPolicy", "mode")
+		if mode == "" {
+			mode = outboundAllowAny
+		}
+		msg = fmt.Sprintf("outbound traffic policy of the mesh restored to %s", mode)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []string{msg}, nil
+}
+
+// lockDownNamespaceEgress applies the egress lockdown Sidecar to the
+// namespace, or deletes it. A namespace-wide Sidecar generated by the
+// adapter carries the lockdown itself; one of the user is left untouched.
+func (istio *Istio) lockDownNamespaceEgress(ns string, del bool, lockdown egressLockdown, existing *unstructured.Unstructured, mclient *mesherykube.Client) (string, error) {
+	client := mclient.DynamicKubeClient.Resource(sidecarGVR).Namespace(ns)
+	owned := existing != nil && existing.GetLabels()[egressLockdownLabel] == "true"
+	generated := existing != nil && existing.GetLabels()[generatedSidecarLabel] == "true"
+
+	switch {
+	case del && !owned:
+		return "", fmt.Errorf("the namespace %s has no Sidecar created by the egress lockdown", ns)
+	case del && generated:
+		unstructured.RemoveNestedField(existing.Object, "spec", "outboundTrafficPolicy")
+		labels := existing.GetLabels()
+		delete(labels, egressLockdownLabel)
+		existing.SetLabels(labels)
+		if _, err := client.Update(context.TODO(), existing, metav1.UpdateOptions{}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("egress lockdown removed from the generated Sidecar %s/%s, the namespace follows the outbound traffic policy of the mesh", ns, existing.GetName()), nil
+	case del:
+		if err := client.Delete(context.TODO(), existing.GetName(), metav1.DeleteOptions{}); err != nil && !kubeerror.IsNotFound(err) {
+			return "", err
+		}
+		return fmt.Sprintf("Sidecar %s/%s deleted, the namespace follows the outbound traffic policy of the mesh", ns, existing.GetName()), nil
+	case owned:
+		return fmt.Sprintf("Sidecar %s/%s already locks down the egress of the namespace", ns, existing.GetName()), nil
+	case generated:
+		if err := unstructured.SetNestedMap(existing.Object, map[string]interface{}{"mode": outboundRegistryOnly}, "spec", "outboundTrafficPolicy"); err != nil {
+			return "", err
+		}
+		labels := existing.GetLabels()
+		labels[egressLockdownLabel] = "true"
+		existing.SetLabels(labels)
+		if _, err := client.Update(context.TODO(), existing, metav1.UpdateOptions{}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("egress lockdown added to the generated Sidecar %s/%s, the workloads of the namespace only reach the services of the registry", ns, existing.GetName()), nil
+	case existing != nil:
+		return "", fmt.Errorf("the namespace %s already has the Sidecar %s without workload selector, set its outboundTrafficPolicy to %s instead", ns, existing.GetName(), outboundRegistryOnly)
+	}
+
+	manifest, err := yaml.Marshal(lockdown.sidecar(ns))
+	if err != nil {
+		return "", err
+	}
+	if err := istio.applyManifestOnSingleCluster(manifest, false, ns, mclient); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Sidecar %s/%s applied, the workloads of the namespace only reach the services of the registry", ns, egressLockdownSidecar), nil
+}
+
+// namespaceSidecar returns the Sidecar of the namespace which has no
+// workload selector, if any
+func namespaceSidecar(mclient *mesherykube.Client, namespace string) (*unstructured.Unstructured, error) {
+	list, err := mclient.DynamicKubeClient.Resource(sidecarGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		if _, ok, _ := unstructured.NestedMap(list.Items[i].Object, "spec", "workloadSelector"); !ok {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// externalService is a port of a host outside the mesh
+type externalService struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Protocol string `yaml:"protocol"`
+}
+
+// serviceEntries are the parameters of the ServiceEntry operation
+type serviceEntries struct {
+	Services []externalService `yaml:"services"`
+	// EgressGateway routes the traffic to the services through the egress
+	// gateway of the demo profile
+	EgressGateway bool `yaml:"egressGateway"`
+}
+
+func defaultServiceEntries() serviceEntries {
+	return serviceEntries{}
+}
+
+func (s serviceEntries) validate() error {
+	if len(s.Services) == 0 {
+		return ErrEgress(fmt.Errorf("at least one service is required"))
+	}
+	for _, svc := range s.Services {
+		if svc.Host == "" || strings.Contains(svc.Host, "*") {
+			return ErrEgress(fmt.Errorf("invalid host %q, wildcard hosts are not supported", svc.Host))
+		}
+		if svc.Port <= 0 || svc.Port > 65535 {
+			return ErrEgress(fmt.Errorf("invalid port %d for %s", svc.Port, svc.Host))
+		}
+		routable, ok := serviceEntryProtocols[strings.ToUpper(svc.Protocol)]
+		if !ok {
+			return ErrEgress(fmt.Errorf("invalid protocol %s for %s", svc.Protocol, svc.Host))
+		}
+		if s.EgressGateway && !routable {
+			return ErrEgress(fmt.Errorf("the %s traffic to %s cannot be routed through the egress gateway, use HTTP, HTTPS or TLS", svc.Protocol, svc.Host))
+		}
+	}
+	if s.EgressGateway {
+		// the egress gateway only listens on one port for HTTP and one for
+		// TLS, so a host can only be reached on one port of each
+		for host, ports := range s.hosts() {
+			byGatewayPort := map[int]int{}
+			for _, p := range ports {
+				gatewayPort, _ := egressGatewayPort(p.Protocol)
+				if other, ok := byGatewayPort[gatewayPort]; ok {
+					return ErrEgress(fmt.Errorf("ports %d and %d of %s would both be routed through port %d of the egress gateway, route only one of them through the gateway", other, p.Port, host, gatewayPort))
+				}
+				byGatewayPort[gatewayPort] = p.Port
+			}
+		}
+	}
+	return nil
+}
+
+// hosts returns the ports of each host
+func (s serviceEntries) hosts() map[string][]externalService {
+	hosts := map[string][]externalService{}
+	for _, svc := range s.Services {
+		svc.Protocol = strings.ToUpper(svc.Protocol)
+		hosts[svc.Host] = append(hosts[svc.Host], svc)
+	}
+	return hosts
+}
+
+// egressResourceName returns the name of the resources generated for the
+// host, e.g. api-github-com for api.github.com
+func egressResourceName(host string) string {
+	return strings.ReplaceAll(strings.ToLower(host), ".", "-")
+}
+
+// serviceEntry returns the ServiceEntry registering the ports of the host
+func serviceEntry(namespace, host string, ports []externalService) map[string]interface{} {
+	var specPorts []interface{}
+	for _, p := range ports {
+		specPorts = append(specPorts, map[string]interface{}{
+			"number":   p.Port,
+			"name":     fmt.Sprintf("%s-%d", strings.ToLower(p.Protocol), p.Port),
+			"protocol": p.Protocol,
+		})
+	}
+	return map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       "ServiceEntry",
+		"metadata": map[string]interface{}{
+			"name":      egressResourceName(host),
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"hosts":      []string{host},
+			"ports":      specPorts,
+			"location":   "MESH_EXTERNAL",
+			"resolution": "DNS",
+		},
+	}
+}
+
+// egressGatewayPort returns the port of the egress gateway receiving the
+// traffic of the protocol, and whether it is passed through as TLS
+func egressGatewayPort(protocol string) (int, bool) {
+	if protocol == "HTTP" {
+		return 80, false
+	}
+	return 443, true
+}
+
+// egressGatewayResources returns the Gateway, DestinationRule and
+// VirtualService sending the traffic to the host from the sidecars to the
+// egress gateway, and from the egress gateway to the host
+func egressGatewayResources(namespace, host string, ports []externalService) []map[string]interface{} {
+	name := egressResourceName(host)
+	gatewayHost := fmt.Sprintf("%s.%s.svc.cluster.local", egressGatewayService, egressGatewayNamespace)
+
+	var servers, httpRoutes, tlsRoutes []interface{}
+	for _, p := range ports {
+		gatewayPort, passthrough := egressGatewayPort(p.Protocol)
+		server := map[string]interface{}{
+			"port":  map[string]interface{}{"number": gatewayPort, "name": fmt.Sprintf("%s-%d", strings.ToLower(p.Protocol), p.Port), "protocol": "HTTP"},
+			"hosts": []string{host},
+		}
+		toGateway := map[string]interface{}{"destination": map[string]interface{}{"host": gatewayHost, "subset": name, "port": map[string]interface{}{"number": gatewayPort}}}
+		toHost := map[string]interface{}{"destination": map[string]interface{}{"host": host, "port": map[string]interface{}{"number": p.Port}}}
+		if passthrough {
+			server["port"].(map[string]interface{})["protocol"] = "TLS"
+			server["tls"] = map[string]interface{}{"mode": "PASSTHROUGH"}
+			tlsRoutes = append(tlsRoutes,
+				map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{"gateways": []string{"mesh"}, "port": p.Port, "sniHosts": []string{host}}},
+					"route": []interface{}{toGateway},
+				},
+				map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{"gateways": []string{name + "-egress"}, "port": gatewayPort, "sniHosts": []string{host}}},
+					"route": []interface{}{toHost},
+				},
+			)
+		} else {
+			httpRoutes = append(httpRoutes,
+				map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{"gateways": []string{"mesh"}, "port": p.Port}},
+					"route": []interface{}{toGateway},
+				},
+				map[string]interface{}{
+					"match": []interface{}{map[string]interface{}{"gateways": []string{name + "-egress"}, "port": gatewayPort}},
+					"route": []interface{}{toHost},
+				},
+			)
+		}
+		servers = append(servers, server)
+	}
+
+	metadata := map[string]interface{}{"name": name + "-egress", "namespace": namespace}
+	virtualService := map[string]interface{}{
+		"hosts":    []string{host},
+		"gateways": []string{"mesh", name + "-egress"},
+	}
+	if len(httpRoutes) > 0 {
+		virtualService["http"] = httpRoutes
+	}
+	if len(tlsRoutes) > 0 {
+		virtualService["tls"] = tlsRoutes
+	}
+	return []map[string]interface{}{
+		{
+			"apiVersion": networkingAPIVersion,
+			"kind":       "Gateway",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{
+				"selector": map[string]string{"istio": "egressgateway"},
+				"servers":  servers,
+			},
+		},
+		{
+			"apiVersion": networkingAPIVersion,
+			"kind":       "DestinationRule",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{
+				"host":    gatewayHost,
+				"subsets": []interface{}{map[string]interface{}{"name": name}},
+			},
+		},
+		{
+			"apiVersion": networkingAPIVersion,
+			"kind":       "VirtualService",
+			"metadata":   metadata,
+			"spec":       virtualService,
+		},
+	}
+}
+
+// configureServiceEntries registers the external services in the mesh, and
+// routes their traffic through the egress gateway when asked
+func (istio *Istio) configureServiceEntries(namespace string, del bool, entries serviceEntries, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := entries.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureServiceEntriesOnSingleCluster(namespace, del, entries, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrEgress(mergeErrors(errs))
+}
+
+func (istio *Istio) configureServiceEntriesOnSingleCluster(namespace string, del bool, entries serviceEntries, mclient *mesherykube.Client) ([]string, error) {
+	var version minorVersion
+	if !del {
+		var err error
+		if version, err = controlPlaneVersion(mclient); err != nil {
+			return nil, err
+		}
+		if entries.EgressGateway {
+			_, err := mclient.KubeClient.CoreV1().Services(egressGatewayNamespace).Get(context.TODO(), egressGatewayService, metav1.GetOptions{})
+			if kubeerror.IsNotFound(err) {
+				return nil, fmt.Errorf("the egress gateway %s/%s is not installed, install Istio with the demo profile", egressGatewayNamespace, egressGatewayService)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hosts := entries.hosts()
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+
+	var msgs []string
+	for _, host := range names {
+		resources := []map[string]interface{}{serviceEntry(namespace, host, hosts[host])}
+		// the routing is removed along with the entry in case it was
+		// applied before
+		if entries.EgressGateway || del {
+			resources = append(resources, egressGatewayResources(namespace, host, hosts[host])...)
+		}
+		for _, resource := range resources {
+			if !del {
+				if err := validateAgainstMeshmodel(resource["kind"].(string), version, resource); err != nil {
+					return msgs, err
+				}
+			}
+			manifest, err := yaml.Marshal(resource)
+			if err != nil {
+				return msgs, err
+			}
+			if err := istio.applyManifestOnSingleCluster(manifest, del, namespace, mclient); err != nil {
+				return msgs, err
+			}
+		}
+		switch {
+		case del:
+			msgs = append(msgs, fmt.Sprintf("ServiceEntry %s/%s for %s deleted", namespace, egressResourceName(host), host))
+		case entries.EgressGateway:
+			msgs = append(msgs, fmt.Sprintf("ServiceEntry %s/%s applied for %s, routed through the egress gateway", namespace, egressResourceName(host), host))
+		default:
+			msgs = append(msgs, fmt.Sprintf("ServiceEntry %s/%s applied for %s", namespace, egressResourceName(host), host))
+		}
+	}
+	return msgs, nil
+}
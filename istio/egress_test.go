@@ -0,0 +1,148 @@
+package istio
+
+import (
+	"testing"
+)
+
+func TestEgressLockdown_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name: "mesh by default",
+		},
+		{
+			name:   "namespaces",
+			params: "{scope: namespace, namespaces: [bookinfo, shop]}",
+		},
+		{
+			name:    "mesh with namespaces",
+			params:  "{namespaces: [bookinfo]}",
+			wantErr: true,
+		},
+		{
+			name:    "namespace scope without namespace",
+			params:  "{scope: namespace}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid scope",
+			params:  "{scope: workload}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockdown := defaultEgressLockdown()
+			if err := parseOperationParams(tt.params, &lockdown); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := lockdown.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("egressLockdown.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceEntries_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "registered only",
+			params: "{services: [{host: api.github.com, port: 443, protocol: https}, {host: db.example.com, port: 5432, protocol: TCP}]}",
+		},
+		{
+			name:   "through the egress gateway",
+			params: "{egressGateway: true, services: [{host: httpbin.org, port: 80, protocol: HTTP}, {host: httpbin.org, port: 443, protocol: TLS}]}",
+		},
+		{
+			name:    "no service",
+			params:  "",
+			wantErr: true,
+		},
+		{
+			name:    "wildcard host",
+			params:  "{services: [{host: '*.github.com', port: 443, protocol: HTTPS}]}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			params:  "{services: [{host: api.github.com, port: 70000, protocol: HTTPS}]}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid protocol",
+			params:  "{services: [{host: api.github.com, port: 443, protocol: QUIC}]}",
+			wantErr: true,
+		},
+		{
+			name:   "two TLS ports registered only",
+			params: "{services: [{host: api.example.com, port: 443, protocol: TLS}, {host: api.example.com, port: 8443, protocol: TLS}]}",
+		},
+		{
+			name:    "two TLS ports through the egress gateway",
+			params:  "{egressGateway: true, services: [{host: api.example.com, port: 443, protocol: TLS}, {host: api.example.com, port: 8443, protocol: TLS}]}",
+			wantErr: true,
+		},
+		{
+			name:    "HTTPS and TLS ports through the egress gateway",
+			params:  "{egressGateway: true, services: [{host: api.example.com, port: 443, protocol: HTTPS}, {host: api.example.com, port: 8443, protocol: tls}]}",
+			wantErr: true,
+		},
+		{
+			name:    "TCP through the egress gateway",
+			params:  "{egressGateway: true, services: [{host: db.example.com, port: 5432, protocol: TCP}]}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := defaultServiceEntries()
+			if err := parseOperationParams(tt.params, &entries); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := entries.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("serviceEntries.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEgressResources(t *testing.T) {
+	entries := defaultServiceEntries()
+	if err := parseOperationParams("{egressGateway: true, services: [{host: httpbin.org, port: 80, protocol: http}, {host: httpbin.org, port: 443, protocol: tls}]}", &entries); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	hosts := entries.hosts()
+	if len(hosts) != 1 || len(hosts["httpbin.org"]) != 2 {
+		t.Fatalf("hosts() = %v, want the two ports of httpbin.org", hosts)
+	}
+
+	resources := append([]map[string]interface{}{
+		serviceEntry("default", "httpbin.org", hosts["httpbin.org"]),
+		defaultEgressLockdown().sidecar("default"),
+	}, egressGatewayResources("default", "httpbin.org", hosts["httpbin.org"])...)
+	for _, version := range []minorVersion{{Major: 1, Minor: 17}, {Major: 1, Minor: 22}} {
+		for _, resource := range resources {
+			if err := validateAgainstMeshmodel(resource["kind"].(string), version, resource); err != nil {
+				t.Errorf("%s invalid for %s: %v", resource["kind"], version, err)
+			}
+		}
+	}
+
+	if name := resources[0]["metadata"].(map[string]interface{})["name"]; name != "httpbin-org" {
+		t.Errorf("ServiceEntry name = %v, want httpbin-org", name)
+	}
+	vs := resources[4]["spec"].(map[string]interface{})
+	if http, _ := vs["http"].([]interface{}); len(http) != 2 {
+		t.Errorf("http routes = %v, want one from the sidecars and one from the gateway", vs["http"])
+	}
+	if tls, _ := vs["tls"].([]interface{}); len(tls) != 2 {
+		t.Errorf("tls routes = %v, want one from the sidecars and one from the gateway", vs["tls"])
+	}
+}
@@ -0,0 +1,313 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	config "github.com/layer5io/meshery-istio/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Envoy admin resources which can be retrieved
+const (
+	EnvoyConfigDump = "config_dump"
+	EnvoyClusters   = "clusters"
+	EnvoyListeners  = "listeners"
+	EnvoyRoutes     = "routes"
+	EnvoyStats      = "stats"
+
+	// Ways to reach the admin API of the proxy
+	EnvoyAdminPortForward = "port-forward"
+	EnvoyAdminExec        = "exec"
+
+	// Destinations of the retrieved resources
+	EnvoyDumpOutputEvent = "event"
+	EnvoyDumpOutputFile  = "file"
+
+	envoyAdminPort    = 15000
+	envoyAdminTimeout = 30 * time.Second
+	envoyDumpDir      = "envoy"
+)
+
+// envoyDump are the parameters of the Envoy admin operation
+type envoyDump struct {
+	// Pod to query, every pod matching the selector when empty
+	Pod      string            `yaml:"pod,omitempty"`
+	Selector map[string]string `yaml:"selector,omitempty"`
+	Resource string            `yaml:"resource"`
+	Method   string            `yaml:"method"`
+	// Type restricts a config_dump to one of its sections, e.g.
+	// dynamic_active_clusters or dynamic_listeners
+	Type string `yaml:"type,omitempty"`
+	// Name is a regular expression on the names of the resources, or of
+	// the stats
+	Name   string `yaml:"name,omitempty"`
+	Output string `yaml:"output"`
+}
+
+func defaultEnvoyDump() envoyDump {
+	return envoyDump{
+		Resource: EnvoyConfigDump,
+		Method:   EnvoyAdminPortForward,
+		Output:   EnvoyDumpOutputEvent,
+	}
+}
+
+func (d envoyDump) validate() error {
+	if d.Pod == "" && len(d.Selector) == 0 {
+		return ErrEnvoyAdmin(fmt.Errorf("either a pod or a selector is required"))
+	}
+	switch d.Resource {
+	case EnvoyConfigDump:
+	case EnvoyClusters, EnvoyListeners, EnvoyRoutes, EnvoyStats:
+		if d.Type != "" {
+			return ErrEnvoyAdmin(fmt.Errorf("type only applies to %s", EnvoyConfigDump))
+		}
+	default:
+		return ErrEnvoyAdmin(fmt.Errorf("invalid resource %s, use %s", d.Resource, strings.Join([]string{EnvoyConfigDump, EnvoyClusters, EnvoyListeners, EnvoyRoutes, EnvoyStats}, ", ")))
+	}
+	if d.Method != EnvoyAdminPortForward && d.Method != EnvoyAdminExec {
+		return ErrEnvoyAdmin(fmt.Errorf("invalid method %s, use %s or %s", d.Method, EnvoyAdminPortForward, EnvoyAdminExec))
+	}
+	if d.Output != EnvoyDumpOutputEvent && d.Output != EnvoyDumpOutputFile {
+		return ErrEnvoyAdmin(fmt.Errorf("invalid output %s, use %s or %s", d.Output, EnvoyDumpOutputEvent, EnvoyDumpOutputFile))
+	}
+	if _, err := regexp.Compile(d.Name); err != nil {
+		return ErrEnvoyAdmin(fmt.Errorf("invalid name expression: %w", err))
+	}
+	return nil
+}
+
+// adminPath returns the path, with its query, of the admin endpoint
+// serving the resource. Envoy filters config dumps and stats itself, there
+// is no routes endpoint so they are read from the config dump.
+func (d envoyDump) adminPath() string {
+	query := url.Values{}
+	endpoint := d.Resource
+	switch d.Resource {
+	case EnvoyConfigDump, EnvoyRoutes:
+		endpoint = EnvoyConfigDump
+		if d.Resource == EnvoyRoutes {
+			query.Set("resource", "dynamic_route_configs")
+		} else if d.Type != "" {
+			query.Set("resource", d.Type)
+		}
+		if d.Name != "" {
+			query.Set("name_regex", d.Name)
+		}
+	case EnvoyStats:
+		query.Set("format", "json")
+		if d.Name != "" {
+			query.Set("filter", d.Name)
+		}
+	default:
+		query.Set("format", "json")
+	}
+	if len(query) == 0 {
+		return "/" + endpoint
+	}
+	return fmt.Sprintf("/%s?%s", endpoint, query.Encode())
+}
+
+// filter keeps the clusters or listeners whose name matches, the other
+// resources being filtered by Envoy
+func (d envoyDump) filter(body []byte) (json.RawMessage, error) {
+	field := map[string]string{
+		EnvoyClusters:  "cluster_statuses",
+		EnvoyListeners: "listener_statuses",
+	}[d.Resource]
+	if field == "" || d.Name == "" {
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("the proxy did not return JSON: %.200s", body)
+		}
+		return json.RawMessage(body), nil
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("the proxy did not return JSON: %w", err)
+	}
+	name := regexp.MustCompile(d.Name)
+	var kept []interface{}
+	items, _ := out[field].([]interface{})
+	for _, item := range items {
+		if n, _ := item.(map[string]interface{})["name"].(string); name.MatchString(n) {
+			kept = append(kept, item)
+		}
+	}
+	out[field] = kept
+	return json.Marshal(out)
+}
+
+// dumpEnvoyConfig retrieves the resource from the admin API of the proxies
+// of the selected pods, and either returns it as a JSON object keyed by
+// cluster/namespace/pod or saves it under the config root and returns the
+// files. The pods which could not be reached are reported as warnings, the
+// operation only fails when no proxy answered.
+func (istio *Istio) dumpEnvoyConfig(namespace string, dump envoyDump, kubeconfigs []string) (string, []string, error) {
+	st := status.Running
+
+	if err := dump.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	dumps := map[string]json.RawMessage{}
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			cluster := clusterName([]byte(k8sconfig))
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", cluster, err))
+				mx.Unlock()
+				return
+			}
+			clusterDumps, clusterErrs := dumpEnvoyConfigOnSingleCluster(namespace, dump, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			for pod, d := range clusterDumps {
+				dumps[cluster+"/"+pod] = d
+			}
+			for _, err := range clusterErrs {
+				errs = append(errs, fmt.Errorf("%s/%w", cluster, err))
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(dumps) == 0 {
+		return st, nil, ErrEnvoyAdmin(mergeErrors(errs))
+	}
+	warnings := make([]string, 0, len(errs))
+	for _, err := range errs {
+		warnings = append(warnings, fmt.Sprintf("warning: %s", err))
+	}
+	sort.Strings(warnings)
+
+	if dump.Output == EnvoyDumpOutputFile {
+		files, err := saveEnvoyDumps(path.Join(config.RootPath(), envoyDumpDir), dump.Resource, dumps)
+		if err != nil {
+			return st, files, ErrEnvoyAdmin(err)
+		}
+		return status.Completed, append(files, warnings...), nil
+	}
+	byt, err := json.MarshalIndent(dumps, "", "  ")
+	if err != nil {
+		return st, nil, ErrEnvoyAdmin(err)
+	}
+	return status.Completed, append([]string{string(byt)}, warnings...), nil
+}
+
+// dumpEnvoyConfigOnSingleCluster returns the dumps of the pods keyed by
+// namespace/pod, along with the error of each pod which could not be dumped
+func dumpEnvoyConfigOnSingleCluster(namespace string, dump envoyDump, mclient *mesherykube.Client) (map[string]json.RawMessage, []error) {
+	pods := []string{dump.Pod}
+	if dump.Pod == "" {
+		list, err := mclient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(dump.Selector).String(),
+		})
+		if err != nil {
+			return nil, []error{fmt.Errorf("%s: %w", namespace, err)}
+		}
+		pods = nil
+		for _, pod := range list.Items {
+			if hasSidecar(pod) {
+				pods = append(pods, pod.Name)
+			}
+		}
+		if len(pods) == 0 {
+			return nil, []error{fmt.Errorf("%s: no pod with a proxy matches %s", namespace, labels.SelectorFromSet(dump.Selector))}
+		}
+	}
+
+	dumps := map[string]json.RawMessage{}
+	var errs []error
+	for _, pod := range pods {
+		body, err := envoyAdminGet(mclient, namespace, pod, dump.Method, dump.adminPath())
+		if err == nil {
+			var filtered json.RawMessage
+			if filtered, err = dump.filter(body); err == nil {
+				dumps[namespace+"/"+pod] = filtered
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", namespace, pod, err))
+		}
+	}
+	return dumps, errs
+}
+
+// envoyAdminGet sends a GET request to the admin API of the proxy of the
+// pod, either through a port-forward or with pilot-agent in the proxy
+func envoyAdminGet(mclient *mesherykube.Client, namespace, pod, method, adminPath string) ([]byte, error) {
+	if method == EnvoyAdminExec {
+		out, err := execInPod(mclient, namespace, pod, sidecarContainerName, []string{"pilot-agent", "request", "GET", strings.TrimPrefix(adminPath, "/")})
+		return []byte(out), err
+	}
+
+	var body []byte
+	err := withPortForward(mclient, namespace, pod, envoyAdminPort, func(localPort uint16) error {
+		client := &http.Client{Timeout: envoyAdminTimeout}
+		resp, err := client.Get(fmt.Sprintf("http://localhost:%d%s", localPort, adminPath))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s: %.200s", adminPath, resp.Status, body)
+		}
+		return nil
+	})
+	return body, err
+}
+
+// invalidFileNameChars are replaced in the cluster/namespace/pod keys of the
+// dumps to name their files
+var invalidFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// saveEnvoyDumps writes each dump to its own file in the directory and
+// returns the paths of the files
+func saveEnvoyDumps(dir, resource string, dumps map[string]json.RawMessage) ([]string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().UTC().Format("20060102T150405Z")
+	pods := make([]string, 0, len(dumps))
+	for pod := range dumps {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+
+	var files []string
+	for _, pod := range pods {
+		name := fmt.Sprintf("%s_%s_%s.json", invalidFileNameChars.ReplaceAllString(pod, "_"), resource, timestamp)
+		file := path.Join(dir, name)
+		if err := os.WriteFile(file, dumps[pod], 0600); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
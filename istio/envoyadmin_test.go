@@ -0,0 +1,107 @@
+package istio
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvoyDump_adminPath(t *testing.T) {
+	tests := []struct {
+		name string
+		dump envoyDump
+		want string
+	}{
+		{name: "full config dump", dump: envoyDump{Resource: EnvoyConfigDump}, want: "/config_dump"},
+		{name: "config dump section", dump: envoyDump{Resource: EnvoyConfigDump, Type: "dynamic_active_clusters", Name: "reviews"}, want: "/config_dump?name_regex=reviews&resource=dynamic_active_clusters"},
+		{name: "routes", dump: envoyDump{Resource: EnvoyRoutes, Name: "9080"}, want: "/config_dump?name_regex=9080&resource=dynamic_route_configs"},
+		{name: "clusters", dump: envoyDump{Resource: EnvoyClusters, Name: "reviews"}, want: "/clusters?format=json"},
+		{name: "listeners", dump: envoyDump{Resource: EnvoyListeners}, want: "/listeners?format=json"},
+		{name: "stats", dump: envoyDump{Resource: EnvoyStats, Name: "upstream_rq_5xx"}, want: "/stats?filter=upstream_rq_5xx&format=json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dump.adminPath(); got != tt.want {
+				t.Errorf("envoyDump.adminPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvoyDump_filter(t *testing.T) {
+	body := []byte(`{"cluster_statuses": [{"name": "outbound|9080|v1|reviews.bookinfo.svc.cluster.local"}, {"name": "outbound|9080||ratings.bookinfo.svc.cluster.local"}, {"name": "BlackHoleCluster"}]}`)
+	dump := envoyDump{Resource: EnvoyClusters, Name: "reviews|ratings"}
+	got, err := dump.filter(body)
+	if err != nil {
+		t.Fatalf("envoyDump.filter() error = %v", err)
+	}
+	var out struct {
+		Clusters []struct {
+			Name string `json:"name"`
+		} `json:"cluster_statuses"`
+	}
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatalf("envoyDump.filter() returned invalid JSON: %v", err)
+	}
+	if len(out.Clusters) != 2 {
+		t.Errorf("envoyDump.filter() kept %v, want reviews and ratings", out.Clusters)
+	}
+
+	if _, err := (envoyDump{Resource: EnvoyConfigDump}).filter([]byte("upstream connect error")); err == nil {
+		t.Errorf("envoyDump.filter() accepted a response which is not JSON")
+	}
+}
+
+func TestEnvoyDump_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{name: "pod", params: "{pod: productpage-v1-6b746f74dc-8xx2s}", wantErr: false},
+		{name: "selector to file with exec", params: "{selector: {app: reviews}, resource: clusters, method: exec, output: file}", wantErr: false},
+		{name: "no pod", params: "{resource: stats}", wantErr: true},
+		{name: "type of clusters", params: "{pod: p, resource: clusters, type: static_clusters}", wantErr: true},
+		{name: "invalid method", params: "{pod: p, method: ssh}", wantErr: true},
+		{name: "invalid name", params: "{pod: p, name: '(reviews'}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dump := defaultEnvoyDump()
+			if err := parseOperationParams(tt.params, &dump); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := dump.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("envoyDump.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveEnvoyDumps(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), envoyDumpDir)
+	dumps := map[string]json.RawMessage{
+		"east/bookinfo/reviews-v1":                          json.RawMessage(`{"configs": []}`),
+		"east/bookinfo/reviews-v2":                          json.RawMessage(`{"configs": []}`),
+		"https://west.example.com:6443/bookinfo/reviews-v1": json.RawMessage(`{"configs": []}`),
+	}
+	files, err := saveEnvoyDumps(dir, EnvoyConfigDump, dumps)
+	if err != nil {
+		t.Fatalf("saveEnvoyDumps() error = %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("saveEnvoyDumps() = %v, want 3 files", files)
+	}
+	if !strings.HasPrefix(filepath.Base(files[0]), "east_bookinfo_reviews-v1_") || !strings.HasPrefix(filepath.Base(files[2]), "https_west.example.com_6443_bookinfo_reviews-v1_") {
+		t.Errorf("saveEnvoyDumps() = %v, want files prefixed with the cluster", files)
+	}
+	byt, err := os.ReadFile(files[0])
+	if err != nil || string(byt) != `{"configs": []}` {
+		t.Errorf("%s = %s, %v", files[0], byt, err)
+	}
+	if filepath.Dir(files[0]) != dir {
+		t.Errorf("%s not saved in %s", files[0], dir)
+	}
+}
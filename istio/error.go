@@ -2,6 +2,9 @@
 package istio
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/layer5io/meshkit/errors"
 )
 
@@ -126,6 +129,106 @@ var (
 	// ErrLoadNamespaceCode implies error while finding namespace
 	ErrFetchIstioVersionsCode = "1033"
 
+	// ErrInvalidOperationParamsCode represents the errors which are generated
+	// when the parameters passed to an operation cannot be decoded
+	ErrInvalidOperationParamsCode = "1034"
+
+	// ErrRenderTemplateCode represents the errors which are generated
+	// while rendering a parameterized template
+	ErrRenderTemplateCode = "1035"
+
+	// ErrAddonExposureCode represents the errors which are generated
+	// while exposing an addon outside the cluster
+	ErrAddonExposureCode = "1036"
+
+	// ErrWorkloadsNotReadyCode represents the errors which are generated
+	// when workloads do not become ready in time
+	ErrWorkloadsNotReadyCode = "1037"
+
+	// ErrMissingCRDCode represents the errors which are generated
+	// when a manifest uses kinds which are not served by the cluster
+	ErrMissingCRDCode = "1038"
+
+	// ErrObservabilityBackendCode represents the errors which are generated
+	// while wiring the mesh to external observability backends
+	ErrObservabilityBackendCode = "1039"
+
+	// ErrEndpointUnresolvableCode represents the errors which are generated
+	// when an endpoint does not resolve in the cluster
+	ErrEndpointUnresolvableCode = "1040"
+
+	// ErrMeshConfigUpdateCode represents the errors which are generated
+	// while reading or updating the mesh config of the control plane
+	ErrMeshConfigUpdateCode = "1041"
+
+	// ErrTelemetryCode represents the errors which are generated
+	// while configuring the mesh through the Telemetry API
+	ErrTelemetryCode = "1042"
+
+	// ErrSidecarMissingCode represents the errors which are generated
+	// when pods run without the sidecar proxy
+	ErrSidecarMissingCode = "1043"
+
+	// ErrSmokeTestCode represents the errors which are generated
+	// when an application does not answer through the ingress gateway
+	ErrSmokeTestCode = "1044"
+
+	// ErrTrafficShiftCode represents the errors which are generated
+	// while splitting the traffic of a service between its versions
+	ErrTrafficShiftCode = "1045"
+
+	// ErrFaultInjectionCode represents the errors which are generated
+	// while injecting faults in the routes of a host
+	ErrFaultInjectionCode = "1046"
+
+	// ErrCircuitBreakerCode represents the errors which are generated
+	// while configuring the circuit breaker of a host
+	ErrCircuitBreakerCode = "1047"
+
+	// ErrLoadTestCode represents the errors which are generated
+	// while running the fortio load test
+	ErrLoadTestCode = "1048"
+
+	// ErrGatewayTLSCode represents the errors which are generated
+	// when the TLS certificate of a sample app gateway cannot be set up
+	ErrGatewayTLSCode = "1049"
+
+	// ErrWasmPluginCode represents the errors which are generated
+	// while configuring a WasmPlugin
+	ErrWasmPluginCode = "1050"
+
+	// ErrRateLimitCode represents the errors which are generated
+	// while configuring rate limiting
+	ErrRateLimitCode = "1051"
+
+	// ErrEnvoyAdminCode represents the errors which are generated
+	// while retrieving resources from the Envoy admin API
+	ErrEnvoyAdminCode = "1052"
+
+	// ErrAuthorizationPolicyCode represents the errors which are generated
+	// when the AuthorizationPolicy could not be rendered or applied
+	ErrAuthorizationPolicyCode = "1053"
+
+	// ErrMTLSMigrationCode represents the errors which are generated
+	// when the namespaces could not be switched to strict mTLS
+	ErrMTLSMigrationCode = "1054"
+
+	// ErrRequestAuthenticationCode represents the errors which are generated
+	// when the RequestAuthentication could not be applied or the test token minted
+	ErrRequestAuthenticationCode = "1055"
+
+	// ErrExtAuthzCode represents the errors which are generated
+	// when OPA could not be deployed or registered as an extension provider
+	ErrExtAuthzCode = "1056"
+
+	// ErrEgressCode represents the errors which are generated
+	// when the egress traffic could not be restricted or the external services registered
+	ErrEgressCode = "1057"
+
+	// ErrSidecarGenerationCode represents the errors which are generated
+	// when the Sidecars scoping the configuration of the proxies could not be generated
+	ErrSidecarGenerationCode = "1058"
+
 	ErrFetchIstioVersions = errors.New(ErrFetchIstioVersionsCode, errors.Alert, []string{"could not get any istio versions"}, []string{"versions for istio could not be fetched"}, []string{"could not reach github.com/istio/istio/releases", "no versions could be fetched from istio release page"}, []string{"make sure adapter is reachable to github"})
 	// ErrOpInvalid represents the errors which are generated
 	// when an invalid operation is requested
@@ -271,3 +374,136 @@ func ErrLoadNamespace(err error, str string) error {
 func ErrInvalidInstallationProfile(str string) error {
 	return errors.New(ErrInvalidInstallationProfileCode, errors.Alert, []string{"Error while installing istio due to wrong profile"}, []string{"Gotten profile " + str}, []string{"Invalid profile passed"}, []string{"Provide one of the profiles: \"demo\",\"minimal\",\"default\" profiles"})
 }
+
+// ErrInvalidOperationParams is the error when the parameters of an operation cannot be decoded
+func ErrInvalidOperationParams(err error) error {
+	return errors.New(ErrInvalidOperationParamsCode, errors.Alert, []string{"Invalid operation parameters"}, []string{err.Error()}, []string{"The operation body is not a valid YAML or JSON document", "A parameter has an unexpected type"}, []string{"Check the parameters passed to the operation"})
+}
+
+// ErrRenderTemplate is the error when a parameterized template cannot be rendered
+func ErrRenderTemplate(err error) error {
+	return errors.New(ErrRenderTemplateCode, errors.Alert, []string{"Error while rendering template"}, []string{err.Error()}, []string{"Template could not be read", "A parameter required by the template is missing"}, []string{})
+}
+
+// ErrAddonExposure is the error when an addon could not be exposed
+func ErrAddonExposure(err error) error {
+	return errors.New(ErrAddonExposureCode, errors.Alert, []string{"Error while exposing addon"}, []string{err.Error()}, []string{"Invalid exposure mode", "Requested node port is already allocated or out of range", "Ingress gateway is not installed"}, []string{"Use one of the exposure modes: \"ClusterIP\", \"NodePort\", \"LoadBalancer\", \"IngressGateway\""})
+}
+
+// ErrWorkloadsNotReady is the error when workloads do not become ready in time
+func ErrWorkloadsNotReady(namespace string, names []string) error {
+	return errors.New(ErrWorkloadsNotReadyCode, errors.Alert, []string{"Workloads did not become ready in time"}, []string{fmt.Sprintf("Deployments not available in namespace %s: %s", namespace, strings.Join(names, ", "))}, []string{"Images could not be pulled", "Cluster does not have enough resources to schedule the pods", "Pods are crashing"}, []string{"Check the events and logs of the pods in the namespace"})
+}
+
+// ErrMissingCRD is the error when a manifest uses kinds which are not served by the cluster
+func ErrMissingCRD(kinds []string) error {
+	return errors.New(ErrMissingCRDCode, errors.Alert, []string{"Required custom resource definitions are missing"}, []string{fmt.Sprintf("The cluster does not serve: %s", strings.Join(kinds, ", "))}, []string{"The operator or mesh providing these CRDs is not installed"}, []string{"Install the CRDs the manifest depends on and retry the operation"})
+}
+
+// ErrObservabilityBackend is the error when the mesh could not be wired to external observability backends
+func ErrObservabilityBackend(err error) error {
+	return errors.New(ErrObservabilityBackendCode, errors.Alert, []string{"Error while configuring observability backends"}, []string{err.Error()}, []string{"Invalid backend parameters", "Prometheus operator CRDs are not installed"}, []string{"Check the prometheus and tracing parameters passed to the operation"})
+}
+
+// ErrEndpointUnresolvable is the error when an endpoint does not resolve in the cluster
+func ErrEndpointUnresolvable(endpoint string, err error) error {
+	return errors.New(ErrEndpointUnresolvableCode, errors.Alert, []string{"Endpoint does not resolve: ", endpoint}, []string{err.Error()}, []string{"The service does not exist or has no ready pods", "The host name is misspelt"}, []string{"Use the <service>.<namespace>.svc.cluster.local name of a running backend"})
+}
+
+// ErrMeshConfigUpdate is the error when the mesh config could not be read or updated
+func ErrMeshConfigUpdate(err error) error {
+	return errors.New(ErrMeshConfigUpdateCode, errors.Alert, []string{"Error while updating the mesh config"}, []string{err.Error()}, []string{"Istio control plane is not installed", "The istio config map in istio-system is malformed"}, []string{"Make sure Istio is installed through Meshery or that the istio config map exists"})
+}
+
+// ErrTelemetry is the error when the Telemetry resources could not be configured
+func ErrTelemetry(err error) error {
+	return errors.New(ErrTelemetryCode, errors.Alert, []string{"Error while configuring telemetry"}, []string{err.Error()}, []string{"Invalid telemetry parameters", "The Telemetry API is not served by the installed Istio version"}, []string{"Check the parameters passed to the operation and make sure Istio 1.12 or later is installed"})
+}
+
+// ErrSidecarMissing is the error when pods of the namespace run without the sidecar proxy
+func ErrSidecarMissing(namespace string, pods []string, err error) error {
+	return errors.New(ErrSidecarMissingCode, errors.Alert, []string{"Pods without sidecar in namespace: ", namespace}, []string{err.Error(), strings.Join(pods, ", ")}, []string{"The namespace is not labeled for injection", "The pods were created before the namespace was labeled", "The injection webhook of the selected revision is not running"}, []string{"Check the injection label of the namespace and restart the listed pods"})
+}
+
+// ErrSmokeTest is the error when an application does not answer through the ingress gateway
+func ErrSmokeTest(target string, err error) error {
+	return errors.New(ErrSmokeTestCode, errors.Alert, []string{"Smoke test failed for: ", target}, []string{err.Error()}, []string{"The ingress gateway is not installed or has no external address", "The gateway routes have not been applied"}, []string{"Make sure the istio-ingressgateway service is reachable from the adapter and check the Gateway and VirtualService of the application"})
+}
+
+// ErrTrafficShift is the error when the traffic of a service could not be shifted
+func ErrTrafficShift(err error) error {
+	return errors.New(ErrTrafficShiftCode, errors.Alert, []string{"Error while shifting traffic"}, []string{err.Error()}, []string{"The service does not exist in the namespace", "The Deployments of the service do not carry a version label", "The weights do not add up to 100"}, []string{"Check the service, weights and header routes passed to the operation and the version labels of its Deployments"})
+}
+
+// ErrFaultInjection is the error when faults could not be injected or reverted
+func ErrFaultInjection(err error) error {
+	return errors.New(ErrFaultInjectionCode, errors.Alert, []string{"Error while injecting faults"}, []string{err.Error()}, []string{"Invalid fault parameters", "Faults were already injected for the host", "The VirtualService of the host was modified concurrently"}, []string{"Check the host, delay, abort and match parameters, and remove previously injected faults before injecting new ones"})
+}
+
+// ErrCircuitBreaker is the error when the circuit breaker of a host could not be configured
+func ErrCircuitBreaker(err error) error {
+	return errors.New(ErrCircuitBreakerCode, errors.Alert, []string{"Error while configuring the circuit breaker"}, []string{err.Error()}, []string{"Invalid connection pool or outlier detection parameters", "A circuit breaker was already configured for the host"}, []string{"Check the parameters passed to the operation and remove the previous circuit breaker of the host first"})
+}
+
+// ErrLoadTest is the error when the fortio load test could not be run
+func ErrLoadTest(err error) error {
+	return errors.New(ErrLoadTestCode, errors.Alert, []string{"Error while running the load test"}, []string{err.Error()}, []string{"fortio or httpbin could not be deployed", "The adapter is not allowed to exec into pods"}, []string{"Make sure the images can be pulled and that the adapter has the pods/exec permission in the namespace"})
+}
+
+// ErrGatewayTLS is the error when the certificate for the gateway host
+// could not be generated or stored
+func ErrGatewayTLS(host string, err error) error {
+	return errors.New(ErrGatewayTLSCode, errors.Alert, []string{fmt.Sprintf("Error while setting up the TLS certificate for %s", host)}, []string{err.Error()}, []string{"The certificate could not be generated", "The adapter is not allowed to manage secrets in the gateway namespace"}, []string{"Make sure the adapter can create secrets in the namespace of the gateway workload"})
+}
+
+// ErrWasmPlugin is the error when the WasmPlugin could not be configured
+func ErrWasmPlugin(err error) error {
+	return errors.New(ErrWasmPluginCode, errors.Alert, []string{"Error while configuring the WasmPlugin"}, []string{err.Error()}, []string{"Invalid plugin parameters", "The proxies of the workloads are older than Istio 1.12", "The module ConfigMap does not exist"}, []string{"Check the module url or ConfigMap and upgrade the proxies of the workloads to Istio 1.12 or newer"})
+}
+
+// ErrRateLimit is the error when rate limiting could not be configured
+func ErrRateLimit(err error) error {
+	return errors.New(ErrRateLimitCode, errors.Alert, []string{"Error while configuring rate limiting"}, []string{err.Error()}, []string{"Invalid rate limit parameters", "The installed Istio version does not support the rate limit filter"}, []string{"Check the token buckets and descriptors, and that Istio 1.9 or newer is installed"})
+}
+
+// ErrEnvoyAdmin is the error when the resources of the proxies could not be
+// retrieved from their admin API
+func ErrEnvoyAdmin(err error) error {
+	return errors.New(ErrEnvoyAdminCode, errors.Alert, []string{"Error while retrieving the Envoy configuration"}, []string{err.Error()}, []string{"The pod has no istio-proxy container", "The adapter is not allowed to port-forward or exec into the pod"}, []string{"Check the pod or selector, and that the adapter has the pods/portforward and pods/exec permissions"})
+}
+
+// ErrAuthorizationPolicy is the error when the AuthorizationPolicy could
+// not be rendered or applied
+func ErrAuthorizationPolicy(err error) error {
+	return errors.New(ErrAuthorizationPolicyCode, errors.Alert, []string{"Error while configuring the AuthorizationPolicy"}, []string{err.Error()}, []string{"Invalid policy parameters", "The policy does not match the schema of the installed Istio version"}, []string{"Check the action, rules and provider of the policy against the AuthorizationPolicy reference of the installed Istio version"})
+}
+
+// ErrMTLSMigration is the error when the namespaces could not be switched
+// to strict mTLS
+func ErrMTLSMigration(err error) error {
+	return errors.New(ErrMTLSMigrationCode, errors.Alert, []string{"Error while migrating to strict mTLS"}, []string{err.Error()}, []string{"Clients without a sidecar send requests to the workloads of the namespaces", "Prometheus could not be queried"}, []string{"Inject the sidecar into the reported clients, or force the migration once they no longer need access"})
+}
+
+// ErrRequestAuthentication is the error when the RequestAuthentication could
+// not be applied or the test token could not be minted
+func ErrRequestAuthentication(err error) error {
+	return errors.New(ErrRequestAuthenticationCode, errors.Alert, []string{"Error while configuring the RequestAuthentication"}, []string{err.Error()}, []string{"Invalid issuer or key set parameters", "The signing key was not generated before minting a token", "The adapter is not allowed to manage secrets in the namespace"}, []string{"Pass an issuer with one of jwksUri, jwks or generateJwks, and apply the RequestAuthentication with generateJwks before minting a token"})
+}
+
+// ErrExtAuthz is the error when OPA could not be deployed, registered as an
+// extension provider or referenced by the AuthorizationPolicy
+func ErrExtAuthz(err error) error {
+	return errors.New(ErrExtAuthzCode, errors.Alert, []string{"Error while configuring external authorization"}, []string{err.Error()}, []string{"The Rego policy is missing or does not declare the package of the decision path", "The installed Istio version does not support the CUSTOM action", "The OPA image could not be pulled"}, []string{"Check the policy and decisionPath parameters, and that Istio 1.9 or newer is installed"})
+}
+
+// ErrEgress is the error when the outbound traffic could not be restricted
+// or the external services could not be registered
+func ErrEgress(err error) error {
+	return errors.New(ErrEgressCode, errors.Alert, []string{"Error while configuring the egress traffic"}, []string{err.Error()}, []string{"Invalid scope, host, port or protocol", "The namespace already has a Sidecar without workload selector", "The egress gateway of the demo profile is not installed"}, []string{"Check the parameters of the operation, and install Istio with the demo profile to route the traffic through the egress gateway"})
+}
+
+// ErrSidecarGeneration is the error when the egress hosts of the workloads
+// could not be computed or their Sidecars could not be applied
+func ErrSidecarGeneration(err error) error {
+	return errors.New(ErrSidecarGenerationCode, errors.Alert, []string{"Error while generating the Sidecars"}, []string{err.Error()}, []string{"Invalid granularity, window or extra host", "Prometheus is not installed, which the workload granularity requires", "The VirtualServices, DestinationRules or Sidecars could not be listed"}, []string{"Check the parameters of the operation, and install the Prometheus addon to account for the observed traffic"})
+}
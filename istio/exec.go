@@ -0,0 +1,101 @@
+package istio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// execInPod runs the command in the container of the pod and returns what
+// it wrote on its standard output
+func execInPod(mclient *mesherykube.Client, namespace, pod, container string, command []string) (string, error) {
+	req := mclient.KubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(&mclient.RestConfig, http.MethodPost, req.URL())
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(context.TODO(), remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return stdout.String(), fmt.Errorf("%s in %s/%s: %w: %s", strings.Join(command, " "), namespace, pod, err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// runningPod returns the name of a running pod matching the label selector
+func runningPod(mclient *mesherykube.Client, namespace, selector string) (string, error) {
+	pods, err := mclient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no running pod matches %s in namespace %s", selector, namespace)
+}
+
+// withPortForward forwards a free local port to the port of the pod for
+// the time fn runs, passing it the local port
+func withPortForward(mclient *mesherykube.Client, namespace, pod string, port int, fn func(localPort uint16) error) error {
+	req := mclient.KubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(&mclient.RestConfig)
+	if err != nil {
+		return err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{fmt.Sprintf("0:%d", port)}, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- forwarder.ForwardPorts()
+	}()
+	defer close(stop)
+
+	select {
+	case <-ready:
+	case err := <-errs:
+		return fmt.Errorf("port-forward to %s/%s: %w", namespace, pod, err)
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		return err
+	}
+	return fn(ports[0].Local)
+}
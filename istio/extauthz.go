@@ -0,0 +1,281 @@
+package istio
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	opaServiceFile  = "file://templates/opa/opa.yaml"
+	opaGRPCPort     = 9191
+	opaPolicyKey    = "policy.rego"
+	opaDecisionPath = "istio/authz/allow"
+)
+
+// minExtAuthzVersion is the first release supporting the CUSTOM action and
+// the ext-authz extension providers
+var minExtAuthzVersion = minorVersion{Major: 1, Minor: 9}
+
+// regoPackageRegex matches the package declaration of a Rego module
+var regoPackageRegex = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)`)
+
+// externalAuthorization are the parameters of the external authorization
+// operation
+type externalAuthorization struct {
+	// Name of the OPA service, of its extension provider and of the
+	// AuthorizationPolicy
+	Name string `yaml:"name"`
+	// ServiceNamespace is where OPA runs, the namespace of the operation
+	// when empty
+	ServiceNamespace string `yaml:"serviceNamespace,omitempty"`
+	// Policy is the Rego module, PolicyFile a local file holding it
+	Policy     string `yaml:"policy,omitempty"`
+	PolicyFile string `yaml:"policyFile,omitempty"`
+	// DecisionPath is the rule of the module deciding on the requests
+	DecisionPath string `yaml:"decisionPath"`
+	// Selector of the workloads whose requests are authorized by OPA,
+	// every workload of the namespace when empty
+	Selector map[string]string `yaml:"selector,omitempty"`
+	// Rules restrict the requests sent to OPA, all of them by default
+	Rules []authorizationRule `yaml:"rules,omitempty"`
+	// IncludeRequestHeaders are sent to OPA along with the request
+	IncludeRequestHeaders []string `yaml:"includeRequestHeaders,omitempty"`
+}
+
+func defaultExternalAuthorization() externalAuthorization {
+	return externalAuthorization{
+		Name:         "opa-ext-authz",
+		DecisionPath: opaDecisionPath,
+	}
+}
+
+func (e externalAuthorization) validate() error {
+	if errs := validation.IsDNS1123Label(e.Name); len(errs) > 0 {
+		return ErrExtAuthz(fmt.Errorf("invalid name %q: %s", e.Name, strings.Join(errs, ", ")))
+	}
+	if (e.Policy == "") == (e.PolicyFile == "") {
+		return ErrExtAuthz(fmt.Errorf("exactly one of policy and policyFile is required"))
+	}
+	if e.DecisionPath == "" {
+		return ErrExtAuthz(fmt.Errorf("a decisionPath is required"))
+	}
+	return e.policy().validate()
+}
+
+// regoModule returns the Rego module from the parameters or the local file,
+// and checks that it declares the package of the decision path
+func (e externalAuthorization) regoModule() (string, error) {
+	module := e.Policy
+	if e.PolicyFile != "" {
+		byt, err := os.ReadFile(e.PolicyFile)
+		if err != nil {
+			return "", ErrExtAuthz(err)
+		}
+		module = string(byt)
+	}
+	match := regoPackageRegex.FindStringSubmatch(module)
+	if match == nil {
+		return "", ErrExtAuthz(fmt.Errorf("the policy has no package declaration"))
+	}
+	pkg := strings.ReplaceAll(match[1], ".", "/")
+	if !strings.HasPrefix(e.DecisionPath, pkg+"/") {
+		return "", ErrExtAuthz(fmt.Errorf("the decision path %s is not in the package %s of the policy", e.DecisionPath, match[1]))
+	}
+	return module, nil
+}
+
+// serviceNamespace returns the namespace where OPA runs
+func (e externalAuthorization) serviceNamespace(namespace string) string {
+	if e.ServiceNamespace != "" {
+		return e.ServiceNamespace
+	}
+	return namespace
+}
+
+// extensionProvider returns the provider through which the proxies call OPA
+func (e externalAuthorization) extensionProvider(namespace string) map[string]interface{} {
+	grpc := map[string]interface{}{
+		"service": fmt.Sprintf("%s.%s.svc.cluster.local", e.Name, e.serviceNamespace(namespace)),
+		"port":    opaGRPCPort,
+	}
+	if len(e.IncludeRequestHeaders) > 0 {
+		grpc["includeRequestHeadersInCheck"] = e.IncludeRequestHeaders
+	}
+	return map[string]interface{}{
+		"name":              e.Name,
+		"envoyExtAuthzGrpc": grpc,
+	}
+}
+
+// policy returns the CUSTOM AuthorizationPolicy delegating the decisions on
+// the requests matching the rules to OPA
+func (e externalAuthorization) policy() authorizationPolicy {
+	rules := e.Rules
+	if len(rules) == 0 {
+		// an empty rule matches every request
+		rules = []authorizationRule{{}}
+	}
+	return authorizationPolicy{
+		Name:     e.Name,
+		Selector: e.Selector,
+		Action:   AuthorizationCustom,
+		Provider: e.Name,
+		Rules:    rules,
+	}
+}
+
+// policyConfigMap returns the ConfigMap holding the Rego module
+func (e externalAuthorization) policyConfigMap(module string) ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":   e.Name + "-policy",
+			"labels": map[string]interface{}{"app": e.Name},
+		},
+		"data": map[string]interface{}{
+			opaPolicyKey: module,
+		},
+	})
+}
+
+// configureExternalAuthorization deploys OPA, registers it as an extension
+// provider and applies the CUSTOM AuthorizationPolicy, or removes them
+func (istio *Istio) configureExternalAuthorization(namespace string, del bool, authz externalAuthorization, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	var module string
+	if !del {
+		if err := authz.validate(); err != nil {
+			return st, nil, err
+		}
+		var err error
+		if module, err = authz.regoModule(); err != nil {
+			return st, nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureExternalAuthorizationOnSingleCluster(namespace, del, authz, module, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrExtAuthz(mergeErrors(errs))
+}
+
+func (istio *Istio) configureExternalAuthorizationOnSingleCluster(namespace string, del bool, authz externalAuthorization, module string, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	serviceNamespace := authz.serviceNamespace(namespace)
+	service, err := renderTemplate(opaServiceFile, map[string]interface{}{
+		"Name":         authz.Name,
+		"GRPCPort":     opaGRPCPort,
+		"DecisionPath": authz.DecisionPath,
+	})
+	if err != nil {
+		return msgs, err
+	}
+	configMap, err := authz.policyConfigMap(module)
+	if err != nil {
+		return msgs, err
+	}
+	policy, err := yaml.Marshal(authz.policy().resource(namespace))
+	if err != nil {
+		return msgs, err
+	}
+
+	if del {
+		// the policy is removed first so that no proxy calls a removed
+		// provider, which would deny the requests
+		if err := istio.applyManifestOnSingleCluster(policy, true, namespace, mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("AuthorizationPolicy %s/%s deleted", namespace, authz.Name))
+		err := updateMeshConfig(mclient, func(mesh meshConfig) error {
+			mesh.removeExtensionProvider(authz.Name)
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("extension provider %s removed from the mesh config", authz.Name))
+		for _, manifest := range []string{service, string(configMap)} {
+			if err := istio.applyManifestOnSingleCluster([]byte(manifest), true, serviceNamespace, mclient); err != nil {
+				return msgs, err
+			}
+		}
+		return append(msgs, fmt.Sprintf("OPA %s removed from namespace %s", authz.Name, serviceNamespace)), nil
+	}
+
+	version, err := controlPlaneVersion(mclient)
+	if err != nil {
+		return msgs, err
+	}
+	if !version.atLeast(minExtAuthzVersion) {
+		return msgs, fmt.Errorf("external authorization requires Istio %s or newer, the control plane runs %s", minExtAuthzVersion, version)
+	}
+	if err := validateAgainstMeshmodel("AuthorizationPolicy", version, authz.policy().resource(namespace)); err != nil {
+		return msgs, err
+	}
+
+	for _, manifest := range []string{string(configMap), service} {
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), false, serviceNamespace, mclient); err != nil {
+			return msgs, err
+		}
+	}
+	if err := waitForDeployments(mclient, serviceNamespace, []string{authz.Name}); err != nil {
+		return msgs, err
+	}
+	msgs = append(msgs, fmt.Sprintf("OPA %s running in namespace %s, deciding with %s", authz.Name, serviceNamespace, authz.DecisionPath))
+
+	err = updateMeshConfig(mclient, func(mesh meshConfig) error {
+		mesh.setExtensionProvider(authz.extensionProvider(namespace))
+		return nil
+	})
+	if err != nil {
+		return msgs, err
+	}
+	msgs = append(msgs, fmt.Sprintf("extension provider %s registered in the mesh config", authz.Name))
+
+	if err := istio.applyManifestOnSingleCluster(policy, false, namespace, mclient); err != nil {
+		return msgs, err
+	}
+	return append(msgs, fmt.Sprintf("AuthorizationPolicy %s/%s sends the requests to OPA", namespace, authz.Name)), nil
+}
@@ -0,0 +1,158 @@
+package istio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const testRegoPolicy = `package istio.authz
+
+import input.attributes.request.http as http_request
+
+default allow = false
+
+allow {
+	http_request.method == "GET"
+}
+`
+
+func TestExternalAuthorization_regoModule(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.rego")
+	if err := os.WriteFile(file, []byte(testRegoPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		authz   externalAuthorization
+		wantErr bool
+	}{
+		{
+			name:  "inline policy",
+			authz: externalAuthorization{Name: "opa", Policy: testRegoPolicy, DecisionPath: opaDecisionPath},
+		},
+		{
+			name:  "local file",
+			authz: externalAuthorization{Name: "opa", PolicyFile: file, DecisionPath: opaDecisionPath},
+		},
+		{
+			name:    "missing file",
+			authz:   externalAuthorization{Name: "opa", PolicyFile: filepath.Join(t.TempDir(), "missing.rego"), DecisionPath: opaDecisionPath},
+			wantErr: true,
+		},
+		{
+			name:    "decision path outside the package",
+			authz:   externalAuthorization{Name: "opa", Policy: testRegoPolicy, DecisionPath: "envoy/authz/allow"},
+			wantErr: true,
+		},
+		{
+			name:    "no package",
+			authz:   externalAuthorization{Name: "opa", Policy: "allow = true", DecisionPath: opaDecisionPath},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module, err := tt.authz.regoModule()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("externalAuthorization.regoModule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && module != testRegoPolicy {
+				t.Errorf("externalAuthorization.regoModule() = %v, want %v", module, testRegoPolicy)
+			}
+		})
+	}
+}
+
+func TestExternalAuthorization_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "defaults with an inline policy",
+			params: "{policy: 'package istio.authz'}",
+		},
+		{
+			name:   "restricted to paths",
+			params: "{policy: 'package istio.authz', selector: {app: productpage}, rules: [{paths: [/admin/*]}]}",
+		},
+		{
+			name:    "no policy",
+			params:  "",
+			wantErr: true,
+		},
+		{
+			name:    "inline policy and file",
+			params:  "{policy: 'package istio.authz', policyFile: /tmp/policy.rego}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			params:  "{name: OPA_Server, policy: 'package istio.authz'}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := defaultExternalAuthorization()
+			if err := parseOperationParams(tt.params, &authz); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := authz.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("externalAuthorization.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalAuthorization_resources(t *testing.T) {
+	authz := defaultExternalAuthorization()
+	if err := parseOperationParams("{policy: 'package istio.authz', serviceNamespace: opa, selector: {app: productpage}, includeRequestHeaders: [authorization]}", &authz); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"name": "opa-ext-authz",
+		"envoyExtAuthzGrpc": map[string]interface{}{
+			"service":                      "opa-ext-authz.opa.svc.cluster.local",
+			"port":                         opaGRPCPort,
+			"includeRequestHeadersInCheck": []string{"authorization"},
+		},
+	}
+	if got := authz.extensionProvider("bookinfo"); !reflect.DeepEqual(got, want) {
+		t.Errorf("extensionProvider() = %v, want %v", got, want)
+	}
+
+	policy := authz.policy().resource("bookinfo")
+	spec := policy["spec"].(map[string]interface{})
+	if spec["action"] != AuthorizationCustom || !reflect.DeepEqual(spec["provider"], map[string]interface{}{"name": "opa-ext-authz"}) {
+		t.Errorf("policy spec = %v, want the CUSTOM action with the opa-ext-authz provider", spec)
+	}
+	if err := validateAgainstMeshmodel("AuthorizationPolicy", minorVersion{Major: 1, Minor: 22}, policy); err != nil {
+		t.Errorf("validateAgainstMeshmodel() error = %v", err)
+	}
+
+	manifest, err := renderTemplate("file://../templates/opa/opa.yaml", map[string]interface{}{
+		"Name":         authz.Name,
+		"GRPCPort":     opaGRPCPort,
+		"DecisionPath": authz.DecisionPath,
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() error = %v", err)
+	}
+	for _, doc := range strings.Split(manifest, "\n---\n") {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatalf("invalid manifest: %v", err)
+		}
+	}
+	if !strings.Contains(manifest, "--set=plugins.envoy_ext_authz_grpc.path=istio/authz/allow") {
+		t.Errorf("the decision path is not passed to OPA:\n%s", manifest)
+	}
+}
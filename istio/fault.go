@@ -0,0 +1,450 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// faultAnnotation records on a VirtualService what the fault injection
+	// added to it, so that exactly that can be reverted
+	faultAnnotation = "meshery.io/fault-injection"
+
+	faultRouteName       = "meshery-fault-injection"
+	faultRouteNamePrefix = "meshery-fault-"
+)
+
+// mergeableMatchFields are the fields of the HTTP match conditions keyed by
+// header, query parameter or label name
+var mergeableMatchFields = map[string]bool{
+	"headers":        true,
+	"withoutHeaders": true,
+	"queryParams":    true,
+	"sourceLabels":   true,
+}
+
+// faultInjection describes the faults injected in the requests to a host
+type faultInjection struct {
+	// Namespace of the VirtualServices, only used by the OAM trait
+	Namespace string `yaml:"namespace,omitempty"`
+	// Host whose requests are faulted
+	Host string `yaml:"host,omitempty"`
+	// Percentage of the requests faulted
+	Percentage float64 `yaml:"percentage,omitempty"`
+	// Fixed delay added to the requests, e.g. 5s
+	Delay string `yaml:"delay,omitempty"`
+	// HTTP status returned instead of forwarding the requests
+	Abort int `yaml:"abort,omitempty"`
+	// HTTP match conditions restricting the faulted requests, in the
+	// VirtualService format
+	Match []interface{} `yaml:"match,omitempty"`
+}
+
+// faultRecord is what the fault injection added to a VirtualService
+type faultRecord struct {
+	// The VirtualService was created by the fault injection
+	Created bool `json:"created,omitempty"`
+	// Faulted routes restricted to the match conditions which were inserted
+	Inserted []string `json:"inserted,omitempty"`
+	// Routes the fault was added to
+	Routes []string `json:"routes,omitempty"`
+	// Routes which were unnamed and got a name to be found again
+	Named []string `json:"named,omitempty"`
+}
+
+func defaultFaultInjection() faultInjection {
+	return faultInjection{Percentage: 100}
+}
+
+func (f faultInjection) validate() error {
+	if f.Host == "" {
+		return ErrFaultInjection(fmt.Errorf("target host is required"))
+	}
+	if f.Delay == "" && f.Abort == 0 {
+		return ErrFaultInjection(fmt.Errorf("a delay or an abort status is required"))
+	}
+	if f.Delay != "" {
+		if _, err := time.ParseDuration(f.Delay); err != nil {
+			return ErrFaultInjection(fmt.Errorf("invalid delay %s: %w", f.Delay, err))
+		}
+	}
+	if f.Abort != 0 && (f.Abort < 200 || f.Abort > 599) {
+		return ErrFaultInjection(fmt.Errorf("invalid abort status: %d", f.Abort))
+	}
+	if f.Percentage <= 0 || f.Percentage > 100 {
+		return ErrFaultInjection(fmt.Errorf("percentage must be in ]0, 100], got %v", f.Percentage))
+	}
+	return nil
+}
+
+// spec returns the fault block of an HTTP route
+func (f faultInjection) spec() map[string]interface{} {
+	percentage := map[string]interface{}{"value": f.Percentage}
+	fault := map[string]interface{}{}
+	if f.Delay != "" {
+		fault["delay"] = map[string]interface{}{"fixedDelay": f.Delay, "percentage": percentage}
+	}
+	if f.Abort != 0 {
+		fault["abort"] = map[string]interface{}{"httpStatus": int64(f.Abort), "percentage": percentage}
+	}
+	return fault
+}
+
+// injectFault merges the fault into the HTTP routes of the VirtualService
+// which forward the requests to the host. With match conditions, a faulted
+// copy of each of these routes, restricted to the conditions, is inserted
+// right before it; otherwise the fault is added to the routes themselves.
+func injectFault(vs *unstructured.Unstructured, f faultInjection) error {
+	if _, ok := vs.GetAnnotations()[faultAnnotation]; ok {
+		return ErrFaultInjection(fmt.Errorf("faults are already injected by VirtualService %s, remove them first", vs.GetName()))
+	}
+	routes, _, err := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if err != nil {
+		return ErrFaultInjection(err)
+	}
+	var match []interface{}
+	if len(f.Match) > 0 {
+		if match, err = toUnstructuredSlice(f.Match); err != nil {
+			return ErrFaultInjection(err)
+		}
+	}
+
+	record := faultRecord{}
+	faulted := make([]interface{}, 0, len(routes))
+	for i, r := range routes {
+		route, _ := r.(map[string]interface{})
+		if !routesToHost(route, f.Host, vs.GetNamespace()) {
+			faulted = append(faulted, route)
+			continue
+		}
+		if len(match) > 0 {
+			copied, _ := runtime.DeepCopyJSONValue(route).(map[string]interface{})
+			existing, _ := route["match"].([]interface{})
+			combined, err := combineMatches(existing, match)
+			if err != nil {
+				return ErrFaultInjection(fmt.Errorf("route %d of VirtualService %s: %w", i, vs.GetName(), err))
+			}
+			name := fmt.Sprintf("%s-%d", faultRouteName, i)
+			copied["name"] = name
+			copied["match"] = combined
+			copied["fault"] = f.spec()
+			faulted = append(faulted, copied, route)
+			record.Inserted = append(record.Inserted, name)
+			continue
+		}
+		if _, ok := route["fault"]; ok {
+			return ErrFaultInjection(fmt.Errorf("route %d of VirtualService %s already has a fault", i, vs.GetName()))
+		}
+		name, _ := route["name"].(string)
+		if name == "" {
+			name = fmt.Sprintf("%s%d", faultRouteNamePrefix, i)
+			route["name"] = name
+			record.Named = append(record.Named, name)
+		}
+		route["fault"] = f.spec()
+		faulted = append(faulted, route)
+		record.Routes = append(record.Routes, name)
+	}
+	if len(record.Inserted) == 0 && len(record.Routes) == 0 {
+		return ErrFaultInjection(fmt.Errorf("VirtualService %s has no HTTP route forwarding the requests to %s", vs.GetName(), f.Host))
+	}
+	if err := unstructured.SetNestedSlice(vs.Object, faulted, "spec", "http"); err != nil {
+		return ErrFaultInjection(err)
+	}
+	return setFaultRecord(vs, record)
+}
+
+// routesToHost checks if the HTTP route forwards the requests to the host.
+// Routes redirecting, delegating or answering the requests directly have
+// no destination and never do.
+func routesToHost(route map[string]interface{}, host, namespace string) bool {
+	destinations, _ := route["route"].([]interface{})
+	target := qualifiedHost(host, namespace)
+	for _, d := range destinations {
+		d, _ := d.(map[string]interface{})
+		destination, _, _ := unstructured.NestedString(d, "destination", "host")
+		if destination != "" && qualifiedHost(destination, namespace) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// combineMatches returns the match conditions of a route restricted to the
+// given ones: each pair of conditions is merged into a single one, both
+// having to hold
+func combineMatches(existing, restriction []interface{}) ([]interface{}, error) {
+	if len(existing) == 0 {
+		return runtime.DeepCopyJSONValue(restriction).([]interface{}), nil
+	}
+	combined := make([]interface{}, 0, len(existing)*len(restriction))
+	for _, e := range existing {
+		for _, r := range restriction {
+			condition, _ := runtime.DeepCopyJSONValue(e).(map[string]interface{})
+			if condition == nil {
+				condition = map[string]interface{}{}
+			}
+			r, _ := r.(map[string]interface{})
+			for field, value := range r {
+				current, ok := condition[field]
+				if !ok {
+					condition[field] = runtime.DeepCopyJSONValue(value)
+					continue
+				}
+				merged, err := mergeMatchMaps(field, current, value)
+				if err != nil {
+					return nil, err
+				}
+				condition[field] = merged
+			}
+			combined = append(combined, condition)
+		}
+	}
+	return combined, nil
+}
+
+// revertFault removes from the VirtualService what the fault injection
+// added to it. It reports whether the VirtualService was created by the
+// fault injection and should be deleted.
+func revertFault(vs *unstructured.Unstructured) (bool, error) {
+	annotations := vs.GetAnnotations()
+	raw, ok := annotations[faultAnnotation]
+	if !ok {
+		return false, nil
+	}
+	record := faultRecord{}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false, ErrFaultInjection(err)
+	}
+	if record.Created {
+		return true, nil
+	}
+
+	routes, _, err := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if err != nil {
+		return false, ErrFaultInjection(err)
+	}
+	faulted := toSet(record.Routes)
+	named := toSet(record.Named)
+	inserted := toSet(record.Inserted)
+	kept := make([]interface{}, 0, len(routes))
+	for _, r := range routes {
+		route, _ := r.(map[string]interface{})
+		name, _ := route["name"].(string)
+		if inserted[name] {
+			continue
+		}
+		if faulted[name] {
+			delete(route, "fault")
+		}
+		if named[name] {
+			delete(route, "name")
+		}
+		kept = append(kept, route)
+	}
+	if err := unstructured.SetNestedSlice(vs.Object, kept, "spec", "http"); err != nil {
+		return false, ErrFaultInjection(err)
+	}
+	delete(annotations, faultAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	vs.SetAnnotations(annotations)
+	return false, nil
+}
+
+func setFaultRecord(vs *unstructured.Unstructured, record faultRecord) error {
+	byt, err := json.Marshal(record)
+	if err != nil {
+		return ErrFaultInjection(err)
+	}
+	annotations := vs.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[faultAnnotation] = string(byt)
+	vs.SetAnnotations(annotations)
+	return nil
+}
+
+// newFaultVirtualService returns a VirtualService routing the host to itself
+// with the fault, for hosts not routed by any VirtualService yet
+func newFaultVirtualService(namespace string, f faultInjection) (*unstructured.Unstructured, error) {
+	vs := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       "VirtualService",
+		"metadata": map[string]interface{}{
+			"name":      fmt.Sprintf("%s-%s", subsetName(f.Host), faultRouteName),
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"hosts": []interface{}{f.Host},
+			"http": []interface{}{
+				map[string]interface{}{
+					"route": []interface{}{
+						map[string]interface{}{"destination": map[string]interface{}{"host": f.Host}},
+					},
+				},
+			},
+		},
+	}}
+	if err := injectFault(vs, f); err != nil {
+		return nil, err
+	}
+	return vs, setFaultRecord(vs, faultRecord{Created: true})
+}
+
+// configureFaultInjection injects the faults in the requests to the host, or
+// reverts them
+func (istio *Istio) configureFaultInjection(namespace string, del bool, fault faultInjection, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if del && fault.Host == "" {
+		return st, nil, ErrFaultInjection(fmt.Errorf("target host is required"))
+	}
+	if !del {
+		if err := fault.validate(); err != nil {
+			return st, nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := configureFaultInjectionOnSingleCluster(namespace, del, fault, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrFaultInjection(mergeErrors(errs))
+}
+
+func configureFaultInjectionOnSingleCluster(namespace string, del bool, fault faultInjection, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	vsClient := mclient.DynamicKubeClient.Resource(virtualServiceGVR).Namespace(namespace)
+
+	services, err := virtualServicesForHost(mclient, namespace, fault.Host)
+	if err != nil {
+		return msgs, ErrFaultInjection(err)
+	}
+
+	if del {
+		reverted := false
+		for i := range services {
+			vs := &services[i]
+			if _, ok := vs.GetAnnotations()[faultAnnotation]; !ok {
+				continue
+			}
+			reverted = true
+			created, err := revertFault(vs)
+			if err != nil {
+				return msgs, err
+			}
+			if created {
+				if err := vsClient.Delete(context.TODO(), vs.GetName(), metav1.DeleteOptions{}); err != nil {
+					return msgs, ErrFaultInjection(err)
+				}
+				msgs = append(msgs, fmt.Sprintf("VirtualService %s/%s deleted", namespace, vs.GetName()))
+				continue
+			}
+			if _, err := vsClient.Update(context.TODO(), vs, metav1.UpdateOptions{}); err != nil {
+				return msgs, ErrFaultInjection(err)
+			}
+			msgs = append(msgs, fmt.Sprintf("faults removed from VirtualService %s/%s", namespace, vs.GetName()))
+		}
+		if !reverted {
+			return msgs, ErrFaultInjection(fmt.Errorf("no faults are injected for %s in namespace %s", fault.Host, namespace))
+		}
+		return msgs, nil
+	}
+
+	if len(services) == 0 {
+		vs, err := newFaultVirtualService(namespace, fault)
+		if err != nil {
+			return msgs, err
+		}
+		if _, err := vsClient.Create(context.TODO(), vs, metav1.CreateOptions{}); err != nil {
+			return msgs, ErrFaultInjection(err)
+		}
+		return append(msgs, fmt.Sprintf("VirtualService %s/%s created with faults for %s", namespace, vs.GetName(), fault.Host)), nil
+	}
+
+	for i := range services {
+		vs := &services[i]
+		if err := injectFault(vs, fault); err != nil {
+			return msgs, err
+		}
+		if _, err := vsClient.Update(context.TODO(), vs, metav1.UpdateOptions{}); err != nil {
+			return msgs, ErrFaultInjection(err)
+		}
+		msgs = append(msgs, fmt.Sprintf("faults injected in VirtualService %s/%s for %s", namespace, vs.GetName(), fault.Host))
+	}
+	return msgs, nil
+}
+
+// mergeMatchMaps merges the values of a match field set by both
+// conditions. Only the fields keyed by header, parameter or label name can
+// be merged, as long as they do not set the same key.
+func mergeMatchMaps(field string, current, value interface{}) (interface{}, error) {
+	conflict := fmt.Errorf("the match conditions both set %s", field)
+	if !mergeableMatchFields[field] {
+		return nil, conflict
+	}
+	merged, _ := current.(map[string]interface{})
+	values, _ := value.(map[string]interface{})
+	if merged == nil || values == nil {
+		return nil, conflict
+	}
+	for key, v := range values {
+		if existing, ok := merged[key]; ok && !reflect.DeepEqual(existing, v) {
+			return nil, fmt.Errorf("the match conditions both set %s %s", field, key)
+		}
+		merged[key] = runtime.DeepCopyJSONValue(v)
+	}
+	return merged, nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,215 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const testReviewsVirtualService = `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: reviews
+  namespace: bookinfo
+spec:
+  hosts:
+  - reviews
+  http:
+  - name: jason
+    match:
+    - headers:
+        end-user:
+          exact: jason
+    route:
+    - destination:
+        host: reviews
+        subset: v2
+  - route:
+    - destination:
+        host: reviews
+        subset: v1
+`
+
+func getTestVirtualService(t *testing.T) *unstructured.Unstructured {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(testReviewsVirtualService), &obj); err != nil {
+		t.Fatalf("failed to decode test VirtualService: %v", err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func TestInjectFault_revert(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     string
+		wantRoutes int
+	}{
+		{
+			name:       "fault added to every route",
+			params:     "{host: reviews, delay: 7s, percentage: 50}",
+			wantRoutes: 2,
+		},
+		{
+			name:       "faulted routes inserted for the match",
+			params:     "{host: reviews, abort: 503, match: [{headers: {x-fault: {exact: \"true\"}}}]}",
+			wantRoutes: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fault := defaultFaultInjection()
+			if err := parseOperationParams(tt.params, &fault); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := fault.validate(); err != nil {
+				t.Fatalf("faultInjection.validate() error = %v", err)
+			}
+
+			original := getTestVirtualService(t)
+			vs := original.DeepCopy()
+			if err := injectFault(vs, fault); err != nil {
+				t.Fatalf("injectFault() error = %v", err)
+			}
+			routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+			if len(routes) != tt.wantRoutes {
+				t.Errorf("injectFault() left %d routes, want %d", len(routes), tt.wantRoutes)
+			}
+			for _, r := range routes {
+				if _, ok := r.(map[string]interface{})["fault"]; !ok && len(fault.Match) == 0 {
+					t.Errorf("injectFault() did not add the fault to route %v", r)
+				}
+			}
+			if err := injectFault(vs.DeepCopy(), fault); err == nil {
+				t.Errorf("injectFault() twice should fail")
+			}
+
+			created, err := revertFault(vs)
+			if err != nil {
+				t.Fatalf("revertFault() error = %v", err)
+			}
+			if created {
+				t.Errorf("revertFault() reported a created VirtualService")
+			}
+			if !reflect.DeepEqual(vs.Object, original.Object) {
+				t.Errorf("revertFault() = %v, want %v", vs.Object, original.Object)
+			}
+		})
+	}
+}
+
+const testMixedVirtualService = `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: bookinfo
+  namespace: bookinfo
+spec:
+  hosts:
+  - bookinfo.meshery.io
+  http:
+  - match:
+    - uri:
+        exact: /old
+    redirect:
+      uri: /productpage
+  - match:
+    - uri:
+        prefix: /api/v1/products
+    route:
+    - destination:
+        host: productpage
+  - match:
+    - uri:
+        prefix: /reviews
+    rewrite:
+      uri: /
+    timeout: 3s
+    route:
+    - destination:
+        host: reviews
+`
+
+func TestInjectFault_onlyRoutesToHost(t *testing.T) {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(testMixedVirtualService), &obj); err != nil {
+		t.Fatalf("failed to decode test VirtualService: %v", err)
+	}
+	original := &unstructured.Unstructured{Object: obj}
+
+	fault := defaultFaultInjection()
+	if err := parseOperationParams("{host: reviews, abort: 503, match: [{headers: {end-user: {exact: tester}}}]}", &fault); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	vs := original.DeepCopy()
+	if err := injectFault(vs, fault); err != nil {
+		t.Fatalf("injectFault() error = %v", err)
+	}
+	routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if len(routes) != 4 {
+		t.Fatalf("injectFault() left %d routes, want 4", len(routes))
+	}
+	inserted, _ := routes[2].(map[string]interface{})
+	for _, field := range []string{"fault", "rewrite", "timeout", "route"} {
+		if _, ok := inserted[field]; !ok {
+			t.Errorf("injectFault() inserted route without %s: %v", field, inserted)
+		}
+	}
+	match, _ := inserted["match"].([]interface{})
+	condition, _ := match[0].(map[string]interface{})
+	if _, ok := condition["uri"]; !ok || len(match) != 1 {
+		t.Errorf("injectFault() inserted route does not keep the original conditions: %v", match)
+	}
+	for _, i := range []int{0, 1, 3} {
+		if _, ok := routes[i].(map[string]interface{})["fault"]; ok {
+			t.Errorf("injectFault() faulted route %d: %v", i, routes[i])
+		}
+	}
+	if _, err := revertFault(vs); err != nil {
+		t.Fatalf("revertFault() error = %v", err)
+	}
+	if !reflect.DeepEqual(vs.Object, original.Object) {
+		t.Errorf("revertFault() = %v, want %v", vs.Object, original.Object)
+	}
+
+	fault.Host = "details"
+	if err := injectFault(original.DeepCopy(), fault); err == nil {
+		t.Errorf("injectFault() error = nil, want an error for a host without routes")
+	}
+}
+
+func TestNewFaultVirtualService(t *testing.T) {
+	fault := defaultFaultInjection()
+	fault.Host = "ratings"
+	fault.Abort = 500
+	vs, err := newFaultVirtualService("bookinfo", fault)
+	if err != nil {
+		t.Fatalf("newFaultVirtualService() error = %v", err)
+	}
+	created, err := revertFault(vs)
+	if err != nil || !created {
+		t.Errorf("revertFault() = %v, %v, want true, nil", created, err)
+	}
+}
+
+func TestConfigureFaultInjection_deleteWithoutHost(t *testing.T) {
+	istio := &Istio{}
+	if _, _, err := istio.configureFaultInjection("bookinfo", true, defaultFaultInjection(), nil); err == nil {
+		t.Errorf("configureFaultInjection() error = nil, want an error for a missing host")
+	}
+}
+
+func TestQualifiedHost(t *testing.T) {
+	for host, want := range map[string]string{
+		"reviews":                            "reviews.bookinfo.svc.cluster.local",
+		"reviews.bookinfo":                   "reviews.bookinfo.svc.cluster.local",
+		"reviews.bookinfo.svc.cluster.local": "reviews.bookinfo.svc.cluster.local",
+		"bookinfo.meshery.io":                "bookinfo.meshery.io",
+	} {
+		if got := qualifiedHost(host, "bookinfo"); got != want {
+			t.Errorf("qualifiedHost(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
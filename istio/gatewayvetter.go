@@ -0,0 +1,477 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	"github.com/aspenmesh/istio-vet/pkg/vetter"
+	networkingapi "istio.io/api/networking/v1beta1"
+	networkingclient "istio.io/client-go/pkg/apis/networking/v1beta1"
+	networkinglisters "istio.io/client-go/pkg/listers/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// meshGateway is the reserved gateway name of the sidecars of the mesh
+	meshGateway = "mesh"
+
+	gatewaySelectorVetterID = "GatewaySelector"
+
+	unmatchedGatewayNoteType = "gateway-without-workload"
+	unmatchedGatewaySummary  = "Gateway selects no gateway workload - ${gateway_name}"
+	unmatchedGatewayMsg      = "The selector ${selector} of the Gateway ${gateway_name} in namespace ${namespace} matches no pod," +
+		" so none of its servers is exposed. The minimal profile installs no ingress gateway: install one carrying these labels," +
+		" for instance with the default or demo profile, or change the selector to the labels of an existing gateway deployment."
+
+	gatewayReferenceVetterID = "VirtualServiceGateway"
+
+	missingGatewayNoteType = "virtualservice-missing-gateway"
+	missingGatewaySummary  = "VirtualService bound to a missing Gateway - ${vs_name}"
+	missingGatewayMsg      = "The VirtualService ${vs_name} in namespace ${namespace} is bound to the Gateway(s) ${gateway_list}, which don't exist," +
+		" so its routes are not applied on them. Create the Gateways, or fix the references, using the namespace/name format" +
+		" for the Gateways of other namespaces."
+
+	unboundHostNoteType = "virtualservice-host-not-on-gateway"
+	unboundHostSummary  = "VirtualService hosts not served by its Gateway - ${vs_name}"
+	unboundHostMsg      = "The host(s) ${hostname_list} of the VirtualService ${vs_name} in namespace ${namespace} match no server of the Gateway ${gateway}," +
+		" so the Gateway does not route their traffic. Add the hosts to a server of the Gateway, allowing the namespace of the VirtualService," +
+		" or remove the Gateway from the VirtualService."
+
+	gatewayHostVetterID = "GatewayHostOverlap"
+
+	overlappingGatewayNoteType = "gateway-host-overlap"
+	overlappingGatewaySummary  = "Gateways share hosts on the same port - ${gateway_name}"
+	overlappingGatewayMsg      = "The Gateways ${gateway_name} and ${other_gateway} select the same gateway pods and both serve ${hostname_list} on port ${port}," +
+		" so only one of their servers takes effect. Merge the servers into one Gateway, or make their hosts distinct."
+
+	gatewayTLSSecretVetterID = "GatewayTLSSecret"
+
+	missingTLSSecretNoteType = "gateway-missing-tls-secret"
+	missingTLSSecretSummary  = "Gateway TLS credential not found - ${gateway_name}"
+	missingTLSSecretMsg      = "The server on port ${port} of the Gateway ${gateway_name} in namespace ${namespace} uses the credential ${secret}," +
+		" which is missing from the namespace(s) ${namespace_list} of its gateway pods, so its TLS listener is not served." +
+		" Create the TLS secret in the namespace of the gateway workload, or fix the credentialName."
+)
+
+// gatewayResources are the resources the Gateway vetters inspect
+type gatewayResources struct {
+	gateways        []*networkingclient.Gateway
+	virtualServices []*networkingclient.VirtualService
+	pods            []*corev1.Pod
+	// secrets tells which of the TLS credentials referenced by the Gateways,
+	// keyed by namespace/name, exist
+	secrets map[string]bool
+}
+
+// gatewayPods returns the pods the Gateway is applied to, Istio looking
+// them up in every namespace
+func (r gatewayResources) gatewayPods(gw *networkingclient.Gateway) []*corev1.Pod {
+	if len(gw.Spec.GetSelector()) == 0 {
+		return nil
+	}
+	return selectPods(r.pods, "", gw.Spec.GetSelector())
+}
+
+// gateway returns the Gateway of the reference of a VirtualService
+func (r gatewayResources) gateway(ref, namespace string) *networkingclient.Gateway {
+	name := ref
+	switch {
+	case strings.Contains(ref, "/"):
+		parts := strings.SplitN(ref, "/", 2)
+		namespace, name = parts[0], parts[1]
+	case strings.Contains(ref, "."):
+		// the deprecated <name>.<namespace>.svc.cluster.local format
+		parts := strings.SplitN(ref, ".", 3)
+		name, namespace = parts[0], parts[1]
+	}
+	for _, gw := range r.gateways {
+		if gw.Name == name && gw.Namespace == namespace {
+			return gw
+		}
+	}
+	return nil
+}
+
+// hostsOverlap tells whether two hosts, either of which may be a wildcard,
+// have names in common
+func hostsOverlap(a, b string) bool {
+	switch {
+	case a == b, a == "*", b == "*":
+		return true
+	case strings.HasPrefix(a, "*.") && strings.HasSuffix(b, a[1:]):
+		return true
+	case strings.HasPrefix(b, "*.") && strings.HasSuffix(a, b[1:]):
+		return true
+	}
+	return false
+}
+
+// serverBindsHost tells whether the host of a VirtualService of the
+// namespace binds to the server of the Gateway
+func serverBindsHost(server *networkingapi.Server, gatewayNamespace, host, namespace string) bool {
+	for _, serverHost := range server.GetHosts() {
+		allowed := "*"
+		if parts := strings.SplitN(serverHost, "/", 2); len(parts) == 2 {
+			allowed, serverHost = parts[0], parts[1]
+		}
+		if allowed == "." {
+			allowed = gatewayNamespace
+		}
+		if (allowed == "*" || allowed == namespace) && hostsOverlap(serverHost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualServiceGateways returns the gateways the VirtualService and its
+// HTTP routes are bound to
+func virtualServiceGateways(vs *networkingclient.VirtualService) []string {
+	refs := map[string]bool{}
+	for _, ref := range vs.Spec.GetGateways() {
+		refs[ref] = true
+	}
+	for _, route := range vs.Spec.GetHttp() {
+		for _, match := range route.GetMatch() {
+			for _, ref := range match.GetGateways() {
+				refs[ref] = true
+			}
+		}
+	}
+	gateways := make([]string, 0, len(refs))
+	for ref := range refs {
+		if ref != meshGateway {
+			gateways = append(gateways, ref)
+		}
+	}
+	sort.Strings(gateways)
+	return gateways
+}
+
+// gatewaySelectorNotes returns the notes of the Gateways whose selector
+// matches no pod
+func gatewaySelectorNotes(r gatewayResources) []*apiv1.Note {
+	notes := []*apiv1.Note{}
+	for _, gw := range r.gateways {
+		if len(r.gatewayPods(gw)) > 0 {
+			continue
+		}
+		notes = append(notes, &apiv1.Note{
+			Type:    unmatchedGatewayNoteType,
+			Summary: unmatchedGatewaySummary,
+			Msg:     unmatchedGatewayMsg,
+			Level:   apiv1.NoteLevel_ERROR,
+			Attr: map[string]string{
+				"gateway_name": gw.Name,
+				"namespace":    gw.Namespace,
+				"selector":     formatSelector(gw.Spec.GetSelector()),
+			},
+		})
+	}
+	return computeNoteIDs(notes)
+}
+
+// gatewayReferenceNotes returns the notes of the VirtualServices bound to
+// missing Gateways, or to Gateways which do not serve their hosts
+func gatewayReferenceNotes(r gatewayResources) []*apiv1.Note {
+	notes := []*apiv1.Note{}
+	for _, vs := range r.virtualServices {
+		var missing []string
+		for _, ref := range virtualServiceGateways(vs) {
+			gw := r.gateway(ref, vs.Namespace)
+			if gw == nil {
+				missing = append(missing, ref)
+				continue
+			}
+			var unbound []string
+			for _, host := range vs.Spec.GetHosts() {
+				bound := false
+				for _, server := range gw.Spec.GetServers() {
+					bound = bound || serverBindsHost(server, gw.Namespace, host, vs.Namespace)
+				}
+				if !bound {
+					unbound = append(unbound, host)
+				}
+			}
+			if len(unbound) > 0 {
+				notes = append(notes, &apiv1.Note{
+					Type:    unboundHostNoteType,
+					Summary: unboundHostSummary,
+					Msg:     unboundHostMsg,
+					Level:   apiv1.NoteLevel_WARNING,
+					Attr: map[string]string{
+						"vs_name":       vs.Name,
+						"namespace":     vs.Namespace,
+						"gateway":       gw.Namespace + "/" + gw.Name,
+						"hostname_list": strings.Join(unbound, ","),
+					},
+				})
+			}
+		}
+		if len(missing) > 0 {
+			notes = append(notes, &apiv1.Note{
+				Type:    missingGatewayNoteType,
+				Summary: missingGatewaySummary,
+				Msg:     missingGatewayMsg,
+				Level:   apiv1.NoteLevel_ERROR,
+				Attr: map[string]string{
+					"vs_name":      vs.Name,
+					"namespace":    vs.Namespace,
+					"gateway_list": strings.Join(missing, ","),
+				},
+			})
+		}
+	}
+	return computeNoteIDs(notes)
+}
+
+// gatewayHostOverlapNotes returns the notes of the pairs of Gateways
+// applied to the same pods which serve the same hosts on the same port
+func gatewayHostOverlapNotes(r gatewayResources) []*apiv1.Note {
+	notes := []*apiv1.Note{}
+	for i, gw := range r.gateways {
+		pods := map[string]bool{}
+		for _, pod := range r.gatewayPods(gw) {
+			pods[pod.Namespace+"/"+pod.Name] = true
+		}
+		for _, other := range r.gateways[i+1:] {
+			shared := false
+			for _, pod := range r.gatewayPods(other) {
+				shared = shared || pods[pod.Namespace+"/"+pod.Name]
+			}
+			if !shared {
+				continue
+			}
+			overlaps := map[uint32]map[string]bool{}
+			for _, server := range gw.Spec.GetServers() {
+				for _, otherServer := range other.Spec.GetServers() {
+					port := server.GetPort().GetNumber()
+					if port != otherServer.GetPort().GetNumber() {
+						continue
+					}
+					for _, host := range server.GetHosts() {
+						for _, otherHost := range otherServer.GetHosts() {
+							if hostsOverlap(strippedHost(host), strippedHost(otherHost)) {
+								if overlaps[port] == nil {
+									overlaps[port] = map[string]bool{}
+								}
+								overlaps[port][strippedHost(host)] = true
+							}
+						}
+					}
+				}
+			}
+			ports := make([]int, 0, len(overlaps))
+			for port := range overlaps {
+				ports = append(ports, int(port))
+			}
+			sort.Ints(ports)
+			for _, port := range ports {
+				hosts := make([]string, 0, len(overlaps[uint32(port)]))
+				for host := range overlaps[uint32(port)] {
+					hosts = append(hosts, host)
+				}
+				sort.Strings(hosts)
+				notes = append(notes, &apiv1.Note{
+					Type:    overlappingGatewayNoteType,
+					Summary: overlappingGatewaySummary,
+					Msg:     overlappingGatewayMsg,
+					Level:   apiv1.NoteLevel_WARNING,
+					Attr: map[string]string{
+						"gateway_name":  gw.Namespace + "/" + gw.Name,
+						"other_gateway": other.Namespace + "/" + other.Name,
+						"port":          fmt.Sprint(port),
+						"hostname_list": strings.Join(hosts, ","),
+					},
+				})
+			}
+		}
+	}
+	return computeNoteIDs(notes)
+}
+
+// strippedHost returns the host of a server without its namespace
+func strippedHost(host string) string {
+	if parts := strings.SplitN(host, "/", 2); len(parts) == 2 {
+		return parts[1]
+	}
+	return host
+}
+
+// tlsCredential returns the credential of the TLS server, if it reads one
+func tlsCredential(server *networkingapi.Server) string {
+	tls := server.GetTls()
+	switch tls.GetMode() {
+	case networkingapi.ServerTLSSettings_SIMPLE, networkingapi.ServerTLSSettings_MUTUAL:
+		return tls.GetCredentialName()
+	}
+	return ""
+}
+
+// gatewayNamespaces returns the namespaces of the gateway pods the Gateway
+// is applied to, where the gateways read its credentials from
+func (r gatewayResources) gatewayNamespaces(gw *networkingclient.Gateway) []string {
+	namespaces := map[string]bool{}
+	for _, pod := range r.gatewayPods(gw) {
+		namespaces[pod.Namespace] = true
+	}
+	list := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		list = append(list, ns)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// referencedSecrets returns the namespace/name of the TLS credentials the
+// gateways read for the Gateways
+func (r gatewayResources) referencedSecrets() []string {
+	refs := map[string]bool{}
+	for _, gw := range r.gateways {
+		namespaces := r.gatewayNamespaces(gw)
+		for _, server := range gw.Spec.GetServers() {
+			if credential := tlsCredential(server); credential != "" {
+				for _, ns := range namespaces {
+					refs[ns+"/"+credential] = true
+				}
+			}
+		}
+	}
+	list := make([]string, 0, len(refs))
+	for ref := range refs {
+		list = append(list, ref)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// gatewayTLSSecretNotes returns the notes of the TLS servers whose
+// credential is missing from the namespaces of the gateway pods, where the
+// gateways read them from
+func gatewayTLSSecretNotes(r gatewayResources) []*apiv1.Note {
+	notes := []*apiv1.Note{}
+	for _, gw := range r.gateways {
+		namespaces := r.gatewayNamespaces(gw)
+		for _, server := range gw.Spec.GetServers() {
+			credential := tlsCredential(server)
+			if credential == "" {
+				continue
+			}
+			var missing []string
+			for _, ns := range namespaces {
+				if !r.secrets[ns+"/"+credential] {
+					missing = append(missing, ns)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+			notes = append(notes, &apiv1.Note{
+				Type:    missingTLSSecretNoteType,
+				Summary: missingTLSSecretSummary,
+				Msg:     missingTLSSecretMsg,
+				Level:   apiv1.NoteLevel_ERROR,
+				Attr: map[string]string{
+					"gateway_name":   gw.Name,
+					"namespace":      gw.Namespace,
+					"port":           fmt.Sprint(server.GetPort().GetNumber()),
+					"secret":         credential,
+					"namespace_list": strings.Join(missing, ","),
+				},
+			})
+		}
+	}
+	return computeNoteIDs(notes)
+}
+
+// gatewayVetter is a vetter of the Gateways and of the VirtualServices bound
+// to them
+type gatewayVetter struct {
+	id    string
+	notes func(gatewayResources) []*apiv1.Note
+
+	gwLister  networkinglisters.GatewayLister
+	vsLister  networkinglisters.VirtualServiceLister
+	podLister corelisters.PodLister
+	// secretClient looks up the referenced TLS credentials one by one,
+	// rather than caching every secret of the cluster. Only set for the
+	// vetter of the credentials.
+	secretClient corev1client.SecretsGetter
+}
+
+func newGatewayVetter(factory vetter.ResourceListGetter, id string, notes func(gatewayResources) []*apiv1.Note) *gatewayVetter {
+	return &gatewayVetter{
+		id:        id,
+		notes:     notes,
+		gwLister:  factory.Istio().Networking().V1beta1().Gateways().Lister(),
+		vsLister:  factory.Istio().Networking().V1beta1().VirtualServices().Lister(),
+		podLister: factory.K8s().Core().V1().Pods().Lister(),
+	}
+}
+
+// newGatewayVetters returns the vetters of the Gateways
+func newGatewayVetters(factory vetter.ResourceListGetter, secretClient corev1client.SecretsGetter) []vetter.Vetter {
+	tlsSecretVetter := newGatewayVetter(factory, gatewayTLSSecretVetterID, gatewayTLSSecretNotes)
+	tlsSecretVetter.secretClient = secretClient
+	return []vetter.Vetter{
+		newGatewayVetter(factory, gatewaySelectorVetterID, gatewaySelectorNotes),
+		newGatewayVetter(factory, gatewayReferenceVetterID, gatewayReferenceNotes),
+		newGatewayVetter(factory, gatewayHostVetterID, gatewayHostOverlapNotes),
+		tlsSecretVetter,
+	}
+}
+
+// Vet returns the notes of the vetter
+func (v *gatewayVetter) Vet() ([]*apiv1.Note, error) {
+	var r gatewayResources
+	var err error
+	if r.gateways, err = v.gwLister.List(labels.Everything()); err != nil {
+		return nil, err
+	}
+	if r.virtualServices, err = v.vsLister.List(labels.Everything()); err != nil {
+		return nil, err
+	}
+	if r.pods, err = v.podLister.List(labels.Everything()); err != nil {
+		return nil, err
+	}
+	if v.secretClient != nil {
+		if r.secrets, err = v.existingSecrets(r.referencedSecrets()); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(r.gateways, func(i, j int) bool {
+		return r.gateways[i].Namespace+"/"+r.gateways[i].Name < r.gateways[j].Namespace+"/"+r.gateways[j].Name
+	})
+	return v.notes(r), nil
+}
+
+// existingSecrets tells which of the secrets, given as namespace/name,
+// exist
+func (v *gatewayVetter) existingSecrets(refs []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	for _, ref := range refs {
+		parts := strings.SplitN(ref, "/", 2)
+		_, err := v.secretClient.Secrets(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+		if kubeerror.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing[ref] = true
+	}
+	return existing, nil
+}
+
+// Info returns the information of the vetter
+func (v *gatewayVetter) Info() *apiv1.Info {
+	return &apiv1.Info{Id: v.id, Version: nativeVetterVersion}
+}
@@ -0,0 +1,255 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	networkingapi "istio.io/api/networking/v1beta1"
+	networkingclient "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testGateway(namespace, name string, selector map[string]string, servers ...*networkingapi.Server) *networkingclient.Gateway {
+	return &networkingclient.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       networkingapi.Gateway{Selector: selector, Servers: servers},
+	}
+}
+
+func testServer(port uint32, credentialName string, hosts ...string) *networkingapi.Server {
+	server := &networkingapi.Server{Port: &networkingapi.Port{Number: port, Name: "http", Protocol: "HTTP"}, Hosts: hosts}
+	if credentialName != "" {
+		server.Port.Protocol = "HTTPS"
+		server.Tls = &networkingapi.ServerTLSSettings{Mode: networkingapi.ServerTLSSettings_SIMPLE, CredentialName: credentialName}
+	}
+	return server
+}
+
+func testVirtualService(namespace, name string, hosts []string, gateways ...string) *networkingclient.VirtualService {
+	return &networkingclient.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       networkingapi.VirtualService{Hosts: hosts, Gateways: gateways},
+	}
+}
+
+// noteKeys returns the type and the given attribute of the notes
+func noteKeys(notes []*apiv1.Note, attr string) []string {
+	var keys []string
+	for _, note := range notes {
+		keys = append(keys, note.Type+" "+note.Attr[attr])
+	}
+	return keys
+}
+
+var ingressGateway = map[string]string{"istio": "ingressgateway"}
+
+func testGatewayPods() []*corev1.Pod {
+	return []*corev1.Pod{
+		testPod("istio-system", "istio-ingressgateway-0", true, map[string]string{"istio": "ingressgateway", "app": "istio-ingressgateway"}),
+		testPod("bookinfo", "productpage-v1", true, map[string]string{"app": "productpage"}),
+	}
+}
+
+func TestGatewaySelectorNotes(t *testing.T) {
+	tests := []struct {
+		name string
+		pods []*corev1.Pod
+		want []string
+	}{
+		{
+			name: "ingress gateway installed",
+			pods: testGatewayPods(),
+		},
+		{
+			name: "minimal profile",
+			pods: testGatewayPods()[1:],
+			want: []string{unmatchedGatewayNoteType + " bookinfo-gateway"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gatewayResources{
+				gateways: []*networkingclient.Gateway{testGateway("bookinfo", "bookinfo-gateway", ingressGateway, testServer(80, "", "*"))},
+				pods:     tt.pods,
+			}
+			if got := noteKeys(gatewaySelectorNotes(r), "gateway_name"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gatewaySelectorNotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayReferenceNotes(t *testing.T) {
+	r := gatewayResources{
+		gateways: []*networkingclient.Gateway{
+			testGateway("bookinfo", "bookinfo-gateway", ingressGateway, testServer(80, "", "bookinfo.example.com")),
+			testGateway("istio-system", "shared-gateway", ingressGateway, testServer(80, "", "shop/*.example.com")),
+		},
+		pods: testGatewayPods(),
+	}
+	tests := []struct {
+		name string
+		vs   *networkingclient.VirtualService
+		want []string
+	}{
+		{
+			name: "gateway of the namespace",
+			vs:   testVirtualService("bookinfo", "bookinfo", []string{"bookinfo.example.com"}, "bookinfo-gateway", "mesh"),
+		},
+		{
+			name: "gateway of another namespace",
+			vs:   testVirtualService("shop", "shop", []string{"shop.example.com"}, "istio-system/shared-gateway"),
+		},
+		{
+			name: "deprecated fully qualified reference",
+			vs:   testVirtualService("shop", "shop", []string{"shop.example.com"}, "shared-gateway.istio-system.svc.cluster.local"),
+		},
+		{
+			name: "gateway missing from the namespace of the VirtualService",
+			vs:   testVirtualService("shop", "shop", []string{"shop.example.com"}, "shared-gateway"),
+			want: []string{missingGatewayNoteType + " shop"},
+		},
+		{
+			name: "namespace not allowed by the server",
+			vs:   testVirtualService("bookinfo", "reviews", []string{"reviews.example.com"}, "istio-system/shared-gateway"),
+			want: []string{unboundHostNoteType + " reviews"},
+		},
+		{
+			name: "host not served",
+			vs:   testVirtualService("bookinfo", "ratings", []string{"ratings.example.com"}, "bookinfo-gateway"),
+			want: []string{unboundHostNoteType + " ratings"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.virtualServices = []*networkingclient.VirtualService{tt.vs}
+			if got := noteKeys(gatewayReferenceNotes(r), "vs_name"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gatewayReferenceNotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayHostOverlapNotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		gateways []*networkingclient.Gateway
+		want     []string
+	}{
+		{
+			name: "wildcard and host on the same port",
+			gateways: []*networkingclient.Gateway{
+				testGateway("bookinfo", "bookinfo-gateway", ingressGateway, testServer(443, "bookinfo-cert", "bookinfo.example.com")),
+				testGateway("istio-system", "wildcard-gateway", ingressGateway, testServer(443, "wildcard-cert", "*/*.example.com")),
+			},
+			want: []string{overlappingGatewayNoteType + " 443"},
+		},
+		{
+			name: "distinct ports",
+			gateways: []*networkingclient.Gateway{
+				testGateway("bookinfo", "bookinfo-gateway", ingressGateway, testServer(80, "", "*")),
+				testGateway("istio-system", "tls-gateway", ingressGateway, testServer(443, "cert", "*")),
+			},
+		},
+		{
+			name: "distinct gateway pods",
+			gateways: []*networkingclient.Gateway{
+				testGateway("bookinfo", "bookinfo-gateway", ingressGateway, testServer(80, "", "*")),
+				testGateway("bookinfo", "productpage-gateway", map[string]string{"app": "productpage"}, testServer(80, "", "*")),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gatewayResources{gateways: tt.gateways, pods: testGatewayPods()}
+			if got := noteKeys(gatewayHostOverlapNotes(r), "port"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gatewayHostOverlapNotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayTLSSecretNotes(t *testing.T) {
+	r := gatewayResources{
+		gateways: []*networkingclient.Gateway{
+			testGateway("bookinfo", "bookinfo-gateway", ingressGateway,
+				testServer(80, "", "*"),
+				testServer(443, "bookinfo-cert", "bookinfo.example.com"),
+				testServer(8443, "shop-cert", "shop.example.com"),
+			),
+		},
+		pods: testGatewayPods(),
+	}
+	tests := []struct {
+		name    string
+		secrets map[string]bool
+		want    []string
+	}{
+		{
+			name:    "credentials in the namespace of the gateway pods",
+			secrets: map[string]bool{"istio-system/bookinfo-cert": true, "istio-system/shop-cert": true},
+		},
+		{
+			name:    "credential in the namespace of the Gateway",
+			secrets: map[string]bool{"bookinfo/bookinfo-cert": true, "istio-system/shop-cert": true},
+			want:    []string{missingTLSSecretNoteType + " bookinfo-cert"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.secrets = tt.secrets
+			if got := noteKeys(gatewayTLSSecretNotes(r), "secret"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gatewayTLSSecretNotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayVetter_existingSecrets(t *testing.T) {
+	r := gatewayResources{
+		gateways: []*networkingclient.Gateway{
+			testGateway("bookinfo", "bookinfo-gateway", ingressGateway,
+				testServer(80, "", "*"),
+				testServer(443, "bookinfo-cert", "bookinfo.example.com"),
+				testServer(8443, "shop-cert", "shop.example.com"),
+			),
+		},
+		pods: testGatewayPods(),
+	}
+	refs := r.referencedSecrets()
+	if want := []string{"istio-system/bookinfo-cert", "istio-system/shop-cert"}; !reflect.DeepEqual(refs, want) {
+		t.Fatalf("gatewayResources.referencedSecrets() = %v, want %v", refs, want)
+	}
+
+	client := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bookinfo-cert", Namespace: "istio-system"}})
+	v := &gatewayVetter{secretClient: client.CoreV1()}
+	got, err := v.existingSecrets(refs)
+	if err != nil {
+		t.Fatalf("gatewayVetter.existingSecrets() error = %v", err)
+	}
+	if want := map[string]bool{"istio-system/bookinfo-cert": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gatewayVetter.existingSecrets() = %v, want %v", got, want)
+	}
+}
+
+func TestHostsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"bookinfo.example.com", "bookinfo.example.com", true},
+		{"*", "bookinfo.example.com", true},
+		{"*.example.com", "bookinfo.example.com", true},
+		{"bookinfo.example.com", "*.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"bookinfo.example.com", "shop.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := hostsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("hostsOverlap(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	rateLimitServiceFile = "file://templates/ratelimit/ratelimit.yaml"
+	rateLimitService     = "ratelimit"
+	rateLimitRedis       = "redis"
+	rateLimitConfigMap   = "ratelimit-config"
+	// rateLimitDomainsAnnotation records on the ConfigMap the global rate
+	// limit which configured each domain
+	rateLimitDomainsAnnotation = "meshery.io/ratelimit-domains"
+	rateLimitServiceGRPCPort   = 8081
+	rateLimitServiceHTTPPort   = "8080"
+	rateLimitFilter            = "envoy.filters.http.ratelimit"
+	rateLimitTypeURL           = "type.googleapis.com/envoy.extensions.filters.http.ratelimit.v3.RateLimit"
+	rateLimitHealthCheckRetry  = 30 // number of health checks of the rate limit service before giving up
+)
+
+// globalRateLimitDescriptor limits the requests by the value of a request
+// header, across every proxy sending its requests to the service
+type globalRateLimitDescriptor struct {
+	Header string `yaml:"header"`
+	// Value limits only the requests with this value, every value is
+	// limited on its own when empty
+	Value           string `yaml:"value,omitempty"`
+	Unit            string `yaml:"unit"`
+	RequestsPerUnit int    `yaml:"requestsPerUnit"`
+}
+
+// globalRateLimit are the parameters of the global rate limit operation
+type globalRateLimit struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Domain of the descriptors in the rate limit service
+	Domain string `yaml:"domain"`
+	// ServiceNamespace is where the rate limit service and Redis run
+	ServiceNamespace string `yaml:"serviceNamespace"`
+	// Gateway applies the limits on the gateway matching the selector, in
+	// GatewayNamespace, rather than on the sidecars of the workloads. The
+	// selector defaults to the one of the default ingress gateway.
+	Gateway          bool                        `yaml:"gateway,omitempty"`
+	GatewayNamespace string                      `yaml:"gatewayNamespace,omitempty"`
+	Selector         map[string]string           `yaml:"selector,omitempty"`
+	Descriptors      []globalRateLimitDescriptor `yaml:"descriptors"`
+	// FailureModeDeny rejects the requests when the service is unreachable
+	FailureModeDeny bool   `yaml:"failureModeDeny,omitempty"`
+	Timeout         string `yaml:"timeout,omitempty"`
+}
+
+func defaultGlobalRateLimit() globalRateLimit {
+	return globalRateLimit{
+		Name:             "global-rate-limit",
+		Domain:           "meshery-ratelimit",
+		ServiceNamespace: ingressGatewayNamespace,
+		GatewayNamespace: ingressGatewayNamespace,
+		Timeout:          "10s",
+	}
+}
+
+func (g globalRateLimit) validate() error {
+	if errs := validation.IsDNS1123Subdomain(g.Name); len(errs) > 0 {
+		return ErrRateLimit(fmt.Errorf("invalid name %q: %s", g.Name, strings.Join(errs, ", ")))
+	}
+	if g.Domain == "" || g.ServiceNamespace == "" {
+		return ErrRateLimit(fmt.Errorf("domain and serviceNamespace are required"))
+	}
+	if errs := validation.IsConfigMapKey(domainConfigKey(g.Domain)); len(errs) > 0 {
+		return ErrRateLimit(fmt.Errorf("invalid domain %q: %s", g.Domain, strings.Join(errs, ", ")))
+	}
+	if _, err := time.ParseDuration(g.Timeout); err != nil {
+		return ErrRateLimit(fmt.Errorf("invalid timeout: %w", err))
+	}
+	if len(g.Descriptors) == 0 {
+		return ErrRateLimit(fmt.Errorf("at least one descriptor is required"))
+	}
+	for _, d := range g.Descriptors {
+		if d.Header == "" {
+			return ErrRateLimit(fmt.Errorf("descriptors require a header"))
+		}
+		switch d.Unit {
+		case "second", "minute", "hour", "day":
+		default:
+			return ErrRateLimit(fmt.Errorf("invalid unit %q for %s, use second, minute, hour or day", d.Unit, d.Header))
+		}
+		if d.RequestsPerUnit < 0 {
+			return ErrRateLimit(fmt.Errorf("requestsPerUnit of %s cannot be negative", d.Header))
+		}
+	}
+	return nil
+}
+
+// local returns the local rate limit sharing the target of the global one
+func (g globalRateLimit) local() localRateLimit {
+	return localRateLimit{Name: g.Name, Gateway: g.Gateway, GatewayNamespace: g.GatewayNamespace, Selector: g.Selector}
+}
+
+// domainConfig returns the descriptors of the domain in the format read by
+// the rate limit service
+func (g globalRateLimit) domainConfig() (string, error) {
+	var descriptors []interface{}
+	for _, d := range g.Descriptors {
+		descriptor := map[string]interface{}{
+			"key": descriptorKey(d.Header),
+			"rate_limit": map[string]interface{}{
+				"unit":              d.Unit,
+				"requests_per_unit": d.RequestsPerUnit,
+			},
+		}
+		if d.Value != "" {
+			descriptor["value"] = d.Value
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	config, err := yaml.Marshal(map[string]interface{}{
+		"domain":      g.Domain,
+		"descriptors": descriptors,
+	})
+	if err != nil {
+		return "", ErrRateLimit(err)
+	}
+	return string(config), nil
+}
+
+// domainConfigKey is the key of the ConfigMap holding the descriptors of the
+// domain. Each key is a file of the configuration directory of the service.
+func domainConfigKey(domain string) string {
+	return domain + ".yaml"
+}
+
+// rateLimitDomainOwners returns the name of the global rate limit which
+// configured each domain of the ConfigMap
+func rateLimitDomainOwners(cm *corev1.ConfigMap) (map[string]string, error) {
+	owners := map[string]string{}
+	if raw, ok := cm.Annotations[rateLimitDomainsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &owners); err != nil {
+			return nil, ErrRateLimit(err)
+		}
+	}
+	return owners, nil
+}
+
+func setRateLimitDomainOwners(cm *corev1.ConfigMap, owners map[string]string) error {
+	byt, err := json.Marshal(owners)
+	if err != nil {
+		return ErrRateLimit(err)
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[rateLimitDomainsAnnotation] = string(byt)
+	return nil
+}
+
+// addDomainConfig sets the descriptors of the domain of the limit in the
+// ConfigMap, next to the domains of the other limits. A domain is owned by
+// the limit which configured it first.
+func addDomainConfig(cm *corev1.ConfigMap, g globalRateLimit) error {
+	owners, err := rateLimitDomainOwners(cm)
+	if err != nil {
+		return err
+	}
+	if owner, ok := owners[g.Domain]; ok && owner != g.Name {
+		return ErrRateLimit(fmt.Errorf("domain %s is already configured by the global rate limit %s", g.Domain, owner))
+	}
+	config, err := g.domainConfig()
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[domainConfigKey(g.Domain)] = config
+	owners[g.Domain] = g.Name
+	return setRateLimitDomainOwners(cm, owners)
+}
+
+// removeDomainConfig removes the descriptors of the domain of the limit from
+// the ConfigMap, and reports whether domains of other limits are left
+func removeDomainConfig(cm *corev1.ConfigMap, g globalRateLimit) (bool, error) {
+	owners, err := rateLimitDomainOwners(cm)
+	if err != nil {
+		return false, err
+	}
+	if owner, ok := owners[g.Domain]; ok && owner != g.Name {
+		return false, ErrRateLimit(fmt.Errorf("domain %s is configured by the global rate limit %s", g.Domain, owner))
+	}
+	delete(cm.Data, domainConfigKey(g.Domain))
+	delete(owners, g.Domain)
+	if err := setRateLimitDomainOwners(cm, owners); err != nil {
+		return false, err
+	}
+	return len(cm.Data) > 0, nil
+}
+
+// filters renders the EnvoyFilters inserting the rate limit filter, which
+// calls the service, and the actions generating the descriptors on routes
+func (g globalRateLimit) filters(namespace string, version minorVersion) (string, error) {
+	ns, context := g.local().target(namespace)
+	timeout, _ := time.ParseDuration(g.Timeout)
+	cluster := fmt.Sprintf("outbound|%d||%s.%s.svc.cluster.local", rateLimitServiceGRPCPort, rateLimitService, g.ServiceNamespace)
+	config := map[string]interface{}{
+		"domain":            g.Domain,
+		"failure_mode_deny": g.FailureModeDeny,
+		"timeout":           fmt.Sprintf("%gs", timeout.Seconds()),
+		"rate_limit_service": map[string]interface{}{
+			"grpc_service": map[string]interface{}{
+				"envoy_grpc": map[string]interface{}{
+					"cluster_name": cluster,
+					"authority":    fmt.Sprintf("%s.%s.svc.cluster.local", rateLimitService, g.ServiceNamespace),
+				},
+			},
+			"transport_api_version": "V3",
+		},
+	}
+
+	headers := make([]string, 0, len(g.Descriptors))
+	for _, d := range g.Descriptors {
+		headers = append(headers, d.Header)
+	}
+	patches := map[string]map[string]interface{}{
+		g.Name: {
+			"applyTo": "HTTP_FILTER",
+			"match": map[string]interface{}{
+				"context": context,
+				"listener": map[string]interface{}{
+					"filterChain": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"name":      httpConnectionManager,
+							"subFilter": map[string]interface{}{"name": "envoy.filters.http.router"},
+						},
+					},
+				},
+			},
+			"patch": map[string]interface{}{
+				"operation": "INSERT_BEFORE",
+				"value": map[string]interface{}{
+					"name":         rateLimitFilter,
+					"typed_config": typedConfig(version, rateLimitTypeURL, config),
+				},
+			},
+		},
+		g.Name + "-actions": {
+			"applyTo": "VIRTUAL_HOST",
+			"match": map[string]interface{}{
+				"context": context,
+				"routeConfiguration": map[string]interface{}{
+					"vhost": map[string]interface{}{
+						"route": map[string]interface{}{"action": "ANY"},
+					},
+				},
+			},
+			"patch": map[string]interface{}{
+				"operation": "MERGE",
+				"value": map[string]interface{}{
+					"rate_limits": headerRateLimitActions(headers),
+				},
+			},
+		},
+	}
+
+	var docs []string
+	for _, name := range []string{g.Name, g.Name + "-actions"} {
+		spec := map[string]interface{}{"configPatches": []interface{}{patches[name]}}
+		if selector := g.local().workloadSelector(); len(selector) > 0 {
+			spec["workloadSelector"] = map[string]interface{}{"labels": selector}
+		}
+		byt, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": envoyFilterAPIVersion,
+			"kind":       "EnvoyFilter",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": ns,
+			},
+			"spec": spec,
+		})
+		if err != nil {
+			return "", ErrRateLimit(err)
+		}
+		docs = append(docs, string(byt))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// configureGlobalRateLimit installs/uninstalls the rate limit service, with
+// its Redis backend and the descriptors of the domain, and the EnvoyFilters
+// sending the requests of the proxies to it
+//
+// The filters are applied once the service answers its health check, so
+// that requests are never sent to a service which is not running. The
+// service is shared by the limits, each domain being a key of its ConfigMap,
+// and is only removed along with the last domain.
+func (istio *Istio) configureGlobalRateLimit(namespace string, del bool, limit globalRateLimit, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if !del {
+		if err := limit.validate(); err != nil {
+			return st, nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureGlobalRateLimitOnSingleCluster(namespace, del, limit, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrRateLimit(mergeErrors(errs))
+}
+
+func (istio *Istio) configureGlobalRateLimitOnSingleCluster(namespace string, del bool, limit globalRateLimit, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	filterNamespace, _ := limit.local().target(namespace)
+	service := adapter.Template(rateLimitServiceFile).String()
+	cmClient := mclient.KubeClient.CoreV1().ConfigMaps(limit.ServiceNamespace)
+
+	if del {
+		// filters are removed first so that no proxy calls a deleted service
+		filters, err := limit.filters(namespace, minRateLimitVersion)
+		if err != nil {
+			return msgs, err
+		}
+		if err := istio.applyManifestOnSingleCluster([]byte(filters), true, filterNamespace, mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("EnvoyFilters %s/%s deleted", filterNamespace, limit.Name))
+
+		// the service and Redis are shared by the domains of every limit
+		cm, err := cmClient.Get(context.TODO(), rateLimitConfigMap, metav1.GetOptions{})
+		if err != nil && !kubeerror.IsNotFound(err) {
+			return msgs, ErrRateLimit(err)
+		}
+		if err == nil {
+			remaining, err := removeDomainConfig(cm, limit)
+			if err != nil {
+				return msgs, err
+			}
+			if remaining {
+				if _, err := cmClient.Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+					return msgs, ErrRateLimit(err)
+				}
+				return append(msgs, fmt.Sprintf("domain %s removed, the rate limit service in namespace %s still serves the other domains", limit.Domain, limit.ServiceNamespace)), nil
+			}
+			if err := cmClient.Delete(context.TODO(), rateLimitConfigMap, metav1.DeleteOptions{}); err != nil && !kubeerror.IsNotFound(err) {
+				return msgs, ErrRateLimit(err)
+			}
+		}
+		if err := istio.applyManifestOnSingleCluster([]byte(service), true, limit.ServiceNamespace, mclient); err != nil {
+			return msgs, err
+		}
+		return append(msgs, fmt.Sprintf("rate limit service and Redis removed from namespace %s", limit.ServiceNamespace)), nil
+	}
+
+	version, err := controlPlaneVersion(mclient)
+	if err != nil {
+		return msgs, err
+	}
+	if !version.atLeast(minRateLimitVersion) {
+		return msgs, fmt.Errorf("global rate limiting requires Istio %s or newer, the control plane runs %s", minRateLimitVersion, version)
+	}
+
+	cm, err := cmClient.Get(context.TODO(), rateLimitConfigMap, metav1.GetOptions{})
+	if err != nil && !kubeerror.IsNotFound(err) {
+		return msgs, ErrRateLimit(err)
+	}
+	if err != nil {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: rateLimitConfigMap, Namespace: limit.ServiceNamespace}}
+		if err := addDomainConfig(cm, limit); err != nil {
+			return msgs, err
+		}
+		_, err = cmClient.Create(context.TODO(), cm, metav1.CreateOptions{})
+	} else {
+		if err := addDomainConfig(cm, limit); err != nil {
+			return msgs, err
+		}
+		_, err = cmClient.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return msgs, ErrRateLimit(err)
+	}
+	if err := istio.applyManifestOnSingleCluster([]byte(service), false, limit.ServiceNamespace, mclient); err != nil {
+		return msgs, err
+	}
+	if err := waitForDeployments(mclient, limit.ServiceNamespace, []string{rateLimitRedis, rateLimitService}); err != nil {
+		return msgs, err
+	}
+	if err := checkRateLimitService(mclient, limit.ServiceNamespace); err != nil {
+		return msgs, err
+	}
+	msgs = append(msgs, fmt.Sprintf("rate limit service running in namespace %s with %d descriptors in domain %s", limit.ServiceNamespace, len(limit.Descriptors), limit.Domain))
+
+	filters, err := limit.filters(namespace, version)
+	if err != nil {
+		return msgs, err
+	}
+	if err := istio.applyManifestOnSingleCluster([]byte(filters), false, filterNamespace, mclient); err != nil {
+		return msgs, err
+	}
+	return append(msgs, fmt.Sprintf("EnvoyFilters %s/%s send the requests to the rate limit service (rendered for Istio %s)", filterNamespace, limit.Name, version)), nil
+}
+
+// checkRateLimitService verifies, through the API server proxy, that the
+// rate limit service answers its health check
+func checkRateLimitService(mclient *mesherykube.Client, namespace string) error {
+	var err error
+	for i := 0; i < rateLimitHealthCheckRetry; i++ {
+		_, err = mclient.KubeClient.CoreV1().Services(namespace).
+			ProxyGet("http", rateLimitService, rateLimitServiceHTTPPort, "/healthcheck", nil).
+			DoRaw(context.TODO())
+		if err == nil {
+			return nil
+		}
+		time.Sleep(readinessPollInterval * time.Second)
+	}
+	return fmt.Errorf("rate limit service %s/%s is not reachable: %w", namespace, rateLimitService, err)
+}
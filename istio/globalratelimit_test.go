@@ -0,0 +1,173 @@
+package istio
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const testGlobalRateLimitParams = `
+gateway: true
+descriptors:
+- header: ":path"
+  value: /productpage
+  unit: minute
+  requestsPerUnit: 1
+- header: ":path"
+  unit: minute
+  requestsPerUnit: 100
+- header: x-user
+  unit: second
+  requestsPerUnit: 10
+`
+
+func TestGlobalRateLimit_domainConfig(t *testing.T) {
+	limit := defaultGlobalRateLimit()
+	if err := parseOperationParams(testGlobalRateLimitParams, &limit); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	if err := limit.validate(); err != nil {
+		t.Fatalf("globalRateLimit.validate() error = %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := addDomainConfig(cm, limit); err != nil {
+		t.Fatalf("addDomainConfig() error = %v", err)
+	}
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(cm.Data["meshery-ratelimit.yaml"]), &config); err != nil {
+		t.Fatalf("invalid service configuration: %v", err)
+	}
+	if config["domain"] != "meshery-ratelimit" {
+		t.Errorf("domain = %v", config["domain"])
+	}
+	descriptors := config["descriptors"].([]interface{})
+	if len(descriptors) != 3 {
+		t.Fatalf("descriptors = %v", descriptors)
+	}
+	first := descriptors[0].(map[string]interface{})
+	if first["key"] != "path" || first["value"] != "/productpage" || first["rate_limit"].(map[string]interface{})["requests_per_unit"] != float64(1) {
+		t.Errorf("descriptor = %v", first)
+	}
+	if _, ok := descriptors[1].(map[string]interface{})["value"]; ok {
+		t.Errorf("descriptor without value = %v", descriptors[1])
+	}
+}
+
+func TestDomainConfig_sharedService(t *testing.T) {
+	first := defaultGlobalRateLimit()
+	first.Descriptors = []globalRateLimitDescriptor{{Header: "x-user", Unit: "second", RequestsPerUnit: 10}}
+	second := first
+	second.Name, second.Domain = "api-rate-limit", "api"
+
+	cm := &corev1.ConfigMap{}
+	for _, limit := range []globalRateLimit{first, second} {
+		if err := addDomainConfig(cm, limit); err != nil {
+			t.Fatalf("addDomainConfig(%s) error = %v", limit.Name, err)
+		}
+	}
+	if len(cm.Data) != 2 {
+		t.Fatalf("ConfigMap keys = %v, want one per domain", cm.Data)
+	}
+
+	conflict := second
+	conflict.Name = "other-rate-limit"
+	if err := addDomainConfig(cm, conflict); err == nil {
+		t.Errorf("addDomainConfig() error = nil, want an error for a domain of another limit")
+	}
+	if _, err := removeDomainConfig(cm, conflict); err == nil {
+		t.Errorf("removeDomainConfig() error = nil, want an error for a domain of another limit")
+	}
+
+	remaining, err := removeDomainConfig(cm, first)
+	if err != nil || !remaining {
+		t.Fatalf("removeDomainConfig(%s) = %v, %v, want true, nil", first.Name, remaining, err)
+	}
+	if _, ok := cm.Data["api.yaml"]; !ok {
+		t.Errorf("domain of %s removed along with %s", second.Name, first.Name)
+	}
+	if remaining, err := removeDomainConfig(cm, second); err != nil || remaining {
+		t.Errorf("removeDomainConfig(%s) = %v, %v, want false, nil", second.Name, remaining, err)
+	}
+}
+
+func TestGlobalRateLimit_filters(t *testing.T) {
+	limit := defaultGlobalRateLimit()
+	if err := parseOperationParams(testGlobalRateLimitParams, &limit); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	manifest, err := limit.filters("bookinfo", minorVersion{Major: 1, Minor: 20})
+	if err != nil {
+		t.Fatalf("globalRateLimit.filters() error = %v", err)
+	}
+	docs := strings.Split(manifest, "---\n")
+	if len(docs) != 2 {
+		t.Fatalf("filters = %d, want 2", len(docs))
+	}
+
+	filter := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(docs[0]), &filter); err != nil {
+		t.Fatalf("invalid filter: %v", err)
+	}
+	if ns := filter["metadata"].(map[string]interface{})["namespace"]; ns != "istio-system" {
+		t.Errorf("namespace = %v, want istio-system", ns)
+	}
+	patch := filter["spec"].(map[string]interface{})["configPatches"].([]interface{})[0].(map[string]interface{})
+	config := patch["patch"].(map[string]interface{})["value"].(map[string]interface{})["typed_config"].(map[string]interface{})
+	if config["@type"] != rateLimitTypeURL || config["domain"] != "meshery-ratelimit" || config["timeout"] != "10s" {
+		t.Errorf("typed_config = %v", config)
+	}
+	cluster := config["rate_limit_service"].(map[string]interface{})["grpc_service"].(map[string]interface{})["envoy_grpc"].(map[string]interface{})["cluster_name"]
+	if cluster != "outbound|8081||ratelimit.istio-system.svc.cluster.local" {
+		t.Errorf("cluster_name = %v", cluster)
+	}
+
+	actions := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(docs[1]), &actions); err != nil {
+		t.Fatalf("invalid actions filter: %v", err)
+	}
+	patch = actions["spec"].(map[string]interface{})["configPatches"].([]interface{})[0].(map[string]interface{})
+	if limits := patch["patch"].(map[string]interface{})["value"].(map[string]interface{})["rate_limits"].([]interface{}); len(limits) != 2 {
+		t.Errorf("rate_limits = %v, want one per header", limits)
+	}
+}
+
+func TestGlobalRateLimit_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{name: "valid", params: testGlobalRateLimitParams, wantErr: false},
+		{name: "no descriptors", params: "{gateway: true}", wantErr: true},
+		{name: "invalid unit", params: "{descriptors: [{header: ':path', unit: week, requestsPerUnit: 1}]}", wantErr: true},
+		{name: "invalid timeout", params: "{timeout: soon, descriptors: [{header: ':path', unit: day, requestsPerUnit: 1}]}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := defaultGlobalRateLimit()
+			if err := parseOperationParams(tt.params, &limit); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := limit.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("globalRateLimit.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundledRateLimitService(t *testing.T) {
+	byt, err := os.ReadFile("../templates/ratelimit/ratelimit.yaml")
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	got := deploymentNames(parseManifestResources(string(byt)))
+	if strings.Join(got, ",") != rateLimitRedis+","+rateLimitService {
+		t.Errorf("deployments = %v, want %s and %s", got, rateLimitRedis, rateLimitService)
+	}
+	if !strings.Contains(string(byt), "name: "+rateLimitConfigMap) {
+		t.Errorf("the rate limit service does not mount %s", rateLimitConfigMap)
+	}
+}
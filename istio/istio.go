@@ -2,8 +2,8 @@ package istio
 
 import (
 	"context"
-	"fmt"
 	stderrors "errors"
+	"fmt"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/common"
@@ -86,10 +86,21 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 			ee.Details = fmt.Sprintf("The Istio service mesh %s is now %s.", version, stat)
 			hh.StreamInfo(ee)
 		}(istio, e)
-	case common.BookInfoOperation, common.HTTPBinOperation, common.ImageHubOperation, common.EmojiVotoOperation:
+	case common.BookInfoOperation, common.HTTPBinOperation, common.ImageHubOperation, common.EmojiVotoOperation,
+		internalconfig.OnlineBoutiqueOperation, internalconfig.HelloWorldOperation, internalconfig.SleepOperation, internalconfig.FortioOperation:
 		go func(hh *Istio, ee *meshes.EventsResponse) {
 			appName := operations[opReq.OperationName].AdditionalProperties[common.ServiceName]
-			stat, err := hh.installSampleApp(opReq.Namespace, opReq.IsDeleteOperation, operations[opReq.OperationName].Templates, kubeConfigs)
+			route := sampleAppRoute{
+				Path:     operations[opReq.OperationName].AdditionalProperties[internalconfig.SampleAppPath],
+				Template: operations[opReq.OperationName].AdditionalProperties[internalconfig.SampleAppGateway],
+			}
+			opts := defaultSampleAppOptions(appName, operations[opReq.OperationName].AdditionalProperties[internalconfig.SampleAppHost])
+			err := parseOperationParams(opReq.CustomBody, &opts)
+			stat := status.Installing
+			var urls []string
+			if err == nil {
+				stat, urls, err = hh.installSampleApp(opReq.Namespace, opReq.IsDeleteOperation, route, opts, operations[opReq.OperationName].Templates, kubeConfigs)
+			}
 			if err != nil {
 				ee.Summary = fmt.Sprintf("Error while %s Istio service mesh", stat)
 				ee.Details = err.Error()
@@ -101,6 +112,9 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 			}
 			ee.Summary = fmt.Sprintf("%s application %s successfully", appName, stat)
 			ee.Details = fmt.Sprintf("The %s application is now %s.", appName, stat)
+			for _, url := range urls {
+				ee.Details = fmt.Sprintf("%s\nReachable at %s", ee.Details, url)
+			}
 			hh.StreamInfo(ee)
 		}(istio, e)
 	case common.SmiConformanceOperation:
@@ -129,7 +143,29 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 			ee.Details = ""
 			hh.StreamInfo(ee)
 		}(istio, e)
-	case internalconfig.DenyAllPolicyOperation, internalconfig.StrictMTLSPolicyOperation, internalconfig.MutualMTLSPolicyOperation, internalconfig.DisableMTLSPolicyOperation:
+	case internalconfig.StrictMTLSPolicyOperation, internalconfig.MutualMTLSPolicyOperation, internalconfig.DisableMTLSPolicyOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			policy := defaultMTLSPolicy()
+			err := parseOperationParams(opReq.CustomBody, &policy)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureMTLS(opReq.Namespace, opReq.IsDeleteOperation, mtlsModes[opReq.OperationName], policy, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s policy", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Policy %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.DenyAllPolicyOperation:
 		go func(hh *Istio, ee *meshes.EventsResponse) {
 			stat, err := hh.applyPolicy(opReq.Namespace, opReq.IsDeleteOperation, operations[opReq.OperationName].Templates, kubeConfigs)
 			if err != nil {
@@ -181,18 +217,20 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 			ee.Details = fmt.Sprintf("ISTIO-INJECTION label %s on %s namespace", operation, opReq.Namespace)
 			hh.StreamInfo(ee)
 		}(istio, e)
-	case internalconfig.PrometheusAddon, internalconfig.GrafanaAddon, internalconfig.KialiAddon, internalconfig.JaegerAddon, internalconfig.ZipkinAddon:
+	case internalconfig.PrometheusAddon, internalconfig.GrafanaAddon, internalconfig.KialiAddon, internalconfig.JaegerAddon, internalconfig.ZipkinAddon, internalconfig.OpenTelemetryAddon:
 		go func(hh *Istio, ee *meshes.EventsResponse) {
 			svcname := operations[opReq.OperationName].AdditionalProperties[common.ServiceName]
-			patches := make([]string, 0)
-			patches = append(patches, operations[opReq.OperationName].AdditionalProperties[internalconfig.ServicePatchFile])
-
-			_, err := hh.installAddon(opReq.Namespace, opReq.IsDeleteOperation, svcname, patches, operations[opReq.OperationName].Templates, kubeConfigs)
 			operation := "install"
 			if opReq.IsDeleteOperation {
 				operation = "uninstall"
 			}
 
+			exposure := defaultAddonExposure()
+			err := parseOperationParams(opReq.CustomBody, &exposure)
+			var endpoints []addonEndpoint
+			if err == nil {
+				_, endpoints, err = hh.installAddon(opReq.Namespace, opReq.IsDeleteOperation, svcname, exposure, operations[opReq.OperationName].Templates, kubeConfigs)
+			}
 			if err != nil {
 				ee.Summary = fmt.Sprintf("Error while %sing %s", operation, opReq.OperationName)
 				ee.Details = err.Error()
@@ -204,6 +242,364 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 			}
 			ee.Summary = fmt.Sprintf("Successfully %sed %s", operation, opReq.OperationName)
 			ee.Details = fmt.Sprintf("Successfully %sed %s from the %s namespace", operation, opReq.OperationName, opReq.Namespace)
+			for _, endpoint := range endpoints {
+				ee.Details = fmt.Sprintf("%s\n%s", ee.Details, endpoint)
+			}
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.ExternalObservabilityOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			backends := defaultObservabilityBackends()
+			err := parseOperationParams(opReq.CustomBody, &backends)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureObservabilityBackends(opReq.IsDeleteOperation, backends, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s observability backends", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Observability backends %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.TelemetryTracingOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			tracing := defaultTelemetryTracing()
+			err := parseOperationParams(opReq.CustomBody, &tracing)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureTelemetryTracing(opReq.IsDeleteOperation, tracing, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s tracing", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Tracing %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.AccessLoggingOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			logging := defaultAccessLogging()
+			err := parseOperationParams(opReq.CustomBody, &logging)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureAccessLogging(opReq.IsDeleteOperation, logging, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s access logging", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Access logging %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.TrafficShiftOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			shift := trafficShift{}
+			err := parseOperationParams(opReq.CustomBody, &shift)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureTrafficShift(opReq.Namespace, opReq.IsDeleteOperation, shift, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s traffic shifting", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Traffic shifting %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.FaultInjectionOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			fault := defaultFaultInjection()
+			err := parseOperationParams(opReq.CustomBody, &fault)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureFaultInjection(opReq.Namespace, opReq.IsDeleteOperation, fault, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s fault injection", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Fault injection %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.CircuitBreakerOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			breaker := circuitBreaker{}
+			err := parseOperationParams(opReq.CustomBody, &breaker)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureCircuitBreaker(opReq.Namespace, opReq.IsDeleteOperation, breaker, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s circuit breaker", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Circuit breaker %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.LocalRateLimitOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			limit := defaultLocalRateLimit()
+			err := parseOperationParams(opReq.CustomBody, &limit)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureLocalRateLimit(opReq.Namespace, opReq.IsDeleteOperation, limit, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s local rate limit", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Local rate limit %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.GlobalRateLimitOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			limit := defaultGlobalRateLimit()
+			err := parseOperationParams(opReq.CustomBody, &limit)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureGlobalRateLimit(opReq.Namespace, opReq.IsDeleteOperation, limit, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s global rate limit", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Global rate limit %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.EnvoyAdminOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			dump := defaultEnvoyDump()
+			err := parseOperationParams(opReq.CustomBody, &dump)
+			stat := status.Running
+			var results []string
+			if err == nil {
+				stat, results, err = hh.dumpEnvoyConfig(opReq.Namespace, dump, kubeConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while retrieving Envoy %s", dump.Resource)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Envoy %s retrieval %s", dump.Resource, stat)
+			ee.Details = mergeMsgs(results)
+			if dump.Output == EnvoyDumpOutputFile {
+				ee.Details = fmt.Sprintf("Saved to:\n%s", ee.Details)
+			}
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.AuthorizationPolicyOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			policy := defaultAuthorizationPolicy()
+			err := parseOperationParams(opReq.CustomBody, &policy)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureAuthorizationPolicy(opReq.Namespace, opReq.IsDeleteOperation, policy, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the AuthorizationPolicy", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("AuthorizationPolicy %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.MTLSMigrationOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			migration := defaultMTLSMigration()
+			err := parseOperationParams(opReq.CustomBody, &migration)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.migrateToStrictMTLS(opReq.Namespace, migration, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the mTLS migration", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("mTLS migration %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.RequestAuthenticationOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			auth := defaultRequestAuthentication()
+			err := parseOperationParams(opReq.CustomBody, &auth)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureRequestAuthentication(opReq.Namespace, opReq.IsDeleteOperation, auth, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the RequestAuthentication", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("RequestAuthentication %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.ExternalAuthorizationOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			authz := defaultExternalAuthorization()
+			err := parseOperationParams(opReq.CustomBody, &authz)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureExternalAuthorization(opReq.Namespace, opReq.IsDeleteOperation, authz, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the external authorization", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("External authorization %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.EgressLockdownOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			lockdown := defaultEgressLockdown()
+			err := parseOperationParams(opReq.CustomBody, &lockdown)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.lockDownEgress(opReq.Namespace, opReq.IsDeleteOperation, lockdown, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the egress lockdown", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Egress lockdown %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.ServiceEntryOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			entries := defaultServiceEntries()
+			err := parseOperationParams(opReq.CustomBody, &entries)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureServiceEntries(opReq.Namespace, opReq.IsDeleteOperation, entries, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the ServiceEntries", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("ServiceEntries %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
+			hh.StreamInfo(ee)
+		}(istio, e)
+	case internalconfig.SidecarGenerationOperation:
+		go func(hh *Istio, ee *meshes.EventsResponse) {
+			generation := defaultSidecarGeneration()
+			err := parseOperationParams(opReq.CustomBody, &generation)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.generateSidecars(opReq.Namespace, opReq.IsDeleteOperation, generation, opReq.K8sConfigs)
+			}
+			if err != nil {
+				ee.Summary = fmt.Sprintf("Error while %s the Sidecars", stat)
+				ee.Details = err.Error()
+				ee.ErrorCode = errors.GetCode(err)
+				ee.ProbableCause = errors.GetCause(err)
+				ee.SuggestedRemediation = errors.GetRemedy(err)
+				hh.StreamErr(ee, err)
+				return
+			}
+			ee.Summary = fmt.Sprintf("Sidecars %s successfully", stat)
+			ee.Details = mergeMsgs(msgs)
 			hh.StreamInfo(ee)
 		}(istio, e)
 	case internalconfig.IstioVetOperation:
@@ -225,13 +621,17 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 
 			istio.Log.Info("Done")
 		}(istio, e)
-	case internalconfig.EnvoyFilterOperation:
+	case internalconfig.WasmPluginOperation:
 		go func(hh *Istio, ee *meshes.EventsResponse) {
-			appName := operations[opReq.OperationName].AdditionalProperties[common.ServiceName]
-			patchFile := operations[opReq.OperationName].AdditionalProperties[internalconfig.FilterPatchFile]
-			stat, err := hh.patchWithEnvoyFilter(opReq.Namespace, opReq.IsDeleteOperation, appName, operations[opReq.OperationName].Templates, patchFile, kubeConfigs)
+			plugin := wasmPlugin{}
+			err := parseOperationParams(opReq.CustomBody, &plugin)
+			stat := status.Deploying
+			var msgs []string
+			if err == nil {
+				stat, msgs, err = hh.configureWasmPlugin(opReq.Namespace, opReq.IsDeleteOperation, plugin, kubeConfigs)
+			}
 			if err != nil {
-				ee.Summary = fmt.Sprintf("Error while %s %s application", stat, appName)
+				ee.Summary = fmt.Sprintf("Error while %s WasmPlugin", stat)
 				ee.Details = err.Error()
 				ee.ErrorCode = errors.GetCode(err)
 				ee.ProbableCause = errors.GetCause(err)
@@ -239,8 +639,8 @@ func (istio *Istio) ApplyOperation(ctx context.Context, opReq adapter.OperationR
 				hh.StreamErr(ee, err)
 				return
 			}
-			ee.Summary = fmt.Sprintf("%s application %s successfully", appName, stat)
-			ee.Details = fmt.Sprintf("The %s application is now %s.", appName, stat)
+			ee.Summary = fmt.Sprintf("WasmPlugin %s %s successfully", plugin.Name, stat)
+			ee.Details = mergeMsgs(msgs)
 			hh.StreamInfo(ee)
 		}(istio, e)
 	default:
@@ -263,11 +263,11 @@ func TestIstio_ApplyOperation(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "Envoy Filter operation",
+			name: "WasmPlugin operation",
 			args: args{
 				ctx: context.TODO(),
 				opReq: adapter.OperationRequest{
-					OperationName:     internalconfig.EnvoyFilterOperation,
+					OperationName:     internalconfig.WasmPluginOperation,
 					Namespace:         "default",
 					IsDeleteOperation: false,
 					OperationID:       "test_id",
@@ -355,6 +355,279 @@ func TestIstio_ApplyOperation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "External observability operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.ExternalObservabilityOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "OpenTelemetry collector addon",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.OpenTelemetryAddon,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Telemetry tracing",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.TelemetryTracingOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Access logging",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.AccessLoggingOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Online Boutique operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.OnlineBoutiqueOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Hello World operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.HelloWorldOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Sleep operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.SleepOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fortio operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.FortioOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Traffic shift",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.TrafficShiftOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fault injection",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.FaultInjectionOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Circuit breaker",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.CircuitBreakerOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Local rate limit operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.LocalRateLimitOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Global rate limit operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.GlobalRateLimitOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Envoy admin operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.EnvoyAdminOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "AuthorizationPolicy operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.AuthorizationPolicyOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "mTLS migration operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.MTLSMigrationOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "RequestAuthentication operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.RequestAuthenticationOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "External authorization operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.ExternalAuthorizationOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Egress lockdown operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.EgressLockdownOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "ServiceEntry operation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.ServiceEntryOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "sidecar generation",
+			args: args{
+				ctx: context.TODO(),
+				opReq: adapter.OperationRequest{
+					OperationName:     internalconfig.SidecarGenerationOperation,
+					Namespace:         "default",
+					IsDeleteOperation: false,
+					OperationID:       "test_id",
+				},
+			},
+			wantErr: false,
+		},
 		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
@@ -0,0 +1,460 @@
+package istio
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+const (
+	jwtKeyBits          = 2048
+	jwtKeySecretKey     = "key.pem"
+	jwtSigningAlgorithm = "RS256"
+)
+
+// reservedTokenClaims are set from the parameters of the operation
+var reservedTokenClaims = []string{"iss", "sub", "aud", "iat", "exp"}
+
+// requestAuthentication are the parameters of the RequestAuthentication
+// operation and trait
+type requestAuthentication struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Gateway authenticates the requests at the gateway selected in the
+	// gateway namespace, the ingress gateway by default
+	Gateway          bool              `yaml:"gateway"`
+	GatewayNamespace string            `yaml:"gatewayNamespace"`
+	Selector         map[string]string `yaml:"selector,omitempty"`
+	Issuer           string            `yaml:"issuer"`
+	// The keys of the issuer are either fetched from JWKSURI, inlined from
+	// JWKS or generated by the adapter and kept in a secret
+	JWKSURI              string   `yaml:"jwksUri,omitempty"`
+	JWKS                 string   `yaml:"jwks,omitempty"`
+	GenerateJWKS         bool     `yaml:"generateJwks"`
+	Audiences            []string `yaml:"audiences,omitempty"`
+	ForwardOriginalToken bool     `yaml:"forwardOriginalToken"`
+	// RequirePrincipal denies the requests without a valid token of the
+	// issuer, which are otherwise accepted
+	RequirePrincipal bool `yaml:"requirePrincipal"`
+	// MintToken returns a token signed with the generated key instead of
+	// applying the configuration
+	MintToken bool                   `yaml:"mintToken"`
+	Subject   string                 `yaml:"subject"`
+	TokenTTL  string                 `yaml:"tokenTtl"`
+	Claims    map[string]interface{} `yaml:"claims,omitempty"`
+}
+
+func defaultRequestAuthentication() requestAuthentication {
+	return requestAuthentication{
+		GatewayNamespace: ingressGatewayNamespace,
+		Subject:          "meshery-test",
+		TokenTTL:         "1h",
+	}
+}
+
+func (r requestAuthentication) validate() error {
+	if r.Name == "" {
+		return ErrRequestAuthentication(fmt.Errorf("a name is required"))
+	}
+	if r.Issuer == "" {
+		return ErrRequestAuthentication(fmt.Errorf("an issuer is required"))
+	}
+	sources := 0
+	for _, set := range []bool{r.JWKSURI != "", r.JWKS != "", r.GenerateJWKS} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return ErrRequestAuthentication(fmt.Errorf("exactly one of jwksUri, jwks and generateJwks is required"))
+	}
+	if r.JWKSURI != "" {
+		u, err := url.Parse(r.JWKSURI)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrRequestAuthentication(fmt.Errorf("invalid jwksUri %s", r.JWKSURI))
+		}
+	}
+	if r.JWKS != "" {
+		var jwks struct {
+			Keys []map[string]interface{} `json:"keys"`
+		}
+		if err := json.Unmarshal([]byte(r.JWKS), &jwks); err != nil || len(jwks.Keys) == 0 {
+			return ErrRequestAuthentication(fmt.Errorf("the jwks is not a JSON Web Key Set"))
+		}
+	}
+	if r.MintToken {
+		if !r.GenerateJWKS {
+			return ErrRequestAuthentication(fmt.Errorf("a token can only be minted with the generated key"))
+		}
+		if ttl, err := time.ParseDuration(r.TokenTTL); err != nil || ttl <= 0 {
+			return ErrRequestAuthentication(fmt.Errorf("invalid tokenTtl %s", r.TokenTTL))
+		}
+		for _, claim := range reservedTokenClaims {
+			if _, ok := r.Claims[claim]; ok {
+				return ErrRequestAuthentication(fmt.Errorf("the %s claim is set from the parameters", claim))
+			}
+		}
+	}
+	return nil
+}
+
+// target returns the namespace of the policies
+func (r requestAuthentication) target(namespace string) string {
+	if r.Gateway {
+		return r.GatewayNamespace
+	}
+	return namespace
+}
+
+// workloadSelector returns the labels of the authenticated workloads,
+// every workload of the namespace when empty
+func (r requestAuthentication) workloadSelector() map[string]string {
+	if r.Gateway && len(r.Selector) == 0 {
+		return map[string]string{"istio": "ingressgateway"}
+	}
+	return r.Selector
+}
+
+func (r requestAuthentication) keySecretName() string {
+	return r.Name + "-jwt-key"
+}
+
+// resource returns the RequestAuthentication in the given namespace, with
+// the inline key set when given
+func (r requestAuthentication) resource(namespace, jwks string) map[string]interface{} {
+	rule := map[string]interface{}{
+		"issuer": r.Issuer,
+	}
+	if r.JWKSURI != "" {
+		rule["jwksUri"] = r.JWKSURI
+	} else {
+		rule["jwks"] = jwks
+	}
+	if len(r.Audiences) > 0 {
+		rule["audiences"] = r.Audiences
+	}
+	if r.ForwardOriginalToken {
+		rule["forwardOriginalToken"] = true
+	}
+	spec := map[string]interface{}{
+		"jwtRules": []interface{}{rule},
+	}
+	if selector := r.workloadSelector(); len(selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": selector}
+	}
+	return map[string]interface{}{
+		"apiVersion": securityAPIVersion,
+		"kind":       "RequestAuthentication",
+		"metadata": map[string]interface{}{
+			"name":      r.Name,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+}
+
+// authorization returns the policy denying the requests which carry no
+// valid token of the issuer
+func (r requestAuthentication) authorization() authorizationPolicy {
+	return authorizationPolicy{
+		Name:     r.Name + "-require-jwt",
+		Selector: r.workloadSelector(),
+		Action:   AuthorizationDeny,
+		Rules: []authorizationRule{
+			{NotRequestPrincipals: []string{r.Issuer + "/*"}},
+		},
+	}
+}
+
+// tokenClaims returns the claims of the test token issued at now
+func (r requestAuthentication) tokenClaims(now time.Time) (map[string]interface{}, error) {
+	ttl, err := time.ParseDuration(r.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	// nested claims are decoded with the keys YAML allows, which JSON does
+	// not, so they are converted first
+	extra := map[string]interface{}{}
+	if len(r.Claims) > 0 {
+		byt, err := yaml.Marshal(r.Claims)
+		if err != nil {
+			return nil, err
+		}
+		if err := k8syaml.Unmarshal(byt, &extra); err != nil {
+			return nil, err
+		}
+	}
+	claims := mergeMaps(extra, map[string]interface{}{
+		"iss": r.Issuer,
+		"sub": r.Subject,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	})
+	if len(r.Audiences) > 0 {
+		claims["aud"] = r.Audiences
+	}
+	return claims, nil
+}
+
+// keyID identifies the public key in the key set and the tokens
+func keyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// jwksFor returns the JSON Web Key Set holding the public key
+func jwksFor(key *rsa.PublicKey) (string, error) {
+	byt, err := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{map[string]interface{}{
+			"kty": "RSA",
+			"alg": jwtSigningAlgorithm,
+			"use": "sig",
+			"kid": keyID(key),
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	return string(byt), err
+}
+
+// signToken returns the JWT of the claims signed with the key
+func signToken(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": jwtSigningAlgorithm,
+		"typ": "JWT",
+		"kid": keyID(&key.PublicKey),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// getJWTKey returns the key kept in the secret, or nil when there is none
+func getJWTKey(mclient *mesherykube.Client, namespace, name string) (*rsa.PrivateKey, error) {
+	secret, err := mclient.KubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(secret.Data[jwtKeySecretKey])
+	if block == nil {
+		return nil, fmt.Errorf("the secret %s/%s holds no PEM encoded key", namespace, name)
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// ensureJWTKey returns the key kept in the secret, and stores the given one
+// when there is none so that the tokens already minted stay valid
+func ensureJWTKey(mclient *mesherykube.Client, namespace, name string, key *rsa.PrivateKey) (*rsa.PrivateKey, error) {
+	existing, err := getJWTKey(mclient, namespace, name)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	_, err = mclient.KubeClient.CoreV1().Secrets(namespace).Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			jwtKeySecretKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		},
+	}, metav1.CreateOptions{})
+	return key, err
+}
+
+// configureRequestAuthentication applies the RequestAuthentication, and the
+// AuthorizationPolicy requiring a token when asked, or mints a test token
+func (istio *Istio) configureRequestAuthentication(namespace string, del bool, auth requestAuthentication, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+		if auth.Name == "" {
+			return st, nil, ErrRequestAuthentication(fmt.Errorf("a name is required"))
+		}
+	} else if err := auth.validate(); err != nil {
+		return st, nil, err
+	}
+
+	if auth.MintToken && !del {
+		return mintTestToken(namespace, auth, kubeconfigs)
+	}
+
+	// the key is generated once so that every cluster trusts the same one,
+	// unless it already has its own
+	var key *rsa.PrivateKey
+	if auth.GenerateJWKS && !del {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, jwtKeyBits); err != nil {
+			return st, nil, ErrRequestAuthentication(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureRequestAuthenticationOnSingleCluster(namespace, del, auth, key, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrRequestAuthentication(mergeErrors(errs))
+}
+
+func (istio *Istio) configureRequestAuthenticationOnSingleCluster(namespace string, del bool, auth requestAuthentication, key *rsa.PrivateKey, mclient *mesherykube.Client) ([]string, error) {
+	ns := auth.target(namespace)
+	policy := auth.authorization()
+	if del {
+		// the content of the resources does not matter to delete them
+		for _, resource := range []map[string]interface{}{auth.resource(ns, ""), policy.resource(ns)} {
+			manifest, err := yaml.Marshal(resource)
+			if err != nil {
+				return nil, err
+			}
+			if err := istio.applyManifestOnSingleCluster(manifest, true, ns, mclient); err != nil {
+				return nil, err
+			}
+		}
+		err := mclient.KubeClient.CoreV1().Secrets(ns).Delete(context.TODO(), auth.keySecretName(), metav1.DeleteOptions{})
+		if err != nil && !kubeerror.IsNotFound(err) {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("RequestAuthentication %s/%s deleted", ns, auth.Name)}, nil
+	}
+
+	version, err := controlPlaneVersion(mclient)
+	if err != nil {
+		return nil, err
+	}
+	jwks := auth.JWKS
+	if auth.GenerateJWKS {
+		if key, err = ensureJWTKey(mclient, ns, auth.keySecretName(), key); err != nil {
+			return nil, err
+		}
+		if jwks, err = jwksFor(&key.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	resource := auth.resource(ns, jwks)
+	if err := validateAgainstMeshmodel("RequestAuthentication", version, resource); err != nil {
+		return nil, err
+	}
+	manifest, err := yaml.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := istio.applyManifestOnSingleCluster(manifest, false, ns, mclient); err != nil {
+		return nil, err
+	}
+	msgs := []string{fmt.Sprintf("RequestAuthentication %s/%s applied for the issuer %s", ns, auth.Name, auth.Issuer)}
+	if auth.GenerateJWKS {
+		msgs = append(msgs, fmt.Sprintf("signing key kept in the secret %s/%s", ns, auth.keySecretName()))
+	}
+
+	// the policy is removed when no longer required
+	policyResource := policy.resource(ns)
+	if auth.RequirePrincipal {
+		if err := validateAgainstMeshmodel("AuthorizationPolicy", version, policyResource); err != nil {
+			return msgs, err
+		}
+	}
+	manifest, err = yaml.Marshal(policyResource)
+	if err != nil {
+		return msgs, err
+	}
+	if err := istio.applyManifestOnSingleCluster(manifest, !auth.RequirePrincipal, ns, mclient); err != nil {
+		return msgs, err
+	}
+	if auth.RequirePrincipal {
+		msgs = append(msgs, fmt.Sprintf("AuthorizationPolicy %s/%s applied, requests without a valid token are denied", ns, policy.Name))
+	}
+	return msgs, nil
+}
+
+// mintTestToken signs a token with the key generated for the
+// RequestAuthentication. The key of the first cluster is used, the clusters
+// share it unless their key predates the others.
+func mintTestToken(namespace string, auth requestAuthentication, kubeconfigs []string) (string, []string, error) {
+	st := status.Running
+	if len(kubeconfigs) == 0 {
+		return st, nil, ErrRequestAuthentication(fmt.Errorf("no cluster to read the signing key from"))
+	}
+	mclient, err := mesherykube.New([]byte(kubeconfigs[0]))
+	if err != nil {
+		return st, nil, ErrRequestAuthentication(err)
+	}
+	ns := auth.target(namespace)
+	key, err := getJWTKey(mclient, ns, auth.keySecretName())
+	if err != nil {
+		return st, nil, ErrRequestAuthentication(err)
+	}
+	if key == nil {
+		return st, nil, ErrRequestAuthentication(fmt.Errorf("no signing key in %s/%s, apply the RequestAuthentication with generateJwks first", ns, auth.keySecretName()))
+	}
+
+	claims, err := auth.tokenClaims(time.Now())
+	if err != nil {
+		return st, nil, ErrRequestAuthentication(err)
+	}
+	token, err := signToken(key, claims)
+	if err != nil {
+		return st, nil, ErrRequestAuthentication(err)
+	}
+	return status.Completed, []string{
+		fmt.Sprintf("token of %s for %s, valid for %s, to send in the header", auth.Issuer, auth.Subject, auth.TokenTTL),
+		"Authorization: Bearer " + token,
+	}, nil
+}
@@ -0,0 +1,170 @@
+package istio
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestAuthentication_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "jwks uri",
+			params: "{name: jwt, issuer: https://issuer.example.com, jwksUri: https://issuer.example.com/jwks.json}",
+		},
+		{
+			name:   "generated key with a test token",
+			params: "{name: jwt, issuer: meshery, generateJwks: true, mintToken: true, claims: {groups: [dev]}}",
+		},
+		{
+			name:    "no key set",
+			params:  "{name: jwt, issuer: meshery}",
+			wantErr: true,
+		},
+		{
+			name:    "two key sets",
+			params:  "{name: jwt, issuer: meshery, generateJwks: true, jwksUri: https://issuer.example.com/jwks.json}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid inline key set",
+			params:  "{name: jwt, issuer: meshery, jwks: '{}'}",
+			wantErr: true,
+		},
+		{
+			name:    "relative jwks uri",
+			params:  "{name: jwt, issuer: meshery, jwksUri: /jwks.json}",
+			wantErr: true,
+		},
+		{
+			name:    "token without generated key",
+			params:  "{name: jwt, issuer: meshery, jwksUri: https://issuer.example.com/jwks.json, mintToken: true}",
+			wantErr: true,
+		},
+		{
+			name:    "reserved claim",
+			params:  "{name: jwt, issuer: meshery, generateJwks: true, mintToken: true, claims: {sub: admin}}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := defaultRequestAuthentication()
+			if err := parseOperationParams(tt.params, &auth); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := auth.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("requestAuthentication.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestAuthentication_resources(t *testing.T) {
+	auth := defaultRequestAuthentication()
+	if err := parseOperationParams("{name: jwt, issuer: meshery, gateway: true, generateJwks: true, requirePrincipal: true, audiences: [bookinfo]}", &auth); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, jwtKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := jwksFor(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("jwksFor() error = %v", err)
+	}
+
+	ns := auth.target("bookinfo")
+	if ns != ingressGatewayNamespace {
+		t.Errorf("target() = %v, want %v", ns, ingressGatewayNamespace)
+	}
+	for _, version := range []minorVersion{{Major: 1, Minor: 17}, {Major: 1, Minor: 22}} {
+		if err := validateAgainstMeshmodel("RequestAuthentication", version, auth.resource(ns, jwks)); err != nil {
+			t.Errorf("RequestAuthentication invalid for %s: %v", version, err)
+		}
+		if err := validateAgainstMeshmodel("AuthorizationPolicy", version, auth.authorization().resource(ns)); err != nil {
+			t.Errorf("AuthorizationPolicy invalid for %s: %v", version, err)
+		}
+	}
+	rules := auth.authorization().resource(ns)["spec"].(map[string]interface{})["rules"].([]interface{})
+	source := rules[0].(map[string]interface{})["from"].([]interface{})[0].(map[string]interface{})["source"].(map[string]interface{})
+	if got := source["notRequestPrincipals"].([]string); len(got) != 1 || got[0] != "meshery/*" {
+		t.Errorf("notRequestPrincipals = %v, want [meshery/*]", got)
+	}
+}
+
+func TestSignToken(t *testing.T) {
+	auth := defaultRequestAuthentication()
+	if err := parseOperationParams("{name: jwt, issuer: meshery, generateJwks: true, mintToken: true, audiences: [bookinfo], claims: {groups: [dev], org: {team: mesh}}}", &auth); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, jwtKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	claims, err := auth.tokenClaims(now)
+	if err != nil {
+		t.Fatalf("tokenClaims() error = %v", err)
+	}
+	token, err := signToken(key, claims)
+	if err != nil {
+		t.Fatalf("signToken() error = %v", err)
+	}
+
+	// the token must verify with the public key published in the key set
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	set, _ := jwksFor(&key.PublicKey)
+	if err := json.Unmarshal([]byte(set), &jwks); err != nil {
+		t.Fatalf("invalid key set: %v", err)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token has %d parts, want 3", len(parts))
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	var header map[string]interface{}
+	byt, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	_ = json.Unmarshal(byt, &header)
+	if header["kid"] != jwks.Keys[0].Kid || header["alg"] != "RS256" {
+		t.Errorf("header = %v, want kid %s and alg RS256", header, jwks.Keys[0].Kid)
+	}
+	var payload map[string]interface{}
+	byt, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	_ = json.Unmarshal(byt, &payload)
+	if payload["iss"] != "meshery" || payload["sub"] != "meshery-test" || payload["exp"] != float64(now.Add(time.Hour).Unix()) {
+		t.Errorf("payload = %v", payload)
+	}
+	if groups, _ := payload["groups"].([]interface{}); len(groups) != 1 || groups[0] != "dev" {
+		t.Errorf("groups = %v, want [dev]", payload["groups"])
+	}
+	if org, _ := payload["org"].(map[string]interface{}); org["team"] != "mesh" {
+		t.Errorf("org = %v, want {team: mesh}", payload["org"])
+	}
+}
@@ -0,0 +1,417 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	envoyFilterAPIVersion = "networking.istio.io/v1alpha3"
+
+	localRateLimitFilter   = "envoy.filters.http.local_ratelimit"
+	localRateLimitTypeURL  = "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit"
+	udpaTypedStructTypeURL = "type.googleapis.com/udpa.type.v1.TypedStruct"
+	httpConnectionManager  = "envoy.filters.network.http_connection_manager"
+)
+
+var (
+	// minRateLimitVersion is the first Istio release whose proxies embed
+	// the local rate limit filter and the v3 rate limit service client
+	minRateLimitVersion = minorVersion{Major: 1, Minor: 9}
+	// typedConfigVersion is the first Istio release for which the filter is
+	// configured with its own type rather than a TypedStruct
+	typedConfigVersion = minorVersion{Major: 1, Minor: 20}
+	// appendActionVersion is the first Istio release whose proxies replace
+	// the deprecated append field of headers by append_action
+	appendActionVersion = minorVersion{Major: 1, Minor: 15}
+)
+
+// tokenBucket is the token bucket of an Envoy rate limit
+type tokenBucket struct {
+	MaxTokens     int    `yaml:"maxTokens"`
+	TokensPerFill int    `yaml:"tokensPerFill,omitempty"`
+	FillInterval  string `yaml:"fillInterval"`
+}
+
+func (b tokenBucket) validate() error {
+	if b.MaxTokens <= 0 {
+		return fmt.Errorf("maxTokens must be positive")
+	}
+	if b.TokensPerFill < 0 {
+		return fmt.Errorf("tokensPerFill cannot be negative")
+	}
+	d, err := time.ParseDuration(b.FillInterval)
+	if err != nil {
+		return fmt.Errorf("invalid fillInterval: %w", err)
+	}
+	if d < time.Millisecond {
+		return fmt.Errorf("fillInterval must be at least 1ms")
+	}
+	return nil
+}
+
+// config returns the bucket in the Envoy format, where durations are
+// expressed in seconds
+func (b tokenBucket) config() map[string]interface{} {
+	d, _ := time.ParseDuration(b.FillInterval)
+	bucket := map[string]interface{}{
+		"max_tokens":    b.MaxTokens,
+		"fill_interval": fmt.Sprintf("%gs", d.Seconds()),
+	}
+	if b.TokensPerFill > 0 {
+		bucket["tokens_per_fill"] = b.TokensPerFill
+	}
+	return bucket
+}
+
+// rateLimitDescriptor limits the requests whose header has the value, e.g.
+// the requests to a path with the :path header, with a bucket of their own
+type rateLimitDescriptor struct {
+	Header      string      `yaml:"header"`
+	Value       string      `yaml:"value"`
+	TokenBucket tokenBucket `yaml:"tokenBucket"`
+}
+
+// key is the descriptor key under which the header value is sent
+func (d rateLimitDescriptor) key() string {
+	return descriptorKey(d.Header)
+}
+
+// descriptorKey returns the descriptor key under which the value of the
+// request header is sent, e.g. path for :path
+func descriptorKey(header string) string {
+	return strings.TrimPrefix(strings.ToLower(header), ":")
+}
+
+// localRateLimit are the parameters of the local rate limit operation
+type localRateLimit struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Gateway applies the limit on the gateway matching the selector, in
+	// GatewayNamespace, rather than on the sidecars of the workloads. The
+	// selector defaults to the one of the default ingress gateway.
+	Gateway          bool                  `yaml:"gateway,omitempty"`
+	GatewayNamespace string                `yaml:"gatewayNamespace,omitempty"`
+	Selector         map[string]string     `yaml:"selector,omitempty"`
+	TokenBucket      tokenBucket           `yaml:"tokenBucket"`
+	Descriptors      []rateLimitDescriptor `yaml:"descriptors,omitempty"`
+	// ResponseHeaders are added to the rate limited responses
+	ResponseHeaders map[string]string `yaml:"responseHeaders,omitempty"`
+}
+
+func defaultLocalRateLimit() localRateLimit {
+	return localRateLimit{
+		Name:             "local-rate-limit",
+		GatewayNamespace: ingressGatewayNamespace,
+		TokenBucket:      tokenBucket{MaxTokens: 100, TokensPerFill: 100, FillInterval: "60s"},
+	}
+}
+
+func (l localRateLimit) validate() error {
+	if errs := validation.IsDNS1123Subdomain(l.Name); len(errs) > 0 {
+		return ErrRateLimit(fmt.Errorf("invalid name %q: %s", l.Name, strings.Join(errs, ", ")))
+	}
+	if err := l.TokenBucket.validate(); err != nil {
+		return ErrRateLimit(err)
+	}
+	for _, d := range l.Descriptors {
+		if d.Header == "" || d.Value == "" {
+			return ErrRateLimit(fmt.Errorf("descriptors require a header and a value"))
+		}
+		if err := d.TokenBucket.validate(); err != nil {
+			return ErrRateLimit(fmt.Errorf("descriptor %s=%s: %w", d.Header, d.Value, err))
+		}
+	}
+	return nil
+}
+
+// target returns the namespace of the EnvoyFilter and the context of the
+// proxies it patches
+func (l localRateLimit) target(namespace string) (string, string) {
+	if l.Gateway {
+		return l.GatewayNamespace, "GATEWAY"
+	}
+	return namespace, "SIDECAR_INBOUND"
+}
+
+// workloadSelector returns the labels of the proxies patched by the filter,
+// every proxy of the namespace when empty
+func (l localRateLimit) workloadSelector() map[string]string {
+	if l.Gateway && len(l.Selector) == 0 {
+		return map[string]string{"istio": "ingressgateway"}
+	}
+	return l.Selector
+}
+
+// filterConfig returns the configuration of the local rate limit filter,
+// with the descriptors when given
+func (l localRateLimit) filterConfig(version minorVersion, descriptors bool) map[string]interface{} {
+	percent := map[string]interface{}{
+		"default_value": map[string]interface{}{"numerator": 100, "denominator": "HUNDRED"},
+	}
+	config := map[string]interface{}{
+		"stat_prefix":     "http_local_rate_limiter",
+		"token_bucket":    l.TokenBucket.config(),
+		"filter_enabled":  mergeMaps(percent, map[string]interface{}{"runtime_key": "local_rate_limit_enabled"}),
+		"filter_enforced": mergeMaps(percent, map[string]interface{}{"runtime_key": "local_rate_limit_enforced"}),
+	}
+
+	var headers []interface{}
+	for _, name := range sortedStringKeys(l.ResponseHeaders) {
+		header := map[string]interface{}{
+			"header": map[string]interface{}{"key": name, "value": l.ResponseHeaders[name]},
+		}
+		if version.atLeast(appendActionVersion) {
+			header["append_action"] = "OVERWRITE_IF_EXISTS_OR_ADD"
+		} else {
+			header["append"] = false
+		}
+		headers = append(headers, header)
+	}
+	if len(headers) > 0 {
+		config["response_headers_to_add"] = headers
+	}
+
+	if descriptors {
+		var list []interface{}
+		for _, d := range l.Descriptors {
+			list = append(list, map[string]interface{}{
+				"entries":      []interface{}{map[string]interface{}{"key": d.key(), "value": d.Value}},
+				"token_bucket": d.TokenBucket.config(),
+			})
+		}
+		config["descriptors"] = list
+	}
+
+	return typedConfig(version, localRateLimitTypeURL, config)
+}
+
+// typedConfig returns the typed configuration of an Envoy extension in the
+// format expected by the given Istio version
+func typedConfig(version minorVersion, typeURL string, config map[string]interface{}) map[string]interface{} {
+	if version.atLeast(typedConfigVersion) {
+		return mergeMaps(config, map[string]interface{}{"@type": typeURL})
+	}
+	return map[string]interface{}{
+		"@type":    udpaTypedStructTypeURL,
+		"type_url": typeURL,
+		"value":    config,
+	}
+}
+
+// rateLimitActions returns the actions of the route generating the
+// descriptors
+func (l localRateLimit) rateLimitActions() []interface{} {
+	headers := make([]string, 0, len(l.Descriptors))
+	for _, d := range l.Descriptors {
+		headers = append(headers, d.Header)
+	}
+	return headerRateLimitActions(headers)
+}
+
+// headerRateLimitActions returns the rate limit actions sending the value
+// of the request headers as descriptors, one per header so that each is
+// generated on its own
+func headerRateLimitActions(headers []string) []interface{} {
+	seen := map[string]bool{}
+	var actions []interface{}
+	for _, header := range headers {
+		key := descriptorKey(header)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		actions = append(actions, map[string]interface{}{
+			"actions": []interface{}{map[string]interface{}{
+				"request_headers": map[string]interface{}{"header_name": header, "descriptor_key": key},
+			}},
+		})
+	}
+	return actions
+}
+
+// manifest renders the EnvoyFilter for proxies of the given version
+func (l localRateLimit) manifest(namespace string, version minorVersion) (string, error) {
+	ns, context := l.target(namespace)
+	patches := []interface{}{
+		map[string]interface{}{
+			"applyTo": "HTTP_FILTER",
+			"match": map[string]interface{}{
+				"context": context,
+				"listener": map[string]interface{}{
+					"filterChain": map[string]interface{}{
+						"filter": map[string]interface{}{"name": httpConnectionManager},
+					},
+				},
+			},
+			"patch": map[string]interface{}{
+				"operation": "INSERT_BEFORE",
+				"value": map[string]interface{}{
+					"name":         localRateLimitFilter,
+					"typed_config": l.filterConfig(version, false),
+				},
+			},
+		},
+	}
+	if len(l.Descriptors) > 0 {
+		patches = append(patches, map[string]interface{}{
+			"applyTo": "HTTP_ROUTE",
+			"match": map[string]interface{}{
+				"context": context,
+				"routeConfiguration": map[string]interface{}{
+					"vhost": map[string]interface{}{
+						"route": map[string]interface{}{"action": "ANY"},
+					},
+				},
+			},
+			"patch": map[string]interface{}{
+				"operation": "MERGE",
+				"value": map[string]interface{}{
+					"route": map[string]interface{}{"rate_limits": l.rateLimitActions()},
+					"typed_per_filter_config": map[string]interface{}{
+						localRateLimitFilter: l.filterConfig(version, true),
+					},
+				},
+			},
+		})
+	}
+
+	spec := map[string]interface{}{"configPatches": patches}
+	if selector := l.workloadSelector(); len(selector) > 0 {
+		spec["workloadSelector"] = map[string]interface{}{"labels": selector}
+	}
+	byt, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": envoyFilterAPIVersion,
+		"kind":       "EnvoyFilter",
+		"metadata": map[string]interface{}{
+			"name":      l.Name,
+			"namespace": ns,
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return "", ErrRateLimit(err)
+	}
+	return string(byt), nil
+}
+
+// describe summarizes the limits applied
+func (l localRateLimit) describe(namespace string, version minorVersion) string {
+	ns, context := l.target(namespace)
+	msg := fmt.Sprintf("EnvoyFilter %s/%s limits %s proxies to %d requests every %s (rendered for Istio %s)",
+		ns, l.Name, strings.ToLower(strings.Split(context, "_")[0]), l.TokenBucket.MaxTokens, l.TokenBucket.FillInterval, version)
+	for _, d := range l.Descriptors {
+		msg = fmt.Sprintf("%s; %s %s: %d requests every %s", msg, d.Header, d.Value, d.TokenBucket.MaxTokens, d.TokenBucket.FillInterval)
+	}
+	return msg
+}
+
+// configureLocalRateLimit creates/deletes the EnvoyFilter configuring the
+// local rate limit of the proxies, rendered for the version of the control
+// plane of each cluster
+func (istio *Istio) configureLocalRateLimit(namespace string, del bool, limit localRateLimit, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := limit.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			msg, err := istio.configureLocalRateLimitOnSingleCluster(namespace, del, limit, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			msgs = append(msgs, msg)
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrRateLimit(mergeErrors(errs))
+}
+
+func (istio *Istio) configureLocalRateLimitOnSingleCluster(namespace string, del bool, limit localRateLimit, mclient *mesherykube.Client) (string, error) {
+	ns, _ := limit.target(namespace)
+	if del {
+		// the content of the filter does not matter to delete it
+		manifest, err := limit.manifest(namespace, minRateLimitVersion)
+		if err != nil {
+			return "", err
+		}
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), true, ns, mclient); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("EnvoyFilter %s/%s deleted", ns, limit.Name), nil
+	}
+
+	version, err := controlPlaneVersion(mclient)
+	if err != nil {
+		return "", err
+	}
+	if !version.atLeast(minRateLimitVersion) {
+		return "", fmt.Errorf("local rate limiting requires Istio %s or newer, the control plane runs %s", minRateLimitVersion, version)
+	}
+	manifest, err := limit.manifest(namespace, version)
+	if err != nil {
+		return "", err
+	}
+	if err := istio.applyManifestOnSingleCluster([]byte(manifest), false, ns, mclient); err != nil {
+		return "", err
+	}
+	return limit.describe(namespace, version), nil
+}
+
+// mergeMaps returns a map holding the entries of both maps, b taking
+// precedence
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+package istio
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestLocalRateLimit_manifest(t *testing.T) {
+	tests := []struct {
+		name            string
+		params          string
+		version         minorVersion
+		wantNamespace   string
+		wantContext     string
+		wantPatches     int
+		wantTypedStruct bool
+		wantAppend      string
+	}{
+		{
+			name:            "sidecars of an old control plane",
+			params:          "{selector: {app: productpage}, responseHeaders: {x-rate-limited: 'true'}}",
+			version:         minorVersion{Major: 1, Minor: 14},
+			wantNamespace:   "bookinfo",
+			wantContext:     "SIDECAR_INBOUND",
+			wantPatches:     1,
+			wantTypedStruct: true,
+			wantAppend:      "append",
+		},
+		{
+			name:            "sidecars with descriptors",
+			params:          "{selector: {app: productpage}, responseHeaders: {x-rate-limited: 'true'}, descriptors: [{header: ':path', value: /productpage, tokenBucket: {maxTokens: 5, fillInterval: 1m}}]}",
+			version:         minorVersion{Major: 1, Minor: 17},
+			wantNamespace:   "bookinfo",
+			wantContext:     "SIDECAR_INBOUND",
+			wantPatches:     2,
+			wantTypedStruct: true,
+			wantAppend:      "append_action",
+		},
+		{
+			name:          "default ingress gateway",
+			params:        "{gateway: true, responseHeaders: {x-rate-limited: 'true'}}",
+			version:       minorVersion{Major: 1, Minor: 20},
+			wantNamespace: "istio-system",
+			wantContext:   "GATEWAY",
+			wantPatches:   1,
+			wantAppend:    "append_action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := defaultLocalRateLimit()
+			if err := parseOperationParams(tt.params, &limit); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := limit.validate(); err != nil {
+				t.Fatalf("localRateLimit.validate() error = %v", err)
+			}
+			manifest, err := limit.manifest("bookinfo", tt.version)
+			if err != nil {
+				t.Fatalf("localRateLimit.manifest() error = %v", err)
+			}
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+				t.Fatalf("invalid manifest: %v", err)
+			}
+			if ns := obj["metadata"].(map[string]interface{})["namespace"]; ns != tt.wantNamespace {
+				t.Errorf("namespace = %v, want %v", ns, tt.wantNamespace)
+			}
+			spec := obj["spec"].(map[string]interface{})
+			if _, ok := spec["workloadSelector"]; !ok {
+				t.Errorf("workloadSelector missing")
+			}
+			patches := spec["configPatches"].([]interface{})
+			if len(patches) != tt.wantPatches {
+				t.Fatalf("configPatches = %d, want %d", len(patches), tt.wantPatches)
+			}
+			filter := patches[0].(map[string]interface{})
+			if ctx := filter["match"].(map[string]interface{})["context"]; ctx != tt.wantContext {
+				t.Errorf("context = %v, want %v", ctx, tt.wantContext)
+			}
+
+			typed := filter["patch"].(map[string]interface{})["value"].(map[string]interface{})["typed_config"].(map[string]interface{})
+			config := typed
+			if tt.wantTypedStruct {
+				if typed["@type"] != udpaTypedStructTypeURL || typed["type_url"] != localRateLimitTypeURL {
+					t.Errorf("typed_config = %v, want a TypedStruct", typed)
+				}
+				config = typed["value"].(map[string]interface{})
+			} else if typed["@type"] != localRateLimitTypeURL {
+				t.Errorf("typed_config = %v, want a LocalRateLimit", typed)
+			}
+			if config["token_bucket"].(map[string]interface{})["fill_interval"] != "60s" {
+				t.Errorf("token_bucket = %v", config["token_bucket"])
+			}
+			header := config["response_headers_to_add"].([]interface{})[0].(map[string]interface{})
+			if _, ok := header[tt.wantAppend]; !ok {
+				t.Errorf("response header = %v, want %s", header, tt.wantAppend)
+			}
+
+			if tt.wantPatches == 2 {
+				route := patches[1].(map[string]interface{})["patch"].(map[string]interface{})["value"].(map[string]interface{})
+				actions := route["route"].(map[string]interface{})["rate_limits"].([]interface{})
+				if len(actions) != 1 {
+					t.Errorf("rate_limits = %v", actions)
+				}
+				perRoute := route["typed_per_filter_config"].(map[string]interface{})[localRateLimitFilter].(map[string]interface{})["value"].(map[string]interface{})
+				descriptor := perRoute["descriptors"].([]interface{})[0].(map[string]interface{})
+				entry := descriptor["entries"].([]interface{})[0].(map[string]interface{})
+				if entry["key"] != "path" || entry["value"] != "/productpage" {
+					t.Errorf("descriptor entry = %v", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalRateLimit_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{name: "defaults", params: "", wantErr: false},
+		{name: "no tokens", params: "{tokenBucket: {maxTokens: 0, fillInterval: 1s}}", wantErr: true},
+		{name: "invalid interval", params: "{tokenBucket: {maxTokens: 10, fillInterval: often}}", wantErr: true},
+		{name: "descriptor without value", params: "{descriptors: [{header: ':path', tokenBucket: {maxTokens: 1, fillInterval: 1s}}]}", wantErr: true},
+		{name: "invalid name", params: "{name: Local_Limit}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := defaultLocalRateLimit()
+			if err := parseOperationParams(tt.params, &limit); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := limit.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("localRateLimit.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
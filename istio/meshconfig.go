@@ -0,0 +1,185 @@
+package istio
+
+import (
+	"context"
+	"strings"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	meshConfigNamespace = "istio-system"
+	meshConfigMapName   = "istio"
+	meshConfigKey       = "mesh"
+)
+
+// meshConfig is the decoded mesh configuration of the control plane,
+// kept as a generic map so that unknown fields are preserved on update
+type meshConfig map[string]interface{}
+
+// getMeshConfig returns the mesh configuration of the control plane
+func getMeshConfig(mclient *mesherykube.Client) (meshConfig, error) {
+	cm, err := mclient.KubeClient.CoreV1().ConfigMaps(meshConfigNamespace).Get(context.TODO(), meshConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrMeshConfigUpdate(err)
+	}
+	mesh := meshConfig{}
+	if err := yaml.Unmarshal([]byte(cm.Data[meshConfigKey]), &mesh); err != nil {
+		return nil, ErrMeshConfigUpdate(err)
+	}
+	return mesh, nil
+}
+
+// rootNamespace returns the namespace in which configuration applies to
+// the whole mesh
+func (m meshConfig) rootNamespace() string {
+	if ns, ok := m["rootNamespace"].(string); ok && ns != "" {
+		return ns
+	}
+	return meshConfigNamespace
+}
+
+// updateMeshConfig applies the mutation to the mesh configuration of the
+// control plane. istiod watches the config map and reloads it on change.
+func updateMeshConfig(mclient *mesherykube.Client, mutate func(meshConfig) error) error {
+	return updateRecordedMeshConfig(mclient, func(mesh meshConfig, _ map[string]string) error {
+		return mutate(mesh)
+	})
+}
+
+// updateRecordedMeshConfig applies the mutation to the mesh configuration
+// like updateMeshConfig, the mutation also gets the annotations of the
+// config map, where the operations record the values they replace
+func updateRecordedMeshConfig(mclient *mesherykube.Client, mutate func(meshConfig, map[string]string) error) error {
+	cmClient := mclient.KubeClient.CoreV1().ConfigMaps(meshConfigNamespace)
+	cm, err := cmClient.Get(context.TODO(), meshConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return ErrMeshConfigUpdate(err)
+	}
+	mesh := meshConfig{}
+	if err := yaml.Unmarshal([]byte(cm.Data[meshConfigKey]), &mesh); err != nil {
+		return ErrMeshConfigUpdate(err)
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	if err := mutate(mesh, cm.Annotations); err != nil {
+		return ErrMeshConfigUpdate(err)
+	}
+	byt, err := yaml.Marshal(mesh)
+	if err != nil {
+		return ErrMeshConfigUpdate(err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[meshConfigKey] = string(byt)
+	if _, err := cmClient.Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		return ErrMeshConfigUpdate(err)
+	}
+	return nil
+}
+
+// setExtensionProvider adds the provider to the extension providers of the
+// mesh, replacing any provider registered with the same name
+func (m meshConfig) setExtensionProvider(provider map[string]interface{}) {
+	name := provider["name"]
+	providers, _ := m["extensionProviders"].([]interface{})
+	for i, p := range providers {
+		if existing, ok := p.(map[string]interface{}); ok && existing["name"] == name {
+			providers[i] = provider
+			m["extensionProviders"] = providers
+			return
+		}
+	}
+	m["extensionProviders"] = append(providers, provider)
+}
+
+// removeExtensionProvider removes the named provider from the extension
+// providers and the default providers of the mesh
+func (m meshConfig) removeExtensionProvider(name string) {
+	providers, _ := m["extensionProviders"].([]interface{})
+	kept := make([]interface{}, 0, len(providers))
+	for _, p := range providers {
+		if existing, ok := p.(map[string]interface{}); ok && existing["name"] == name {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	m["extensionProviders"] = kept
+
+	defaults, _ := m["defaultProviders"].(map[string]interface{})
+	for kind, names := range defaults {
+		list, _ := names.([]interface{})
+		remaining := make([]interface{}, 0, len(list))
+		for _, n := range list {
+			if n != name {
+				remaining = append(remaining, n)
+			}
+		}
+		defaults[kind] = remaining
+	}
+}
+
+// setDefaultProvider makes the named provider the default one of the mesh
+// for the given kind of telemetry: tracing, metrics or accessLogging
+func (m meshConfig) setDefaultProvider(kind, name string) {
+	defaults, ok := m["defaultProviders"].(map[string]interface{})
+	if !ok {
+		defaults = map[string]interface{}{}
+		m["defaultProviders"] = defaults
+	}
+	defaults[kind] = []interface{}{name}
+}
+
+// fieldsRecord holds the values of configuration fields, given as dotted
+// paths, before an operation set them, so that they can be restored
+type fieldsRecord struct {
+	Fields []string `json:"fields"`
+	// Previous values of the fields which were set
+	Previous map[string]interface{} `json:"previous,omitempty"`
+}
+
+func newFieldsRecord(config map[string]interface{}, fields ...string) fieldsRecord {
+	return fieldsRecord{}.extend(config, fields...)
+}
+
+// extend adds to the record the current values of the fields it does not
+// hold yet, the ones it holds keep their original values
+func (r fieldsRecord) extend(config map[string]interface{}, fields ...string) fieldsRecord {
+	if r.Previous == nil {
+		r.Previous = map[string]interface{}{}
+	}
+	recorded := toSet(r.Fields)
+	for _, field := range fields {
+		if recorded[field] {
+			continue
+		}
+		r.Fields = append(r.Fields, field)
+		if value, found, _ := unstructured.NestedFieldCopy(config, strings.Split(field, ".")...); found {
+			r.Previous[field] = value
+		}
+	}
+	return r
+}
+
+// restore sets the recorded fields back to their previous values, removing
+// the ones which were not set
+func (r fieldsRecord) restore(config map[string]interface{}) error {
+	for _, field := range r.Fields {
+		path := strings.Split(field, ".")
+		previous, ok := r.Previous[field]
+		if !ok {
+			unstructured.RemoveNestedField(config, path...)
+			continue
+		}
+		if err := unstructured.SetNestedField(config, runtime.DeepCopyJSONValue(previous), path...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package istio
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const testMeshConfig = `
+enableTracing: false
+defaultProviders:
+  tracing:
+  - zipkin
+  metrics:
+  - prometheus
+extensionProviders:
+- name: zipkin
+  zipkin:
+    service: zipkin.istio-system.svc.cluster.local
+    port: 9411
+- name: prometheus
+  prometheus: {}
+`
+
+func getTestMeshConfig(t *testing.T) meshConfig {
+	mesh := meshConfig{}
+	if err := yaml.Unmarshal([]byte(testMeshConfig), &mesh); err != nil {
+		t.Fatalf("failed to decode test mesh config: %v", err)
+	}
+	return mesh
+}
+
+func providerNames(mesh meshConfig) []string {
+	var names []string
+	providers, _ := mesh["extensionProviders"].([]interface{})
+	for _, p := range providers {
+		names = append(names, p.(map[string]interface{})["name"].(string))
+	}
+	return names
+}
+
+func TestMeshConfig_setExtensionProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  map[string]interface{}
+		wantNames []string
+	}{
+		{
+			name: "new provider is appended",
+			provider: map[string]interface{}{
+				"name":          "tempo",
+				"opentelemetry": map[string]interface{}{"service": "tempo.observability.svc.cluster.local", "port": 4317},
+			},
+			wantNames: []string{"zipkin", "prometheus", "tempo"},
+		},
+		{
+			name: "existing provider is replaced",
+			provider: map[string]interface{}{
+				"name":   "zipkin",
+				"zipkin": map[string]interface{}{"service": "jaeger.tracing.svc.cluster.local", "port": 9411},
+			},
+			wantNames: []string{"zipkin", "prometheus"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh := getTestMeshConfig(t)
+			mesh.setExtensionProvider(tt.provider)
+			if got := providerNames(mesh); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("setExtensionProvider() providers = %v, want %v", got, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestMeshConfig_removeExtensionProvider(t *testing.T) {
+	mesh := getTestMeshConfig(t)
+	mesh.removeExtensionProvider("zipkin")
+
+	if got := providerNames(mesh); !reflect.DeepEqual(got, []string{"prometheus"}) {
+		t.Errorf("removeExtensionProvider() providers = %v, want [prometheus]", got)
+	}
+	defaults := mesh["defaultProviders"].(map[string]interface{})
+	if got := defaults["tracing"].([]interface{}); len(got) != 0 {
+		t.Errorf("removeExtensionProvider() default tracing providers = %v, want none", got)
+	}
+	if got := defaults["metrics"].([]interface{}); !reflect.DeepEqual(got, []interface{}{"prometheus"}) {
+		t.Errorf("removeExtensionProvider() default metrics providers = %v, want [prometheus]", got)
+	}
+}
+
+func TestMeshConfig_setDefaultProvider(t *testing.T) {
+	mesh := meshConfig{}
+	mesh.setDefaultProvider("tracing", "tempo")
+	want := map[string]interface{}{"tracing": []interface{}{"tempo"}}
+	if got := mesh["defaultProviders"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("setDefaultProvider() = %v, want %v", got, want)
+	}
+}
+
+func TestMeshConfig_rootNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		mesh meshConfig
+		want string
+	}{
+		{
+			name: "defaults to istio-system",
+			mesh: meshConfig{},
+			want: "istio-system",
+		},
+		{
+			name: "configured root namespace",
+			mesh: meshConfig{"rootNamespace": "istio-config"},
+			want: "istio-config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mesh.rootNamespace(); got != tt.want {
+				t.Errorf("meshConfig.rootNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldsRecord_restore(t *testing.T) {
+	original := getTestMeshConfig(t)
+	mesh := getTestMeshConfig(t)
+	byt, err := json.Marshal(newFieldsRecord(mesh, "enableTracing", "defaultProviders.tracing", "outboundTrafficPolicy"))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	mesh["enableTracing"] = true
+	mesh["outboundTrafficPolicy"] = map[string]interface{}{"mode": outboundRegistryOnly}
+	mesh.setDefaultProvider("tracing", "external-tracing")
+
+	record := fieldsRecord{}
+	if err := json.Unmarshal(byt, &record); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if err := record.restore(mesh); err != nil {
+		t.Fatalf("fieldsRecord.restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(mesh, original) {
+		t.Errorf("fieldsRecord.restore() = %v, want %v", mesh, original)
+	}
+}
+
+func TestFieldsRecord_extend(t *testing.T) {
+	kiali := map[string]interface{}{
+		"external_services": map[string]interface{}{
+			"prometheus": map[string]interface{}{"url": "http://prometheus.istio-system:9090"},
+		},
+	}
+	record := newFieldsRecord(kiali, "external_services.prometheus.url")
+	if err := unstructured.SetNestedField(kiali, "http://prometheus.monitoring:9090", "external_services", "prometheus", "url"); err != nil {
+		t.Fatalf("failed to set the Prometheus URL: %v", err)
+	}
+	record = record.extend(kiali, "external_services.prometheus.url", "external_services.tracing.enabled")
+
+	want := fieldsRecord{
+		Fields:   []string{"external_services.prometheus.url", "external_services.tracing.enabled"},
+		Previous: map[string]interface{}{"external_services.prometheus.url": "http://prometheus.istio-system:9090"},
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("fieldsRecord.extend() = %v, want %v", record, want)
+	}
+}
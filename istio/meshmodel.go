@@ -0,0 +1,150 @@
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/layer5io/meshery-istio/istio/oam"
+	"github.com/layer5io/meshkit/utils"
+)
+
+// meshmodelComponentsPath is the directory holding the generated component
+// definitions, one directory per Istio version
+var meshmodelComponentsPath = oam.MeshmodelComponents
+
+// componentVersionRegex matches the names of the version directories of
+// the component definitions, e.g. 1.17.2 or 1.18.0-rc.1
+var componentVersionRegex = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(-.+)?$`)
+
+// componentVersion is the version of a set of component definitions
+type componentVersion struct {
+	Dir        string
+	Version    minorVersion
+	Patch      int
+	Prerelease bool
+}
+
+// newerThan orders the definitions by version, a release being newer than
+// its prereleases
+func (c componentVersion) newerThan(o componentVersion) bool {
+	if c.Version != o.Version {
+		return c.Version.atLeast(o.Version)
+	}
+	if c.Patch != o.Patch {
+		return c.Patch > o.Patch
+	}
+	if c.Prerelease != o.Prerelease {
+		return o.Prerelease
+	}
+	return c.Dir > o.Dir
+}
+
+// closestComponentVersion returns the directory of the newest definitions
+// which are not newer than the version, or of the oldest ones when the
+// version predates them all
+func closestComponentVersion(dirs []string, version minorVersion) (string, error) {
+	var closest, oldest *componentVersion
+	for _, dir := range dirs {
+		match := componentVersionRegex.FindStringSubmatch(dir)
+		if match == nil {
+			continue
+		}
+		major, _ := strconv.Atoi(match[1])
+		minor, _ := strconv.Atoi(match[2])
+		patch, _ := strconv.Atoi(match[3])
+		c := componentVersion{Dir: dir, Version: minorVersion{Major: major, Minor: minor}, Patch: patch, Prerelease: match[4] != ""}
+		if oldest == nil || oldest.newerThan(c) {
+			oldest = &c
+		}
+		if version.atLeast(c.Version) && (closest == nil || c.newerThan(*closest)) {
+			closest = &c
+		}
+	}
+	if closest == nil {
+		closest = oldest
+	}
+	if closest == nil {
+		return "", fmt.Errorf("no component definitions found")
+	}
+	return closest.Dir, nil
+}
+
+// meshmodelSchema returns the JSON schema of the kind from the component
+// definitions closest to the version
+func meshmodelSchema(kind string, version minorVersion) (string, error) {
+	entries, err := os.ReadDir(meshmodelComponentsPath)
+	if err != nil {
+		return "", err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	dir, err := closestComponentVersion(dirs, version)
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(meshmodelComponentsPath, dir, fmt.Sprintf("%s.Istio.meshery.layer5.io_meshmodel.json", strings.ToLower(kind)))
+	byt, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var definition struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.Unmarshal(byt, &definition); err != nil {
+		return "", fmt.Errorf("invalid component definition %s: %w", file, err)
+	}
+	if definition.Schema == "" {
+		return "", fmt.Errorf("the component definition %s has no schema", file)
+	}
+	return definition.Schema, nil
+}
+
+// validateAgainstMeshmodel validates the resource against the schema of its
+// kind for the Istio version. The schemas of the definitions generated
+// before Istio 1.19 only describe the spec of the resource.
+func validateAgainstMeshmodel(kind string, version minorVersion, resource map[string]interface{}) error {
+	schema, err := meshmodelSchema(kind, version)
+	if err != nil {
+		return err
+	}
+	var properties struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(schema), &properties); err != nil {
+		return fmt.Errorf("invalid %s schema: %w", kind, err)
+	}
+	var document interface{} = resource
+	if _, ok := properties.Properties["spec"]; !ok {
+		document = resource["spec"]
+	}
+	schemaValue, err := utils.JsonSchemaToCue(schema)
+	if err != nil {
+		return err
+	}
+	byt, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	value, err := utils.JsonToCue(byt)
+	if err != nil {
+		return err
+	}
+	if ok, errs := utils.Validate(schemaValue, value); !ok {
+		msgs := make([]string, 0, len(errs))
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		return fmt.Errorf("the %s is invalid for Istio %s: %s", kind, version, strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package istio
+
+import (
+	"testing"
+)
+
+func init() {
+	meshmodelComponentsPath = "../templates/meshmodel/components"
+}
+
+func TestClosestComponentVersion(t *testing.T) {
+	dirs := []string{"1.8.6", "1.9.0", "1.17.0-rc.1", "1.17.0", "1.17.2", "1.18.0-beta.0", "1.18.0-rc.1", "README.md"}
+	tests := []struct {
+		name    string
+		version minorVersion
+		want    string
+	}{
+		{
+			name:    "latest patch of the minor version",
+			version: minorVersion{Major: 1, Minor: 17},
+			want:    "1.17.2",
+		},
+		{
+			name:    "only prereleases",
+			version: minorVersion{Major: 1, Minor: 18},
+			want:    "1.18.0-rc.1",
+		},
+		{
+			name:    "newer than every definition",
+			version: minorVersion{Major: 1, Minor: 25},
+			want:    "1.18.0-rc.1",
+		},
+		{
+			name:    "missing minor version",
+			version: minorVersion{Major: 1, Minor: 12},
+			want:    "1.9.0",
+		},
+		{
+			name:    "older than every definition",
+			version: minorVersion{Major: 1, Minor: 5},
+			want:    "1.8.6",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := closestComponentVersion(dirs, tt.version)
+			if err != nil {
+				t.Fatalf("closestComponentVersion() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("closestComponentVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAgainstMeshmodel(t *testing.T) {
+	tests := []struct {
+		name    string
+		version minorVersion
+		spec    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:    "valid policy",
+			version: minorVersion{Major: 1, Minor: 17},
+			spec:    map[string]interface{}{"action": "DENY", "rules": []interface{}{map[string]interface{}{"to": []interface{}{map[string]interface{}{"operation": map[string]interface{}{"ports": []string{"8080"}}}}}}},
+		},
+		{
+			name:    "unknown action",
+			version: minorVersion{Major: 1, Minor: 17},
+			spec:    map[string]interface{}{"action": "REJECT"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown action with a resource schema",
+			version: minorVersion{Major: 1, Minor: 22},
+			spec:    map[string]interface{}{"action": "REJECT"},
+			wantErr: true,
+		},
+		{
+			name:    "numeric port",
+			version: minorVersion{Major: 1, Minor: 22},
+			spec:    map[string]interface{}{"action": "DENY", "rules": []interface{}{map[string]interface{}{"to": []interface{}{map[string]interface{}{"operation": map[string]interface{}{"ports": []int{8080}}}}}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAgainstMeshmodel("AuthorizationPolicy", tt.version, map[string]interface{}{"spec": tt.spec})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateAgainstMeshmodel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
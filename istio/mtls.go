@@ -0,0 +1,350 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-istio/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Scopes of the mTLS policies
+const (
+	MTLSScopeMesh      = "mesh"
+	MTLSScopeNamespace = "namespace"
+	MTLSScopeWorkload  = "workload"
+
+	mtlsModeStrict     = "STRICT"
+	mtlsModePermissive = "PERMISSIVE"
+	mtlsModeDisable    = "DISABLE"
+	mtlsModeUnset      = "UNSET"
+
+	// defaultPeerAuthenticationName is the name Istio documents for the
+	// mesh-wide and namespace-wide policies
+	defaultPeerAuthenticationName = "default"
+
+	// replacedPeerAuthenticationsAnnotation records on the PeerAuthentication
+	// applied by the operation the ones it replaced at the same scope, so
+	// that they can be restored once it is deleted. Its presence also marks
+	// the PeerAuthentication as applied by the operation.
+	replacedPeerAuthenticationsAnnotation = "meshery.io/replaced-peer-authentications"
+)
+
+var peerAuthenticationGVR = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+
+// mtlsModes are the modes applied by the mTLS operations
+var mtlsModes = map[string]string{
+	internalconfig.StrictMTLSPolicyOperation:  mtlsModeStrict,
+	internalconfig.MutualMTLSPolicyOperation:  mtlsModePermissive,
+	internalconfig.DisableMTLSPolicyOperation: mtlsModeDisable,
+}
+
+// mtlsPolicy are the parameters of the mTLS operations and trait
+type mtlsPolicy struct {
+	// Scope is mesh for the default of the mesh, set in its root
+	// namespace, namespace or workload
+	Scope string `yaml:"scope"`
+	// Name defaults to default for the mesh and namespace scopes, and to
+	// the app label of the selector for the workload scope
+	Name     string            `yaml:"name,omitempty"`
+	Selector map[string]string `yaml:"selector,omitempty"`
+	// PortModes override the mode on ports of the workloads
+	PortModes map[uint32]string `yaml:"portModes,omitempty"`
+}
+
+func defaultMTLSPolicy() mtlsPolicy {
+	return mtlsPolicy{
+		Scope: MTLSScopeNamespace,
+	}
+}
+
+func (p mtlsPolicy) validate(mode string) error {
+	if !validMTLSMode(mode) {
+		return ErrApplyPolicy(fmt.Errorf("invalid mTLS mode %s", mode))
+	}
+	switch p.Scope {
+	case MTLSScopeMesh, MTLSScopeNamespace:
+		if len(p.Selector) > 0 || len(p.PortModes) > 0 {
+			return ErrApplyPolicy(fmt.Errorf("a selector and port modes only apply to the %s scope", MTLSScopeWorkload))
+		}
+	case MTLSScopeWorkload:
+		if len(p.Selector) == 0 {
+			return ErrApplyPolicy(fmt.Errorf("the %s scope requires a selector", MTLSScopeWorkload))
+		}
+	default:
+		return ErrApplyPolicy(fmt.Errorf("invalid scope %s, use %s, %s or %s", p.Scope, MTLSScopeMesh, MTLSScopeNamespace, MTLSScopeWorkload))
+	}
+	for port, portMode := range p.PortModes {
+		if port == 0 || port > 65535 {
+			return ErrApplyPolicy(fmt.Errorf("invalid port %d", port))
+		}
+		if !validMTLSMode(portMode) {
+			return ErrApplyPolicy(fmt.Errorf("invalid mTLS mode %s for port %d", portMode, port))
+		}
+	}
+	if p.name() == "" {
+		return ErrApplyPolicy(fmt.Errorf("a name is required when the selector has no app label"))
+	}
+	return nil
+}
+
+func validMTLSMode(mode string) bool {
+	switch mode {
+	case mtlsModeStrict, mtlsModePermissive, mtlsModeDisable, mtlsModeUnset:
+		return true
+	}
+	return false
+}
+
+func (p mtlsPolicy) name() string {
+	switch {
+	case p.Name != "":
+		return p.Name
+	case p.Scope == MTLSScopeWorkload:
+		return p.Selector["app"]
+	}
+	return defaultPeerAuthenticationName
+}
+
+// resource returns the PeerAuthentication in the given namespace
+func (p mtlsPolicy) resource(namespace, mode string) map[string]interface{} {
+	spec := map[string]interface{}{
+		"mtls": map[string]interface{}{"mode": mode},
+	}
+	if len(p.Selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": p.Selector}
+	}
+	if len(p.PortModes) > 0 {
+		ports := map[string]interface{}{}
+		for port, portMode := range p.PortModes {
+			ports[strconv.Itoa(int(port))] = map[string]interface{}{"mode": portMode}
+		}
+		spec["portLevelMtls"] = ports
+	}
+	return map[string]interface{}{
+		"apiVersion": securityAPIVersion,
+		"kind":       "PeerAuthentication",
+		"metadata": map[string]interface{}{
+			"name":      p.name(),
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+}
+
+func (p mtlsPolicy) describe(namespace, mode string) string {
+	target := "the namespace " + namespace
+	switch p.Scope {
+	case MTLSScopeMesh:
+		target = "the mesh"
+	case MTLSScopeWorkload:
+		target = "the workloads matching " + formatSelector(p.Selector)
+	}
+	msg := fmt.Sprintf("PeerAuthentication %s/%s applied with mode %s on %s", namespace, p.name(), mode, target)
+	if len(p.PortModes) == 0 {
+		return msg
+	}
+	ports := make([]int, 0, len(p.PortModes))
+	for port := range p.PortModes {
+		ports = append(ports, int(port))
+	}
+	sort.Ints(ports)
+	overrides := make([]string, 0, len(ports))
+	for _, port := range ports {
+		overrides = append(overrides, fmt.Sprintf("%d: %s", port, p.PortModes[uint32(port)]))
+	}
+	return fmt.Sprintf("%s, overridden on port %s", msg, strings.Join(overrides, ", "))
+}
+
+// sameScope tells whether the existing PeerAuthentication applies to the
+// same workloads as the policy
+func (p mtlsPolicy) sameScope(existing unstructured.Unstructured) bool {
+	selector, _, _ := unstructured.NestedStringMap(existing.Object, "spec", "selector", "matchLabels")
+	if len(selector) == 0 && len(p.Selector) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(selector, p.Selector)
+}
+
+// configureMTLS applies the PeerAuthentication with the mode at the scope
+// of the policy, replacing the ones already defined at that scope, or
+// deletes it and restores them
+func (istio *Istio) configureMTLS(namespace string, del bool, mode string, policy mtlsPolicy, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := policy.validate(mode); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureMTLSOnSingleCluster(namespace, del, mode, policy, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrApplyPolicy(mergeErrors(errs))
+}
+
+func (istio *Istio) configureMTLSOnSingleCluster(namespace string, del bool, mode string, policy mtlsPolicy, mclient *mesherykube.Client) ([]string, error) {
+	if policy.Scope == MTLSScopeMesh {
+		mesh, err := getMeshConfig(mclient)
+		if err != nil {
+			return nil, err
+		}
+		namespace = mesh.rootNamespace()
+	}
+
+	paClient := mclient.DynamicKubeClient.Resource(peerAuthenticationGVR).Namespace(namespace)
+	if del {
+		return restorePeerAuthentications(namespace, policy, mclient)
+	}
+
+	// Istio only honours the oldest of the policies defined at the same
+	// scope, so the others are removed rather than left to shadow this one,
+	// and recorded to be restored
+	list, err := paClient.List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var msgs []string
+	var replaced []map[string]interface{}
+	for _, existing := range list.Items {
+		if !policy.sameScope(existing) {
+			continue
+		}
+		if raw, ok := existing.GetAnnotations()[replacedPeerAuthenticationsAnnotation]; ok && existing.GetName() == policy.name() {
+			// Applied by the operation before, the policies it replaced
+			// still have to be restored
+			var previous []map[string]interface{}
+			if err := json.Unmarshal([]byte(raw), &previous); err != nil {
+				return msgs, err
+			}
+			replaced = append(replaced, previous...)
+			continue
+		}
+		existingMode, _, _ := unstructured.NestedString(existing.Object, "spec", "mtls", "mode")
+		if existingMode == "" {
+			existingMode = mtlsModeUnset
+		}
+		replaced = append(replaced, replacedPeerAuthentication(existing))
+		if existing.GetName() != policy.name() {
+			if err := paClient.Delete(context.TODO(), existing.GetName(), metav1.DeleteOptions{}); err != nil {
+				return msgs, err
+			}
+		}
+		msgs = append(msgs, fmt.Sprintf("PeerAuthentication %s/%s with mode %s replaced, it is restored when the policy is deleted", namespace, existing.GetName(), existingMode))
+	}
+
+	record, err := json.Marshal(replaced)
+	if err != nil {
+		return msgs, err
+	}
+	resource := policy.resource(namespace, mode)
+	if err := unstructured.SetNestedStringMap(resource, map[string]string{replacedPeerAuthenticationsAnnotation: string(record)}, "metadata", "annotations"); err != nil {
+		return msgs, err
+	}
+	manifest, err := yaml.Marshal(resource)
+	if err != nil {
+		return msgs, err
+	}
+	if err := istio.applyManifestOnSingleCluster(manifest, false, namespace, mclient); err != nil {
+		return msgs, err
+	}
+	return append(msgs, policy.describe(namespace, mode)), nil
+}
+
+// restorePeerAuthentications deletes the PeerAuthentication of the policy
+// and recreates the ones it replaced
+func restorePeerAuthentications(namespace string, policy mtlsPolicy, mclient *mesherykube.Client) ([]string, error) {
+	paClient := mclient.DynamicKubeClient.Resource(peerAuthenticationGVR).Namespace(namespace)
+	current, err := paClient.Get(context.TODO(), policy.name(), metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return []string{fmt.Sprintf("PeerAuthentication %s/%s already deleted", namespace, policy.name())}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var replaced []map[string]interface{}
+	if raw, ok := current.GetAnnotations()[replacedPeerAuthenticationsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &replaced); err != nil {
+			return nil, err
+		}
+	}
+	if err := paClient.Delete(context.TODO(), policy.name(), metav1.DeleteOptions{}); err != nil && !kubeerror.IsNotFound(err) {
+		return nil, err
+	}
+	msgs := []string{fmt.Sprintf("PeerAuthentication %s/%s deleted", namespace, policy.name())}
+	for _, obj := range replaced {
+		pa := &unstructured.Unstructured{Object: obj}
+		if _, err := paClient.Create(context.TODO(), pa, metav1.CreateOptions{}); err != nil {
+			if kubeerror.IsAlreadyExists(err) {
+				msgs = append(msgs, fmt.Sprintf("PeerAuthentication %s/%s was not restored, it was created again since", namespace, pa.GetName()))
+				continue
+			}
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("PeerAuthentication %s/%s restored", namespace, pa.GetName()))
+	}
+	return msgs, nil
+}
+
+// replacedPeerAuthentication returns the PeerAuthentication as it has to be
+// recreated, without the fields set by the API server
+func replacedPeerAuthentication(existing unstructured.Unstructured) map[string]interface{} {
+	pa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": existing.GetAPIVersion(),
+		"kind":       existing.GetKind(),
+		"spec":       runtime.DeepCopyJSONValue(existing.Object["spec"]),
+	}}
+	pa.SetName(existing.GetName())
+	pa.SetNamespace(existing.GetNamespace())
+	pa.SetLabels(existing.GetLabels())
+	annotations := existing.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) > 0 {
+		pa.SetAnnotations(annotations)
+	}
+	return pa.Object
+}
@@ -0,0 +1,167 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMTLSPolicy_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		mode    string
+		wantErr bool
+	}{
+		{
+			name: "namespace by default",
+			mode: mtlsModeStrict,
+		},
+		{
+			name:   "mesh",
+			params: "{scope: mesh}",
+			mode:   mtlsModePermissive,
+		},
+		{
+			name:   "workload with port modes",
+			params: "{scope: workload, selector: {app: reviews}, portModes: {9080: DISABLE}}",
+			mode:   mtlsModeStrict,
+		},
+		{
+			name:    "mesh with a selector",
+			params:  "{scope: mesh, selector: {app: reviews}}",
+			mode:    mtlsModeStrict,
+			wantErr: true,
+		},
+		{
+			name:    "workload without selector",
+			params:  "{scope: workload}",
+			mode:    mtlsModeStrict,
+			wantErr: true,
+		},
+		{
+			name:    "workload without name nor app label",
+			params:  "{scope: workload, selector: {version: v1}}",
+			mode:    mtlsModeStrict,
+			wantErr: true,
+		},
+		{
+			name:    "invalid port mode",
+			params:  "{scope: workload, selector: {app: reviews}, portModes: {9080: OFF}}",
+			mode:    mtlsModeStrict,
+			wantErr: true,
+		},
+		{
+			name:    "invalid scope",
+			params:  "{scope: cluster}",
+			mode:    mtlsModeStrict,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := defaultMTLSPolicy()
+			if err := parseOperationParams(tt.params, &policy); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := policy.validate(tt.mode); (err != nil) != tt.wantErr {
+				t.Errorf("mtlsPolicy.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMTLSPolicy_resource(t *testing.T) {
+	policy := defaultMTLSPolicy()
+	if err := parseOperationParams("{scope: workload, selector: {app: reviews}, portModes: {9080: DISABLE}}", &policy); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	resource := policy.resource("bookinfo", mtlsModeStrict)
+	if name := resource["metadata"].(map[string]interface{})["name"]; name != "reviews" {
+		t.Errorf("name = %v, want reviews", name)
+	}
+	want := map[string]interface{}{
+		"mtls":          map[string]interface{}{"mode": "STRICT"},
+		"selector":      map[string]interface{}{"matchLabels": map[string]string{"app": "reviews"}},
+		"portLevelMtls": map[string]interface{}{"9080": map[string]interface{}{"mode": "DISABLE"}},
+	}
+	if got := resource["spec"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("spec = %v, want %v", got, want)
+	}
+	if got, want := policy.describe("bookinfo", mtlsModeStrict), "PeerAuthentication bookinfo/reviews applied with mode STRICT on the workloads matching app=reviews, overridden on port 9080: DISABLE"; got != want {
+		t.Errorf("describe() = %v, want %v", got, want)
+	}
+}
+
+func TestMTLSPolicy_sameScope(t *testing.T) {
+	namespaceWide := unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"mtls": map[string]interface{}{"mode": "STRICT"}}}}
+	reviews := unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "reviews"}}}}}
+	tests := []struct {
+		name     string
+		policy   mtlsPolicy
+		existing unstructured.Unstructured
+		want     bool
+	}{
+		{
+			name:     "both namespace wide",
+			policy:   mtlsPolicy{Scope: MTLSScopeNamespace},
+			existing: namespaceWide,
+			want:     true,
+		},
+		{
+			name:     "workload and namespace wide",
+			policy:   mtlsPolicy{Scope: MTLSScopeWorkload, Selector: map[string]string{"app": "reviews"}},
+			existing: namespaceWide,
+		},
+		{
+			name:     "same selector",
+			policy:   mtlsPolicy{Scope: MTLSScopeWorkload, Selector: map[string]string{"app": "reviews"}},
+			existing: reviews,
+			want:     true,
+		},
+		{
+			name:     "other selector",
+			policy:   mtlsPolicy{Scope: MTLSScopeWorkload, Selector: map[string]string{"app": "ratings"}},
+			existing: reviews,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.sameScope(tt.existing); got != tt.want {
+				t.Errorf("mtlsPolicy.sameScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplacedPeerAuthentication(t *testing.T) {
+	existing := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": securityAPIVersion,
+		"kind":       "PeerAuthentication",
+		"metadata": map[string]interface{}{
+			"name":            "legacy",
+			"namespace":       "bookinfo",
+			"uid":             "8a1e6c3e-52b7-4b3e-a0a5-0d6f5d1e2b44",
+			"resourceVersion": "1234",
+			"labels":          map[string]interface{}{"team": "bookinfo"},
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+		},
+		"spec": map[string]interface{}{"mtls": map[string]interface{}{"mode": mtlsModePermissive}},
+	}}
+	want := map[string]interface{}{
+		"apiVersion": securityAPIVersion,
+		"kind":       "PeerAuthentication",
+		"metadata": map[string]interface{}{
+			"name":      "legacy",
+			"namespace": "bookinfo",
+			"labels":    map[string]interface{}{"team": "bookinfo"},
+		},
+		"spec": map[string]interface{}{"mtls": map[string]interface{}{"mode": mtlsModePermissive}},
+	}
+	if got := replacedPeerAuthentication(existing); !reflect.DeepEqual(got, want) {
+		t.Errorf("replacedPeerAuthentication() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// mtlsMigration are the parameters of the mTLS migration operation
+type mtlsMigration struct {
+	// Namespaces to switch to STRICT, the namespace of the operation when
+	// empty
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// Force applies STRICT in spite of the blockers
+	Force bool `yaml:"force"`
+	// DryRun only reports the blockers
+	DryRun bool `yaml:"dryRun"`
+	// Window over which the traffic is inspected
+	Window              string `yaml:"window"`
+	PrometheusNamespace string `yaml:"prometheusNamespace"`
+	PrometheusService   string `yaml:"prometheusService"`
+}
+
+func defaultMTLSMigration() mtlsMigration {
+	return mtlsMigration{
+		Window:              "1h",
+		PrometheusNamespace: "istio-system",
+		PrometheusService:   prometheusAddonService,
+	}
+}
+
+func (m mtlsMigration) validate() error {
+	if len(m.Namespaces) == 0 {
+		return ErrMTLSMigration(fmt.Errorf("at least one namespace is required"))
+	}
+	if !prometheusDurationRegex.MatchString(m.Window) {
+		return ErrMTLSMigration(fmt.Errorf("invalid window %s, use a duration such as 30m or 1h", m.Window))
+	}
+	if m.Force && m.DryRun {
+		return ErrMTLSMigration(fmt.Errorf("force and dryRun are exclusive"))
+	}
+	return nil
+}
+
+// mtlsMigrationReport is what prevents, or would prevent, the namespaces
+// from being switched to STRICT
+type mtlsMigrationReport struct {
+	Blockers []string
+	Warnings []string
+	// Unchecked is set when the clients outside the namespaces could not
+	// be checked
+	Unchecked bool
+}
+
+// addPodsWithoutSidecar reports the pods without sidecar of the namespaces.
+// Once the traffic is checked, their plaintext requests are blockers of
+// their own and the pods are only warnings. Otherwise nothing tells whether
+// they talk to the workloads, and they are blockers.
+func (r *mtlsMigrationReport) addPodsWithoutSidecar(pods []string, trafficChecked bool, window string) {
+	for _, pod := range pods {
+		if trafficChecked {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("pod %s has no sidecar, it sent no plaintext request to the workloads over the last %s but would be rejected if it did", pod, window))
+			continue
+		}
+		r.Blockers = append(r.Blockers, fmt.Sprintf("pod %s has no sidecar, its requests to the workloads would be rejected and its traffic could not be checked", pod))
+	}
+}
+
+// blocking returns the reason why STRICT cannot be applied without force:
+// the blockers, or the clients which could not be checked
+func (r mtlsMigrationReport) blocking() error {
+	if len(r.Blockers) > 0 {
+		return ErrMTLSMigration(fmt.Errorf("STRICT was not applied because of %d blocker(s): %s", len(r.Blockers), strings.Join(r.Blockers, "; ")))
+	}
+	if r.Unchecked {
+		return ErrMTLSMigration(fmt.Errorf("STRICT was not applied because the clients in the other namespaces and outside the cluster could not be checked without Prometheus, use force to apply it anyway"))
+	}
+	return nil
+}
+
+// plaintextTrafficQuery returns the PromQL query of the requests received by
+// the sidecars of the namespaces without mutual TLS
+func plaintextTrafficQuery(namespaces []string, window string) string {
+	return fmt.Sprintf(
+		`sum by (source_workload, source_workload_namespace, destination_workload, destination_workload_namespace, connection_security_policy) (increase(istio_requests_total{reporter="destination", connection_security_policy!="mutual_tls", destination_workload_namespace=~"%s"}[%s])) > 0`,
+		promQLNamespaces(namespaces), window,
+	)
+}
+
+// plaintextBlockers returns a blocker for each series of the result of the
+// plaintext traffic query
+func plaintextBlockers(samples []prometheusSample) []string {
+	var blockers []string
+	for _, sample := range samples {
+		m := sample.Metric
+		source := fmt.Sprintf("%s/%s", m["source_workload_namespace"], m["source_workload"])
+		if m["source_workload"] == "" || m["source_workload"] == "unknown" {
+			source = "a client outside the mesh"
+		}
+		requests := "some"
+		if v := sample.value(); v != "" {
+			requests = strings.SplitN(v, ".", 2)[0]
+		}
+		blockers = append(blockers, fmt.Sprintf("%s sent %s request(s) to %s/%s with connection security policy %s",
+			source, requests, m["destination_workload_namespace"], m["destination_workload"], m["connection_security_policy"]))
+	}
+	sort.Strings(blockers)
+	return blockers
+}
+
+// podsWithoutSidecar returns the running pods which have no sidecar, and
+// whose requests to the workloads of the namespace would be rejected if
+// they send any
+func podsWithoutSidecar(pods []corev1.Pod) []string {
+	var names []string
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning && pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		if !hasSidecar(pod) {
+			names = append(names, pod.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrateToStrictMTLS checks that every client of the workloads of the
+// namespaces uses mutual TLS, and only then applies STRICT to them unless
+// forced
+func (istio *Istio) migrateToStrictMTLS(namespace string, migration mtlsMigration, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if len(migration.Namespaces) == 0 && namespace != "" {
+		migration.Namespaces = []string{namespace}
+	}
+	if err := migration.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	report := mtlsMigrationReport{}
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterReport, err := checkStrictMTLSOnSingleCluster(migration, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			report.Blockers = append(report.Blockers, clusterReport.Blockers...)
+			report.Warnings = append(report.Warnings, clusterReport.Warnings...)
+			report.Unchecked = report.Unchecked || clusterReport.Unchecked
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return st, nil, ErrMTLSMigration(mergeErrors(errs))
+	}
+
+	msgs := append([]string{}, report.Warnings...)
+	for _, blocker := range report.Blockers {
+		msgs = append(msgs, "blocker: "+blocker)
+	}
+	if migration.DryRun {
+		if len(report.Blockers) == 0 && report.Unchecked {
+			msgs = append(msgs, fmt.Sprintf("no blocker found in %s, but the clients in the other namespaces were not checked", strings.Join(migration.Namespaces, ", ")))
+		} else if len(report.Blockers) == 0 {
+			msgs = append(msgs, fmt.Sprintf("no blocker found, %s can be switched to STRICT", strings.Join(migration.Namespaces, ", ")))
+		}
+		return status.Completed, msgs, nil
+	}
+	if err := report.blocking(); err != nil && !migration.Force {
+		return st, msgs, err
+	}
+
+	for _, ns := range migration.Namespaces {
+		_, nsMsgs, err := istio.configureMTLS(ns, false, mtlsModeStrict, defaultMTLSPolicy(), kubeconfigs)
+		msgs = append(msgs, nsMsgs...)
+		if err != nil {
+			return st, msgs, ErrMTLSMigration(err)
+		}
+	}
+	return status.Deployed, msgs, nil
+}
+
+func checkStrictMTLSOnSingleCluster(migration mtlsMigration, mclient *mesherykube.Client) (mtlsMigrationReport, error) {
+	report := mtlsMigrationReport{}
+	var sidecarless []string
+	for _, ns := range migration.Namespaces {
+		pods, err := mclient.KubeClient.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return report, err
+		}
+		for _, pod := range podsWithoutSidecar(pods.Items) {
+			sidecarless = append(sidecarless, ns+"/"+pod)
+		}
+	}
+
+	samples, found, err := queryPrometheus(mclient, migration.PrometheusNamespace, migration.PrometheusService, plaintextTrafficQuery(migration.Namespaces, migration.Window))
+	if err != nil {
+		return report, err
+	}
+	if !found {
+		report.Unchecked = true
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Prometheus was not found in %s: the clients in the other namespaces and outside the cluster could NOT be checked, and the pods without sidecar of %s are blockers since their traffic is unknown", migration.PrometheusNamespace, strings.Join(migration.Namespaces, ", ")))
+		report.addPodsWithoutSidecar(sidecarless, false, migration.Window)
+		return report, nil
+	}
+	report.Blockers = append(report.Blockers, plaintextBlockers(samples)...)
+	report.addPodsWithoutSidecar(sidecarless, true, migration.Window)
+	return report, nil
+}
@@ -0,0 +1,152 @@
+package istio
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMTLSMigration_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			params: "{namespaces: [bookinfo]}",
+		},
+		{
+			name:    "no namespace",
+			params:  "",
+			wantErr: true,
+		},
+		{
+			name:    "invalid window",
+			params:  "{namespaces: [bookinfo], window: an hour}",
+			wantErr: true,
+		},
+		{
+			name:    "forced dry run",
+			params:  "{namespaces: [bookinfo], force: true, dryRun: true}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migration := defaultMTLSMigration()
+			if err := parseOperationParams(tt.params, &migration); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := migration.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("mtlsMigration.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlaintextTrafficQuery(t *testing.T) {
+	query := plaintextTrafficQuery([]string{"bookinfo", "shop.v2"}, "30m")
+	for _, want := range []string{`connection_security_policy!="mutual_tls"`, `destination_workload_namespace=~"bookinfo|shop\\.v2"`, `[30m]`, `reporter="destination"`} {
+		if !strings.Contains(query, want) {
+			t.Errorf("plaintextTrafficQuery() = %s, missing %s", query, want)
+		}
+	}
+}
+
+func TestPlaintextBlockers(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "plaintext clients",
+			body: `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"source_workload":"unknown","source_workload_namespace":"unknown","destination_workload":"reviews-v1","destination_workload_namespace":"bookinfo","connection_security_policy":"none"},"value":[1700000000,"42.5"]},
+				{"metric":{"source_workload":"sleep","source_workload_namespace":"legacy","destination_workload":"ratings-v1","destination_workload_namespace":"bookinfo","connection_security_policy":"none"},"value":[1700000000,"3"]}]}}`,
+			want: []string{
+				"a client outside the mesh sent 42 request(s) to bookinfo/reviews-v1 with connection security policy none",
+				"legacy/sleep sent 3 request(s) to bookinfo/ratings-v1 with connection security policy none",
+			},
+		},
+		{
+			name: "no plaintext traffic",
+			body: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		},
+		{
+			name:    "failed query",
+			body:    `{"status":"error","error":"parse error"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := parsePrometheusVector([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePrometheusVector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := plaintextBlockers(samples); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plaintextBlockers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodsWithoutSidecar(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase, containers ...string) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.PodStatus{Phase: phase}}
+		for _, c := range containers {
+			p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: c})
+		}
+		return p
+	}
+	pods := []corev1.Pod{
+		pod("reviews", corev1.PodRunning, "reviews", sidecarContainerName),
+		pod("legacy", corev1.PodRunning, "legacy"),
+		pod("job", corev1.PodSucceeded, "job"),
+		pod("starting", corev1.PodPending, "starting"),
+	}
+	if got, want := podsWithoutSidecar(pods), []string{"legacy", "starting"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("podsWithoutSidecar() = %v, want %v", got, want)
+	}
+}
+
+func TestMTLSMigrationReport_addPodsWithoutSidecar(t *testing.T) {
+	pods := []string{"bookinfo/legacy"}
+
+	checked := mtlsMigrationReport{}
+	checked.addPodsWithoutSidecar(pods, true, "1h")
+	if len(checked.Blockers) != 0 || len(checked.Warnings) != 1 {
+		t.Errorf("addPodsWithoutSidecar() with the traffic checked = %+v, want a warning only", checked)
+	}
+
+	unchecked := mtlsMigrationReport{}
+	unchecked.addPodsWithoutSidecar(pods, false, "1h")
+	if len(unchecked.Blockers) != 1 || len(unchecked.Warnings) != 0 {
+		t.Errorf("addPodsWithoutSidecar() without the traffic checked = %+v, want a blocker only", unchecked)
+	}
+}
+
+func TestMTLSMigrationReport_blocking(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  mtlsMigrationReport
+		wantErr bool
+	}{
+		{name: "checked without blocker", report: mtlsMigrationReport{Warnings: []string{"pod default/legacy has no sidecar"}}},
+		{name: "blockers", report: mtlsMigrationReport{Blockers: []string{"a client outside the mesh sent 3 request(s)"}}, wantErr: true},
+		{name: "unchecked clients", report: mtlsMigrationReport{Unchecked: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.report.blocking(); (err != nil) != tt.wantErr {
+				t.Errorf("mtlsMigrationReport.blocking() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
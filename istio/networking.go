@@ -0,0 +1,63 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	yamlv2 "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+var virtualServiceGVR = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+
+// qualifiedHost returns the fully qualified name of a host as resolved from
+// the namespace, short service names being relative to the namespace
+func qualifiedHost(host, namespace string) string {
+	switch strings.Count(host, ".") {
+	case 0:
+		return fmt.Sprintf("%s.%s.svc.cluster.local", host, namespace)
+	case 1:
+		return fmt.Sprintf("%s.svc.cluster.local", host)
+	}
+	return host
+}
+
+// virtualServicesForHost returns the VirtualServices of the namespace which
+// route the traffic of the host
+func virtualServicesForHost(mclient *mesherykube.Client, namespace, host string) ([]unstructured.Unstructured, error) {
+	list, err := mclient.DynamicKubeClient.Resource(virtualServiceGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	target := qualifiedHost(host, namespace)
+	var matching []unstructured.Unstructured
+	for _, vs := range list.Items {
+		hosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+		for _, h := range hosts {
+			if qualifiedHost(h, namespace) == target {
+				matching = append(matching, vs)
+				break
+			}
+		}
+	}
+	return matching, nil
+}
+
+// toUnstructuredSlice converts a list decoded from the operation parameters
+// into one which can be set on unstructured objects
+func toUnstructuredSlice(in []interface{}) ([]interface{}, error) {
+	byt, err := yamlv2.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	if err := yaml.Unmarshal(byt, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
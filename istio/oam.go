@@ -22,11 +22,12 @@ func (istio *Istio) HandleComponents(comps []v1alpha1.Component, isDel bool, kub
 	var msgs []string
 
 	compFuncMap := map[string]CompHandler{
-		"IstioMesh":            handleComponentIstioMesh,
-		"GrafanaIstioAddon":    handleComponentIstioAddon,
-		"PrometheusIstioAddon": handleComponentIstioAddon,
-		"ZipkinIstioAddon":     handleComponentIstioAddon,
-		"JaegerIstioAddon":     handleComponentIstioAddon,
+		"IstioMesh":               handleComponentIstioMesh,
+		"GrafanaIstioAddon":       handleComponentIstioAddon,
+		"PrometheusIstioAddon":    handleComponentIstioAddon,
+		"ZipkinIstioAddon":        handleComponentIstioAddon,
+		"JaegerIstioAddon":        handleComponentIstioAddon,
+		"OpenTelemetryIstioAddon": handleComponentIstioAddon,
 	}
 	stat1 := "deploying"
 	stat2 := "deployed"
@@ -91,10 +92,7 @@ func (istio *Istio) HandleApplicationConfiguration(config v1alpha1.Configuration
 	for _, comp := range config.Spec.Components {
 		for _, trait := range comp.Traits {
 			if trait.Name == "mTLS" {
-				namespaces := castSliceInterfaceToSliceString(trait.Properties["namespaces"].([]interface{}))
-				policy := trait.Properties["policy"].(string)
-
-				if err := handleMTLS(istio, namespaces, policy, isDel, kubeconfigs); err != nil {
+				if err := handleMTLS(istio, comp.ComponentName, trait.Properties, isDel, kubeconfigs); err != nil {
 					errs = append(errs, err)
 				}
 			}
@@ -106,6 +104,42 @@ func (istio *Istio) HandleApplicationConfiguration(config v1alpha1.Configuration
 				}
 			}
 
+			if trait.Name == "accessLogging" {
+				if err := handleAccessLogging(istio, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if trait.Name == "faultInjection" {
+				if err := handleFaultInjection(istio, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if trait.Name == "circuitBreaker" {
+				if err := handleCircuitBreaker(istio, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if trait.Name == "localRateLimit" {
+				if err := handleLocalRateLimit(istio, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if trait.Name == "authorizationPolicy" {
+				if err := handleAuthorizationPolicy(istio, comp.ComponentName, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if trait.Name == "requestAuthentication" {
+				if err := handleRequestAuthentication(istio, comp.ComponentName, trait.Properties, isDel, kubeconfigs); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
 			msgs = append(msgs, fmt.Sprintf("applied trait \"%s\" on service \"%s\"", trait.Name, comp.ComponentName))
 		}
 	}
@@ -117,12 +151,32 @@ func (istio *Istio) HandleApplicationConfiguration(config v1alpha1.Configuration
 	return mergeMsgs(msgs), nil
 }
 
-func handleMTLS(istio *Istio, namespaces []string, policy string, isDel bool, kubeconfigs []string) error {
-	var errs []error
-	for _, ns := range namespaces {
-		policyName := fmt.Sprintf("%s-mtls-policy-operation", policy)
+// handleMTLS applies the policy, strict, mutual or disable, at the scope of
+// the trait. The workload scope defaults to the workloads of the service.
+func handleMTLS(istio *Istio, service string, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	settings := struct {
+		Namespaces []string `yaml:"namespaces"`
+		Policy     string   `yaml:"policy"`
+		mtlsPolicy `yaml:",inline"`
+	}{mtlsPolicy: defaultMTLSPolicy()}
+	if err := parseSettings(properties, &settings); err != nil {
+		return err
+	}
+	mode, ok := mtlsModes[fmt.Sprintf("%s-mtls-policy-operation", settings.Policy)]
+	if !ok {
+		return ErrApplyPolicy(fmt.Errorf("invalid policy %s, use strict, mutual or disable", settings.Policy))
+	}
+	if settings.Scope == MTLSScopeWorkload && len(settings.Selector) == 0 {
+		settings.Selector = map[string]string{"app": service}
+	}
+	if settings.Scope == MTLSScopeMesh {
+		_, _, err := istio.configureMTLS("", isDel, mode, settings.mtlsPolicy, kubeconfigs)
+		return err
+	}
 
-		if _, err := istio.applyPolicy(ns, isDel, config.GetOperations(common.Operations, "master")[policyName].Templates, kubeconfigs); err != nil {
+	var errs []error
+	for _, ns := range settings.Namespaces {
+		if _, _, err := istio.configureMTLS(ns, isDel, mode, settings.mtlsPolicy, kubeconfigs); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -130,6 +184,93 @@ func handleMTLS(istio *Istio, namespaces []string, policy string, isDel bool, ku
 	return mergeErrors(errs)
 }
 
+func handleAccessLogging(istio *Istio, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	logging := defaultAccessLogging()
+	if err := parseSettings(properties, &logging); err != nil {
+		return err
+	}
+	_, _, err := istio.configureAccessLogging(isDel, logging, kubeconfigs)
+	return err
+}
+
+func handleFaultInjection(istio *Istio, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	fault := defaultFaultInjection()
+	if err := parseSettings(properties, &fault); err != nil {
+		return err
+	}
+	if fault.Namespace == "" {
+		fault.Namespace = "default"
+	}
+	_, _, err := istio.configureFaultInjection(fault.Namespace, isDel, fault, kubeconfigs)
+	return err
+}
+
+func handleCircuitBreaker(istio *Istio, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	breaker := circuitBreaker{}
+	if err := parseSettings(properties, &breaker); err != nil {
+		return err
+	}
+	if breaker.Namespace == "" {
+		breaker.Namespace = "default"
+	}
+	_, _, err := istio.configureCircuitBreaker(breaker.Namespace, isDel, breaker, kubeconfigs)
+	return err
+}
+
+func handleLocalRateLimit(istio *Istio, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	limit := defaultLocalRateLimit()
+	if err := parseSettings(properties, &limit); err != nil {
+		return err
+	}
+	if limit.Namespace == "" {
+		limit.Namespace = "default"
+	}
+	_, _, err := istio.configureLocalRateLimit(limit.Namespace, isDel, limit, kubeconfigs)
+	return err
+}
+
+// handleAuthorizationPolicy applies the policy on the workloads of the
+// service unless the trait names another selector
+func handleAuthorizationPolicy(istio *Istio, service string, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	policy := defaultAuthorizationPolicy()
+	if err := parseSettings(properties, &policy); err != nil {
+		return err
+	}
+	if policy.Namespace == "" {
+		policy.Namespace = "default"
+	}
+	if policy.Name == "" {
+		policy.Name = service
+	}
+	if len(policy.Selector) == 0 {
+		policy.Selector = map[string]string{"app": service}
+	}
+	_, _, err := istio.configureAuthorizationPolicy(policy.Namespace, isDel, policy, kubeconfigs)
+	return err
+}
+
+// handleRequestAuthentication authenticates the requests to the workloads of
+// the service unless the trait targets a gateway or another selector
+func handleRequestAuthentication(istio *Istio, service string, properties map[string]interface{}, isDel bool, kubeconfigs []string) error {
+	auth := defaultRequestAuthentication()
+	if err := parseSettings(properties, &auth); err != nil {
+		return err
+	}
+	if auth.Namespace == "" {
+		auth.Namespace = "default"
+	}
+	if auth.Name == "" {
+		auth.Name = service
+	}
+	if !auth.Gateway && len(auth.Selector) == 0 {
+		auth.Selector = map[string]string{"app": service}
+	}
+	// tokens are only minted through the operation
+	auth.MintToken = false
+	_, _, err := istio.configureRequestAuthentication(auth.Namespace, isDel, auth, kubeconfigs)
+	return err
+}
+
 func handleNamespaceLabel(istio *Istio, namespaces []string, isDel bool, kubeconfigs []string) error {
 	var errs []error
 	for _, ns := range namespaces {
@@ -212,6 +353,8 @@ func handleComponentIstioAddon(istio *Istio, comp v1alpha1.Component, isDel bool
 		addonName = config.ZipkinAddon
 	case "JaegerIstioAddon":
 		addonName = config.JaegerAddon
+	case "OpenTelemetryIstioAddon":
+		addonName = config.OpenTelemetryAddon
 	default:
 		return "", nil
 	}
@@ -219,18 +362,21 @@ func handleComponentIstioAddon(istio *Istio, comp v1alpha1.Component, isDel bool
 	// Get the service
 	svc := config.GetOperations(common.Operations, version)[addonName].AdditionalProperties[common.ServiceName]
 
-	// Get the patches
-	patches := make([]string, 0)
-	patches = append(patches, config.GetOperations(common.Operations, version)[addonName].AdditionalProperties[config.ServicePatchFile])
-	patches = append(patches, config.GetOperations(common.Operations, version)[addonName].AdditionalProperties[config.CPPatchFile])
-	patches = append(patches, config.GetOperations(common.Operations, version)[addonName].AdditionalProperties[config.ControlPatchFile])
+	// Get the exposure mode of the addon
+	exposure := defaultAddonExposure()
+	if err := parseSettings(comp.Spec.Settings, &exposure); err != nil {
+		return "", err
+	}
 
 	// Get the templates
 	templates := config.GetOperations(common.Operations, version)[addonName].Templates
 
-	_, err := istio.installAddon(comp.Namespace, isDel, svc, patches, templates, kubeconfigs)
+	_, endpoints, err := istio.installAddon(comp.Namespace, isDel, svc, exposure, templates, kubeconfigs)
 
 	msg := fmt.Sprintf("created service of type \"%s\"", comp.Spec.Type)
+	for _, endpoint := range endpoints {
+		msg = fmt.Sprintf("%s\n%s", msg, endpoint)
+	}
 	if isDel {
 		msg = fmt.Sprintf("deleted service of type \"%s\"", comp.Spec.Type)
 	}
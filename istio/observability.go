@@ -0,0 +1,430 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	monitorsTemplateFile = "file://templates/observability/monitors.yaml"
+
+	kialiNamespace     = "istio-system"
+	kialiConfigMapName = "kiali"
+	kialiConfigKey     = "config.yaml"
+
+	// kialiBackendsAnnotation records on the config map of Kiali its
+	// settings before it was pointed to the external backends
+	kialiBackendsAnnotation = "meshery.io/observability-backends"
+	// tracingProvidersAnnotation records on the mesh config map, for each
+	// external tracing provider, the settings of the mesh it replaced
+	tracingProvidersAnnotation = "meshery.io/tracing-providers"
+)
+
+// observabilityBackends describes the existing observability backends the
+// mesh should be wired to
+type observabilityBackends struct {
+	Prometheus struct {
+		// URL of the Prometheus query API, used by Kiali
+		URL string `yaml:"url,omitempty"`
+		// Namespace in which the ServiceMonitor and PodMonitor are created,
+		// usually the one watched by the Prometheus operator
+		MonitorNamespace string `yaml:"monitorNamespace,omitempty"`
+		// Labels required by the monitor selectors of the Prometheus resource
+		MonitorLabels map[string]string `yaml:"monitorLabels,omitempty"`
+	} `yaml:"prometheus,omitempty"`
+	Tracing struct {
+		tracingProvider `yaml:",inline"`
+		// URL of the tracing query API, used by Kiali
+		URL string `yaml:"url,omitempty"`
+		// Makes the provider the default tracing provider of the mesh
+		Default bool `yaml:"default,omitempty"`
+	} `yaml:"tracing,omitempty"`
+}
+
+func defaultObservabilityBackends() observabilityBackends {
+	b := observabilityBackends{}
+	b.Prometheus.MonitorNamespace = "monitoring"
+	b.Tracing.Name = "external-tracing"
+	b.Tracing.Provider = TracingProviderZipkin
+	b.Tracing.Default = true
+	return b
+}
+
+func (b observabilityBackends) validate() error {
+	if b.Prometheus.URL == "" && b.Tracing.Service == "" {
+		return ErrObservabilityBackend(fmt.Errorf("neither a prometheus nor a tracing backend was given"))
+	}
+	if b.Tracing.Service != "" {
+		if err := b.Tracing.validate(); err != nil {
+			return ErrObservabilityBackend(err)
+		}
+	}
+	return nil
+}
+
+// configureObservabilityBackends wires the mesh to existing Prometheus and
+// tracing backends instead of the sample addons
+func (istio *Istio) configureObservabilityBackends(del bool, backends observabilityBackends, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := backends.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureObservabilityOnSingleCluster(del, backends, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrObservabilityBackend(mergeErrors(errs))
+}
+
+func (istio *Istio) configureObservabilityOnSingleCluster(del bool, backends observabilityBackends, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+
+	if !del {
+		for _, endpoint := range []string{backends.Prometheus.URL, backends.Tracing.URL, backends.Tracing.serviceURL()} {
+			if endpoint == "" {
+				continue
+			}
+			external, err := resolveClusterEndpoint(mclient, endpoint)
+			if err != nil {
+				return msgs, err
+			}
+			if external {
+				msgs = append(msgs, fmt.Sprintf("%s is not a cluster service, whether it is reachable from the cluster was not checked", endpoint))
+			}
+		}
+	}
+
+	if backends.Prometheus.URL != "" {
+		manifest, err := renderTemplate(monitorsTemplateFile, map[string]interface{}{
+			"Namespace": backends.Prometheus.MonitorNamespace,
+			"Labels":    backends.Prometheus.MonitorLabels,
+		})
+		if err != nil {
+			return msgs, err
+		}
+		if !del {
+			missing, err := missingKinds(mclient, parseManifestResources(manifest))
+			if err != nil {
+				return msgs, err
+			}
+			if len(missing) > 0 {
+				return msgs, ErrMissingCRD(missing)
+			}
+		}
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, backends.Prometheus.MonitorNamespace, mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("ServiceMonitor for istiod and PodMonitor for the sidecars %s in namespace %s", pastTense(del), backends.Prometheus.MonitorNamespace))
+	}
+
+	if backends.Tracing.Service != "" {
+		err := updateRecordedMeshConfig(mclient, func(mesh meshConfig, annotations map[string]string) error {
+			records := map[string]fieldsRecord{}
+			if raw, ok := annotations[tracingProvidersAnnotation]; ok {
+				if err := json.Unmarshal([]byte(raw), &records); err != nil {
+					return err
+				}
+			}
+			if del {
+				mesh.removeExtensionProvider(backends.Tracing.Name)
+				if record, ok := records[backends.Tracing.Name]; ok {
+					if err := record.restore(mesh); err != nil {
+						return err
+					}
+					delete(records, backends.Tracing.Name)
+				}
+			} else {
+				fields := []string{"enableTracing"}
+				if backends.Tracing.Default {
+					fields = append(fields, "defaultProviders.tracing")
+				}
+				records[backends.Tracing.Name] = records[backends.Tracing.Name].extend(mesh, fields...)
+				mesh["enableTracing"] = true
+				mesh.setExtensionProvider(backends.Tracing.extensionProvider())
+				if backends.Tracing.Default {
+					mesh.setDefaultProvider("tracing", backends.Tracing.Name)
+				}
+			}
+			if len(records) == 0 {
+				delete(annotations, tracingProvidersAnnotation)
+				return nil
+			}
+			byt, err := json.Marshal(records)
+			if err != nil {
+				return err
+			}
+			annotations[tracingProvidersAnnotation] = string(byt)
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("tracing extension provider %s %s in the mesh config", backends.Tracing.Name, pastTense(del)))
+	}
+
+	if del {
+		restored, err := restoreKialiBackends(mclient)
+		if err != nil {
+			return msgs, err
+		}
+		if restored {
+			msgs = append(msgs, "Kiali configuration restored")
+		}
+		return msgs, nil
+	}
+
+	configured, err := configureKialiBackends(mclient, backends)
+	if err != nil {
+		return msgs, err
+	}
+	if configured {
+		msgs = append(msgs, "Kiali configured to use the external backends")
+	}
+	return msgs, nil
+}
+
+// configureKialiBackends points an installed Kiali to the external Prometheus
+// and tracing backends, and restarts it to pick up the configuration.
+// It reports false if Kiali is not installed.
+func configureKialiBackends(mclient *mesherykube.Client, backends observabilityBackends) (bool, error) {
+	cmClient := mclient.KubeClient.CoreV1().ConfigMaps(kialiNamespace)
+	cm, err := cmClient.Get(context.TODO(), kialiConfigMapName, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+
+	kiali := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(cm.Data[kialiConfigKey]), &kiali); err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	var fields []string
+	if backends.Prometheus.URL != "" {
+		fields = append(fields, "external_services.prometheus.url")
+	}
+	if backends.Tracing.URL != "" {
+		fields = append(fields, "external_services.tracing.enabled", "external_services.tracing.in_cluster_url")
+	}
+	record := fieldsRecord{}
+	if raw, ok := cm.Annotations[kialiBackendsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			return false, ErrObservabilityBackend(err)
+		}
+	}
+	byt, err := json.Marshal(record.extend(kiali, fields...))
+	if err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[kialiBackendsAnnotation] = string(byt)
+
+	services, ok := kiali["external_services"].(map[string]interface{})
+	if !ok {
+		services = map[string]interface{}{}
+		kiali["external_services"] = services
+	}
+	if backends.Prometheus.URL != "" {
+		prometheus, ok := services["prometheus"].(map[string]interface{})
+		if !ok {
+			prometheus = map[string]interface{}{}
+			services["prometheus"] = prometheus
+		}
+		prometheus["url"] = backends.Prometheus.URL
+	}
+	if backends.Tracing.URL != "" {
+		tracing, ok := services["tracing"].(map[string]interface{})
+		if !ok {
+			tracing = map[string]interface{}{}
+			services["tracing"] = tracing
+		}
+		tracing["enabled"] = true
+		tracing["in_cluster_url"] = backends.Tracing.URL
+	}
+
+	if err := updateKialiConfig(mclient, cm, kiali); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreKialiBackends restores the settings of Kiali recorded before it
+// was pointed to the external backends. It reports false if Kiali is not
+// installed or was not configured.
+func restoreKialiBackends(mclient *mesherykube.Client) (bool, error) {
+	cm, err := mclient.KubeClient.CoreV1().ConfigMaps(kialiNamespace).Get(context.TODO(), kialiConfigMapName, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	raw, ok := cm.Annotations[kialiBackendsAnnotation]
+	if !ok {
+		return false, nil
+	}
+	record := fieldsRecord{}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	kiali := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(cm.Data[kialiConfigKey]), &kiali); err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	if err := record.restore(kiali); err != nil {
+		return false, ErrObservabilityBackend(err)
+	}
+	delete(cm.Annotations, kialiBackendsAnnotation)
+	if err := updateKialiConfig(mclient, cm, kiali); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updateKialiConfig writes the configuration of Kiali to its config map and
+// restarts it to pick up the configuration
+func updateKialiConfig(mclient *mesherykube.Client, cm *corev1.ConfigMap, kiali map[string]interface{}) error {
+	byt, err := yaml.Marshal(kiali)
+	if err != nil {
+		return ErrObservabilityBackend(err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[kialiConfigKey] = string(byt)
+	if _, err := mclient.KubeClient.CoreV1().ConfigMaps(kialiNamespace).Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		return ErrObservabilityBackend(err)
+	}
+
+	restart := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+	_, err = mclient.KubeClient.AppsV1().Deployments(kialiNamespace).Patch(context.TODO(), "kiali", types.StrategicMergePatchType, []byte(restart), metav1.PatchOptions{})
+	if err != nil && !kubeerror.IsNotFound(err) {
+		return ErrObservabilityBackend(err)
+	}
+	return nil
+}
+
+// clusterServiceHost parses the host as the name of a cluster Service, in
+// the name[.namespace[.svc[.cluster.local]]] form. Bare names are taken
+// relative to the namespace of the control plane and Kiali, which use the
+// endpoints. ambiguous is set for name.namespace hosts, which may as well
+// be external names such as tempo.example.
+func clusterServiceHost(host string) (name, namespace string, ambiguous, ok bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+	switch {
+	case strings.HasSuffix(host, ".svc.cluster.local") && len(labels) == 5,
+		strings.HasSuffix(host, ".svc") && len(labels) == 3:
+		name, namespace = labels[0], labels[1]
+	case len(labels) == 2:
+		name, namespace, ambiguous = labels[0], labels[1], true
+	case len(labels) == 1:
+		name, namespace = labels[0], kialiNamespace
+	default:
+		return "", "", false, false
+	}
+	if len(validation.IsDNS1035Label(name)) > 0 || len(validation.IsDNS1123Label(namespace)) > 0 {
+		return "", "", false, false
+	}
+	return name, namespace, ambiguous, true
+}
+
+// resolveClusterEndpoint checks that the host of the URL names a cluster
+// Service with ready endpoints. Hosts which are not cluster service names
+// are reported as external, their resolution from the cluster is not
+// checked.
+func resolveClusterEndpoint(mclient *mesherykube.Client, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, ErrEndpointUnresolvable(rawURL, err)
+	}
+	if u.Hostname() == "" {
+		return false, ErrEndpointUnresolvable(rawURL, fmt.Errorf("the URL has no host"))
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return true, nil
+	}
+	name, namespace, ambiguous, ok := clusterServiceHost(u.Hostname())
+	if !ok {
+		return true, nil
+	}
+	if ambiguous {
+		// name.namespace is a cluster service name only when the namespace exists
+		_, err := mclient.KubeClient.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+		if kubeerror.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, ErrEndpointUnresolvable(rawURL, err)
+		}
+	}
+
+	eps, err := mclient.KubeClient.CoreV1().Endpoints(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return false, ErrEndpointUnresolvable(rawURL, err)
+	}
+	for _, subset := range eps.Subsets {
+		if len(subset.Addresses) > 0 {
+			return false, nil
+		}
+	}
+	return false, ErrEndpointUnresolvable(rawURL, fmt.Errorf("service %s/%s has no ready endpoints", namespace, name))
+}
+
+func pastTense(del bool) string {
+	if del {
+		return "removed"
+	}
+	return "configured"
+}
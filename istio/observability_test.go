@@ -0,0 +1,30 @@
+package istio
+
+import "testing"
+
+func TestClusterServiceHost(t *testing.T) {
+	tests := []struct {
+		host          string
+		wantName      string
+		wantNamespace string
+		wantAmbiguous bool
+		wantOK        bool
+	}{
+		{host: "tempo", wantName: "tempo", wantNamespace: kialiNamespace, wantOK: true},
+		{host: "tempo.tracing", wantName: "tempo", wantNamespace: "tracing", wantAmbiguous: true, wantOK: true},
+		{host: "tempo.tracing.svc", wantName: "tempo", wantNamespace: "tracing", wantOK: true},
+		{host: "tempo.tracing.svc.cluster.local", wantName: "tempo", wantNamespace: "tracing", wantOK: true},
+		{host: "tempo.tracing.svc.cluster.local.", wantName: "tempo", wantNamespace: "tracing", wantOK: true},
+		{host: "tempo.example.com"},
+		{host: "tempo.tracing.cluster.local"},
+		{host: "tempo_1.tracing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			name, namespace, ambiguous, ok := clusterServiceHost(tt.host)
+			if name != tt.wantName || namespace != tt.wantNamespace || ambiguous != tt.wantAmbiguous || ok != tt.wantOK {
+				t.Errorf("clusterServiceHost() = %s, %s, %v, %v, want %s, %s, %v, %v", name, namespace, ambiguous, ok, tt.wantName, tt.wantNamespace, tt.wantAmbiguous, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package istio
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/layer5io/meshkit/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// parseOperationParams decodes the parameters of an operation into out.
+//
+// Parameters are passed by Meshery Server as a YAML (or JSON) document in the
+// body of the operation request. An empty body leaves out untouched so that
+// the defaults set by the caller apply.
+func parseOperationParams(body string, out interface{}) error {
+	if strings.TrimSpace(body) == "" {
+		return nil
+	}
+	if err := yaml.Unmarshal([]byte(body), out); err != nil {
+		return ErrInvalidOperationParams(err)
+	}
+	return nil
+}
+
+// parseSettings decodes the settings of an OAM component, or the properties
+// of an OAM trait, into out
+func parseSettings(settings map[string]interface{}, out interface{}) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	byt, err := yaml.Marshal(settings)
+	if err != nil {
+		return ErrInvalidOperationParams(err)
+	}
+	if err := yaml.Unmarshal(byt, out); err != nil {
+		return ErrInvalidOperationParams(err)
+	}
+	return nil
+}
+
+// renderTemplate reads the template from the given location and executes it
+// with the passed data
+func renderTemplate(location string, data interface{}) (string, error) {
+	contents, err := utils.ReadFileSource(location)
+	if err != nil {
+		return "", ErrRenderTemplate(err)
+	}
+
+	tmpl, err := template.New(location).Option("missingkey=error").Parse(contents)
+	if err != nil {
+		return "", ErrRenderTemplate(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", ErrRenderTemplate(err)
+	}
+	return buf.String(), nil
+}
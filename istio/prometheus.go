@@ -0,0 +1,87 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	prometheusAddonService = "prometheus"
+	prometheusAddonPort    = "9090"
+)
+
+// prometheusDurationRegex matches the durations of PromQL range selectors
+var prometheusDurationRegex = regexp.MustCompile(`^\d+(ms|s|m|h|d|w|y)$`)
+
+// prometheusSample is a series of the result of an instant query
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// value returns the value of the sample as formatted by Prometheus
+func (s prometheusSample) value() string {
+	if len(s.Value) == 2 {
+		if v, ok := s.Value[1].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// parsePrometheusVector returns the series of the response to an instant
+// query
+func parsePrometheusVector(body []byte) ([]prometheusSample, error) {
+	var resp struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []prometheusSample `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus response: %w", err)
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", resp.Error)
+	}
+	return resp.Data.Result, nil
+}
+
+// queryPrometheus runs the instant query through the service proxy of the
+// API server, and tells whether the Prometheus service exists
+func queryPrometheus(mclient *mesherykube.Client, namespace, service, query string) ([]prometheusSample, bool, error) {
+	services := mclient.KubeClient.CoreV1().Services(namespace)
+	_, err := services.Get(context.TODO(), service, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	body, err := services.
+		ProxyGet("http", service, prometheusAddonPort, "/api/v1/query", map[string]string{"query": query}).
+		DoRaw(context.TODO())
+	if err != nil {
+		return nil, true, fmt.Errorf("could not query Prometheus %s/%s: %w", namespace, service, err)
+	}
+	samples, err := parsePrometheusVector(body)
+	return samples, true, err
+}
+
+// promQLNamespaces returns the regular expression matching the namespaces,
+// with its backslashes escaped in the PromQL string
+func promQLNamespaces(namespaces []string) string {
+	quoted := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		quoted = append(quoted, strings.ReplaceAll(regexp.QuoteMeta(ns), `\`, `\\`))
+	}
+	return strings.Join(quoted, "|")
+}
@@ -0,0 +1,215 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	readinessTimeout      = 300 // time in seconds to wait for workloads to become ready
+	readinessPollInterval = 2   // time in seconds between two readiness checks
+
+	sidecarContainerName = "istio-proxy"
+)
+
+// manifestResource identifies a resource defined in a manifest
+type manifestResource struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Group string `yaml:"group"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+	} `yaml:"spec"`
+}
+
+func (r manifestResource) groupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(r.APIVersion, r.Kind)
+}
+
+// parseManifestResources lists the resources defined in a multi document
+// manifest, skipping the documents which are not kubernetes objects
+func parseManifestResources(manifest string) []manifestResource {
+	var resources []manifestResource
+	for _, doc := range strings.Split(manifest, "\n---") {
+		var res manifestResource
+		if err := yaml.Unmarshal([]byte(doc), &res); err != nil || res.Kind == "" {
+			continue
+		}
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+// missingKinds returns the kinds used by the resources which are not served
+// by the cluster, ignoring those whose CRD is defined among the resources
+func missingKinds(mclient *mesherykube.Client, resources []manifestResource) ([]string, error) {
+	groupResources, err := restmapper.GetAPIGroupResources(mclient.KubeClient.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	rm := restmapper.NewDiscoveryRESTMapper(groupResources)
+
+	defined := map[schema.GroupKind]bool{}
+	for _, res := range resources {
+		if res.Kind == "CustomResourceDefinition" {
+			defined[schema.GroupKind{Group: res.Spec.Group, Kind: res.Spec.Names.Kind}] = true
+		}
+	}
+
+	var missing []string
+	seen := map[schema.GroupVersionKind]bool{}
+	for _, res := range resources {
+		gvk := res.groupVersionKind()
+		if seen[gvk] || defined[gvk.GroupKind()] {
+			continue
+		}
+		seen[gvk] = true
+		if _, err := rm.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", gvk.Kind, res.APIVersion))
+		}
+	}
+	return missing, nil
+}
+
+// deploymentNames returns the names of the Deployments among the resources
+func deploymentNames(resources []manifestResource) []string {
+	var names []string
+	for _, res := range resources {
+		if res.Kind == "Deployment" {
+			names = append(names, res.Metadata.Name)
+		}
+	}
+	return names
+}
+
+// waitForDeployments blocks until all the named Deployments in the namespace
+// have rolled out and are available, or until the readiness timeout expires
+func waitForDeployments(mclient *mesherykube.Client, namespace string, names []string) error {
+	deadline := time.Now().Add(readinessTimeout * time.Second)
+	pending := names
+	for {
+		var notReady []string
+		for _, name := range pending {
+			deploy, err := mclient.KubeClient.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil || !isDeploymentAvailable(deploy) {
+				notReady = append(notReady, name)
+			}
+		}
+		if len(notReady) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrWorkloadsNotReady(namespace, notReady)
+		}
+		pending = notReady
+		time.Sleep(readinessPollInterval * time.Second)
+	}
+}
+
+// waitForSidecars blocks until all the running pods of the named Deployments
+// have the sidecar proxy, or until the readiness timeout expires. The other
+// pods of the namespace are not checked, the namespace may be shared.
+func waitForSidecars(mclient *mesherykube.Client, namespace string, deployments []string) error {
+	selectors := make([]labels.Selector, 0, len(deployments))
+	for _, name := range deployments {
+		deploy, err := mclient.KubeClient.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return ErrSidecarMissing(namespace, nil, err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+		if err != nil {
+			return ErrSidecarMissing(namespace, nil, err)
+		}
+		selectors = append(selectors, selector)
+	}
+
+	deadline := time.Now().Add(readinessTimeout * time.Second)
+	for {
+		pods, err := mclient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return ErrSidecarMissing(namespace, nil, err)
+		}
+		missing := missingSidecars(pods.Items, selectors)
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrSidecarMissing(namespace, missing, fmt.Errorf("pods are running without the sidecar proxy"))
+		}
+		time.Sleep(readinessPollInterval * time.Second)
+	}
+}
+
+// missingSidecars returns the names of the running pods matching any of the
+// selectors which do not have the sidecar proxy
+func missingSidecars(pods []corev1.Pod, selectors []labels.Selector) []string {
+	var missing []string
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, selector := range selectors {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				if !hasSidecar(pod) {
+					missing = append(missing, pod.Name)
+				}
+				break
+			}
+		}
+	}
+	return missing
+}
+
+// hasSidecar checks if the pod runs the sidecar proxy, either as a regular
+// container or as a native sidecar init container
+func hasSidecar(pod corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == sidecarContainerName {
+			return true
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == sidecarContainerName && c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			return true
+		}
+	}
+	return false
+}
+
+// isDeploymentAvailable checks if the latest revision of the Deployment has
+// been rolled out and all of its replicas are available
+func isDeploymentAvailable(deploy *appsv1.Deployment) bool {
+	if deploy.Generation > deploy.Status.ObservedGeneration {
+		return false
+	}
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	if deploy.Status.UpdatedReplicas < replicas || deploy.Status.AvailableReplicas < replicas {
+		return false
+	}
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == appsv1.DeploymentAvailable {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const testAddonManifest = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: monitoringdashboards.monitoring.kiali.io
+spec:
+  group: monitoring.kiali.io
+  names:
+    kind: MonitoringDashboard
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: kiali
+  namespace: istio-system
+---
+# comment only document
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kiali
+  namespace: istio-system
+`
+
+func TestParseManifestResources(t *testing.T) {
+	resources := parseManifestResources(testAddonManifest)
+	var kinds []string
+	for _, res := range resources {
+		kinds = append(kinds, res.Kind)
+	}
+	want := []string{"CustomResourceDefinition", "Service", "Deployment"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("parseManifestResources() kinds = %v, want %v", kinds, want)
+	}
+	if resources[0].Spec.Names.Kind != "MonitoringDashboard" || resources[0].Spec.Group != "monitoring.kiali.io" {
+		t.Errorf("parseManifestResources() did not decode the CRD spec: %+v", resources[0].Spec)
+	}
+	if got := deploymentNames(resources); !reflect.DeepEqual(got, []string{"kiali"}) {
+		t.Errorf("deploymentNames() = %v, want [kiali]", got)
+	}
+}
+
+func TestIsDeploymentAvailable(t *testing.T) {
+	replicas := int32(2)
+	tests := []struct {
+		name   string
+		deploy *appsv1.Deployment
+		want   bool
+	}{
+		{
+			name: "all replicas available",
+			deploy: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					UpdatedReplicas:   2,
+					AvailableReplicas: 2,
+					Conditions: []appsv1.DeploymentCondition{
+						{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "rollout not observed yet",
+			deploy: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 1,
+					UpdatedReplicas:    2,
+					AvailableReplicas:  2,
+				},
+			},
+			want: false,
+		},
+		{
+			name: "replicas still starting",
+			deploy: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					UpdatedReplicas:   2,
+					AvailableReplicas: 1,
+				},
+			},
+			want: false,
+		},
+		{
+			name: "available condition false",
+			deploy: &appsv1.Deployment{
+				Status: appsv1.DeploymentStatus{
+					UpdatedReplicas:   1,
+					AvailableReplicas: 1,
+					Conditions: []appsv1.DeploymentCondition{
+						{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse},
+					},
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDeploymentAvailable(tt.deploy); got != tt.want {
+				t.Errorf("isDeploymentAvailable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasSidecar(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{
+			name: "sidecar container",
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "productpage"}, {Name: "istio-proxy"}},
+			}},
+			want: true,
+		},
+		{
+			name: "native sidecar",
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "istio-proxy", RestartPolicy: &always}},
+				Containers:     []corev1.Container{{Name: "productpage"}},
+			}},
+			want: true,
+		},
+		{
+			name: "init container only",
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "istio-init"}},
+				Containers:     []corev1.Container{{Name: "productpage"}},
+			}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasSidecar(tt.pod); got != tt.want {
+				t.Errorf("hasSidecar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingSidecars(t *testing.T) {
+	selectors := []labels.Selector{labels.SelectorFromSet(map[string]string{"app": "productpage"})}
+	tests := []struct {
+		name string
+		pods []corev1.Pod
+		want []string
+	}{
+		{
+			name: "pods of the app with the sidecar",
+			pods: []corev1.Pod{*testPod("default", "productpage-v1", true, map[string]string{"app": "productpage"})},
+		},
+		{
+			name: "pod of the app without the sidecar",
+			pods: []corev1.Pod{*testPod("default", "productpage-v1", false, map[string]string{"app": "productpage"})},
+			want: []string{"productpage-v1"},
+		},
+		{
+			name: "unrelated pod without the sidecar in a shared namespace",
+			pods: []corev1.Pod{
+				*testPod("default", "productpage-v1", true, map[string]string{"app": "productpage"}),
+				*testPod("default", "legacy-0", false, map[string]string{"app": "legacy"}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingSidecars(tt.pods, selectors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingSidecars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,92 +2,381 @@ package istio
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
 	"github.com/layer5io/meshkit/utils"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
 
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-func (istio *Istio) installSampleApp(namespace string, del bool, templates []adapter.Template, kubeconfigs []string) (string, error) {
-	st := status.Installing
+const (
+	ingressGatewayNamespace = "istio-system"
 
-	if del {
-		st = status.Removing
+	// gatewayTemplateFile is the Gateway shared by the sample apps and the
+	// addons, each exposing itself through VirtualServices of its own
+	gatewayTemplateFile = "file://templates/gateway/gateway.yaml"
+
+	smokeTestTimeout = 60 // time in seconds to wait for the sample app to answer through the ingress
+)
+
+// sampleAppOptions are the parameters of the sample app operations
+type sampleAppOptions struct {
+	// Revision of the control plane injecting the sidecars, the default
+	// injection label is used when empty
+	Revision string           `yaml:"revision,omitempty"`
+	Gateway  sampleAppGateway `yaml:",inline"`
+}
+
+// defaultSampleAppOptions exposes the app over HTTP on the default ingress
+// gateway, with a gateway of its own so that apps can be installed together
+func defaultSampleAppOptions(app, host string) sampleAppOptions {
+	return sampleAppOptions{
+		Gateway: sampleAppGateway{
+			Name:      fmt.Sprintf("%s-gateway", app),
+			Namespace: ingressGatewayNamespace,
+			Host:      host,
+			Selector:  map[string]string{"istio": "ingressgateway"},
+		},
 	}
+}
 
-	for _, template := range templates {
-		err := istio.applyManifest([]byte(template.String()), del, namespace, kubeconfigs)
-		if err != nil {
-			return st, ErrSampleApp(err)
+// sampleAppGateway holds the parameters with which the gateway template of
+// a sample app is rendered
+type sampleAppGateway struct {
+	Name string `yaml:"gatewayName,omitempty"`
+	// Namespace of the gateway workload, where the TLS secret is stored
+	Namespace string            `yaml:"gatewayNamespace,omitempty"`
+	Host      string            `yaml:"host,omitempty"`
+	Selector  map[string]string `yaml:"selector,omitempty"`
+	// Port defaults to 80, or 443 with HTTPS
+	Port  int  `yaml:"port,omitempty"`
+	HTTPS bool `yaml:"https,omitempty"`
+}
+
+func (g sampleAppGateway) validate() error {
+	if g.Name == "" || g.Namespace == "" {
+		return ErrSampleApp(fmt.Errorf("gateway name and namespace are required"))
+	}
+	if g.Host == "" {
+		return ErrSampleApp(fmt.Errorf("gateway host is required"))
+	}
+	if len(g.Selector) == 0 {
+		return ErrSampleApp(fmt.Errorf("gateway selector is required"))
+	}
+	if g.Port < 0 || g.Port > 65535 {
+		return ErrSampleApp(fmt.Errorf("invalid gateway port: %d", g.Port))
+	}
+	if g.HTTPS && strings.Contains(g.Host, "*") {
+		return ErrSampleApp(fmt.Errorf("a certificate cannot be generated for the wildcard host %s", g.Host))
+	}
+	return nil
+}
+
+// withDefaultPort returns the gateway with its port set
+func (g sampleAppGateway) withDefaultPort() sampleAppGateway {
+	if g.Port == 0 {
+		g.Port = 80
+		if g.HTTPS {
+			g.Port = 443
 		}
 	}
+	return g
+}
+
+// CredentialName is the name of the TLS secret of the gateway, empty when
+// the gateway serves plain HTTP
+func (g sampleAppGateway) CredentialName() string {
+	if !g.HTTPS {
+		return ""
+	}
+	return fmt.Sprintf("%s-credential", g.Name)
+}
 
-	return status.Installed, nil
+// sampleAppRoute is the route at which a sample app is served through the
+// ingress gateway, used for the smoke test, and the location of the
+// VirtualService template exposing the app on the gateway
+type sampleAppRoute struct {
+	Path     string
+	Template string
 }
 
-func (istio *Istio) patchWithEnvoyFilter(namespace string, del bool, app string, templates []adapter.Template, patchObject string, kubeconfigs []string) (string, error) {
-	st := status.Deploying
+// installSampleApp installs/uninstalls a sample app in the given namespace
+//
+// The namespace is created and labeled for sidecar injection if needed. Once
+// the Deployments of the app are available with their sidecars, a request is
+// sent through the ingress gateway and the URL of the app is returned.
+func (istio *Istio) installSampleApp(namespace string, del bool, route sampleAppRoute, opts sampleAppOptions, templates []adapter.Template, kubeconfigs []string) (string, []string, error) {
+	st := status.Installing
 
 	if del {
 		st = status.Removing
 	}
 
-	jsonContents, err := utils.ReadFileSource(patchObject)
-	if err != nil {
-		return st, ErrEnvoyFilter(err)
+	opts.Gateway = opts.Gateway.withDefaultPort()
+	manifests := make([]string, 0, len(templates)+1)
+	for _, template := range templates {
+		manifests = append(manifests, template.String())
 	}
+
+	var cert, key []byte
+	if route.Template != "" {
+		if err := opts.Gateway.validate(); err != nil {
+			return st, nil, err
+		}
+		for _, template := range []string{gatewayTemplateFile, route.Template} {
+			manifest, err := renderTemplate(template, opts.Gateway)
+			if err != nil {
+				return st, nil, ErrSampleApp(err)
+			}
+			manifests = append(manifests, manifest)
+		}
+
+		if opts.Gateway.HTTPS && !del {
+			var err error
+			cert, key, err = selfSignedCertificate(opts.Gateway.Host)
+			if err != nil {
+				return st, nil, ErrGatewayTLS(opts.Gateway.Host, err)
+			}
+		}
+	}
+
 	var wg sync.WaitGroup
-	var errMx sync.Mutex
+	var mx sync.Mutex
 	var errs []error
+	var urls []string
 	for _, k8sconfig := range kubeconfigs {
 		wg.Add(1)
 		go func(k8sconfig string) {
 			defer wg.Done()
 			mclient, err := mesherykube.New([]byte(k8sconfig))
 			if err != nil {
-				errMx.Lock()
+				mx.Lock()
 				errs = append(errs, err)
-				errMx.Unlock()
+				mx.Unlock()
 				return
 			}
-			_, err = mclient.KubeClient.AppsV1().Deployments(namespace).Patch(context.TODO(), app, types.MergePatchType, []byte(jsonContents), metav1.PatchOptions{})
+			url, err := istio.installSampleAppOnSingleCluster(namespace, del, route, opts, manifests, cert, key, mclient)
+			mx.Lock()
+			defer mx.Unlock()
 			if err != nil {
-				errMx.Lock()
 				errs = append(errs, err)
-				errMx.Unlock()
 				return
 			}
-
-			for _, template := range templates {
-				contents, err := utils.ReadFileSource(string(template))
-				if err != nil {
-					errMx.Lock()
-					errs = append(errs, err)
-					errMx.Unlock()
-					continue
-				}
-
-				err = istio.applyManifestOnSingleCluster([]byte(contents), del, namespace, mclient)
-				if err != nil {
-					errMx.Lock()
-					errs = append(errs, err)
-					errMx.Unlock()
-					return
-				}
+			if url != "" {
+				urls = append(urls, url)
 			}
 		}(k8sconfig)
 	}
 	wg.Wait()
 	if len(errs) == 0 {
-		return status.Deployed, nil
+		if del {
+			return status.Removed, urls, nil
+		}
+		return status.Installed, urls, nil
 	}
-	return st, ErrEnvoyFilter(mergeErrors(errs))
+	return st, urls, ErrSampleApp(mergeErrors(errs))
 }
+
+func (istio *Istio) installSampleAppOnSingleCluster(namespace string, del bool, route sampleAppRoute, opts sampleAppOptions, manifests []string, cert, key []byte, mclient *mesherykube.Client) (string, error) {
+	if !del {
+		if err := prepareNamespace(mclient, namespace, opts.Revision); err != nil {
+			return "", err
+		}
+	}
+
+	gateway := opts.Gateway
+	if route.Template != "" && gateway.HTTPS {
+		if err := applyTLSSecret(mclient, gateway.Namespace, gateway.CredentialName(), del, cert, key); err != nil {
+			return "", ErrGatewayTLS(gateway.Host, err)
+		}
+	}
+
+	var resources []manifestResource
+	for _, manifest := range manifests {
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, namespace, mclient); err != nil {
+			return "", err
+		}
+		resources = append(resources, parseManifestResources(manifest)...)
+	}
+
+	if del {
+		return "", nil
+	}
+
+	if err := waitForDeployments(mclient, namespace, deploymentNames(resources)); err != nil {
+		return "", err
+	}
+	if err := waitForSidecars(mclient, namespace, deploymentNames(resources)); err != nil {
+		return "", err
+	}
+
+	// wildcard hosts cannot be sent in a request
+	if route.Template == "" || strings.Contains(gateway.Host, "*") {
+		return "", nil
+	}
+	address, err := gatewayAddress(mclient, gateway.Namespace, gateway.Selector, int32(gateway.Port))
+	if err != nil {
+		return "", ErrSmokeTest(gateway.Namespace, err)
+	}
+	scheme := "http"
+	var roots *x509.CertPool
+	if gateway.HTTPS {
+		scheme = "https"
+		roots = x509.NewCertPool()
+		roots.AppendCertsFromPEM(cert)
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, address, route.Path)
+	if err := smokeTest(url, gateway.Host, roots); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s (Host: %s)", url, gateway.Host), nil
+}
+
+// prepareNamespace creates the namespace if it does not exist and labels it
+// for sidecar injection by the given revision, or the default one
+func prepareNamespace(mclient *mesherykube.Client, namespace, revision string) error {
+	nsClient := mclient.KubeClient.CoreV1().Namespaces()
+	ns, err := nsClient.Get(context.TODO(), namespace, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		ns, err = nsClient.Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return ErrLoadNamespace(err, namespace)
+	}
+
+	if ns.ObjectMeta.Labels == nil {
+		ns.ObjectMeta.Labels = map[string]string{}
+	}
+	// istio-injection takes precedence over the revision label. Without a
+	// requested revision, a namespace already injected by a revision is
+	// left as is, its other workloads keep their control plane.
+	_, hasRevision := ns.ObjectMeta.Labels["istio.io/rev"]
+	switch {
+	case revision != "":
+		delete(ns.ObjectMeta.Labels, "istio-injection")
+		ns.ObjectMeta.Labels["istio.io/rev"] = revision
+	case hasRevision && ns.ObjectMeta.Labels["istio-injection"] == "":
+		return nil
+	default:
+		ns.ObjectMeta.Labels["istio-injection"] = "enabled"
+	}
+
+	if _, err := nsClient.Update(context.TODO(), ns, metav1.UpdateOptions{}); err != nil {
+		return ErrLoadNamespace(err, namespace)
+	}
+	return nil
+}
+
+// gatewayAddress returns the address at which the gateway workload matching
+// the selector serves the port from outside the cluster
+func gatewayAddress(mclient *mesherykube.Client, namespace string, selector map[string]string, port int32) (string, error) {
+	services, err := mclient.KubeClient.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	svc, servicePort := gatewayService(services.Items, selector, port)
+	if svc == nil {
+		return "", fmt.Errorf("no service in namespace %s exposes port %d of the gateway %s", namespace, port, labels.SelectorFromSet(selector))
+	}
+
+	if ingress := svc.Status.LoadBalancer.Ingress; len(ingress) > 0 {
+		address := ingress[0].IP
+		if address == "" {
+			address = ingress[0].Hostname
+		}
+		if port == 80 || port == 443 {
+			return address, nil
+		}
+		return fmt.Sprintf("%s:%d", address, port), nil
+	}
+	if servicePort.NodePort == 0 {
+		return "", fmt.Errorf("service %s/%s has neither a load balancer address nor a node port", namespace, svc.Name)
+	}
+	nodes, err := mclient.KubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", nodeAddress(nodes.Items), servicePort.NodePort), nil
+}
+
+// gatewayService returns the service, and its port, which exposes the port
+// of the gateway workload matching the selector. The service selects the
+// gateway pods when its selector holds every label of the gateway selector.
+func gatewayService(services []corev1.Service, selector map[string]string, port int32) (*corev1.Service, *corev1.ServicePort) {
+	for i, svc := range services {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		matches := true
+		for k, v := range selector {
+			if svc.Spec.Selector[k] != v {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		for j, p := range svc.Spec.Ports {
+			if p.Port == port {
+				return &services[i], &services[i].Spec.Ports[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// smokeTest sends requests for the host to the URL until one succeeds or
+// the smoke test timeout expires. Routes take a few seconds to propagate
+// to the gateway, hence the retries. HTTPS servers are verified against the
+// given roots, for the host.
+func smokeTest(url, host string, roots *x509.CertPool) error {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: host, RootCAs: roots, MinVersion: tls.VersionTLS12},
+		},
+	}
+	deadline := time.Now().Add(smokeTestTimeout * time.Second)
+	for {
+		err := func() error {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			req.Host = host
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode >= http.StatusBadRequest {
+				return fmt.Errorf("unexpected status: %s", resp.Status)
+			}
+			return nil
+		}()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrSmokeTest(url, err)
+		}
+		time.Sleep(readinessPollInterval * time.Second)
+	}
+}
+
 func (istio *Istio) applyPolicy(namespace string, del bool, templates []adapter.Template, kubeconfigs []string) (string, error) {
 	st := status.Deploying
 
@@ -0,0 +1,139 @@
+package istio
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSmokeTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "bookinfo.meshery.io" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := smokeTest(server.URL+"/productpage", "bookinfo.meshery.io", nil); err != nil {
+		t.Errorf("smokeTest() error = %v", err)
+	}
+}
+
+func TestSmokeTest_https(t *testing.T) {
+	cert, key, err := selfSignedCertificate("httpbin.meshery.io")
+	if err != nil {
+		t.Fatalf("selfSignedCertificate() error = %v", err)
+	}
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		t.Fatalf("tls.X509KeyPair() error = %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(cert)
+	if err := smokeTest(server.URL+"/status/200", "httpbin.meshery.io", roots); err != nil {
+		t.Errorf("smokeTest() error = %v", err)
+	}
+}
+
+func TestSampleAppGateway(t *testing.T) {
+	apps := []string{"bookinfo", "emojivoto", "fortio", "helloworld", "httpbin", "imagehub", "onlineboutique"}
+	for _, https := range []bool{false, true} {
+		for _, app := range apps {
+			opts := defaultSampleAppOptions(app, app+".meshery.io")
+			opts.Gateway.HTTPS = https
+			gateway := opts.Gateway.withDefaultPort()
+			if err := gateway.validate(); err != nil {
+				t.Fatalf("sampleAppGateway.validate() error = %v", err)
+			}
+			var docs []string
+			for _, template := range []string{"file://../templates/gateway/gateway.yaml", "file://../templates/" + app + "/virtualservice.yaml"} {
+				manifest, err := renderTemplate(template, gateway)
+				if err != nil {
+					t.Fatalf("renderTemplate(%s) error = %v", template, err)
+				}
+				docs = append(docs, strings.Split(manifest, "\n---\n")...)
+			}
+
+			for _, doc := range docs {
+				obj := map[string]interface{}{}
+				if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+					t.Fatalf("%s gateway is not valid YAML: %v", app, err)
+				}
+				spec := obj["spec"].(map[string]interface{})
+				switch obj["kind"] {
+				case "Gateway":
+					if obj["metadata"].(map[string]interface{})["name"] != app+"-gateway" {
+						t.Errorf("%s gateway is named %v", app, obj["metadata"])
+					}
+					server := spec["servers"].([]interface{})[0].(map[string]interface{})
+					port := server["port"].(map[string]interface{})
+					_, hasTLS := server["tls"]
+					if hasTLS != https || port["number"] != float64(gateway.Port) {
+						t.Errorf("%s gateway server = %v, want https %v", app, server, https)
+					}
+					if spec["selector"].(map[string]interface{})["istio"] != "ingressgateway" {
+						t.Errorf("%s gateway selector = %v", app, spec["selector"])
+					}
+				case "VirtualService":
+					if spec["gateways"].([]interface{})[0] != app+"-gateway" || spec["hosts"].([]interface{})[0] != app+".meshery.io" {
+						t.Errorf("%s VirtualService is not bound to its gateway: %v", app, spec)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGatewayService(t *testing.T) {
+	services := []corev1.Service{
+		{Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "istiod"}, Ports: []corev1.ServicePort{{Port: 443}}}},
+		{Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "istio-ingressgateway", "istio": "ingressgateway"}, Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080}, {Port: 443, NodePort: 30443}}}},
+	}
+	_, port := gatewayService(services, map[string]string{"istio": "ingressgateway"}, 443)
+	if port == nil || port.NodePort != 30443 {
+		t.Errorf("gatewayService() port = %v, want node port 30443", port)
+	}
+	if svc, _ := gatewayService(services, map[string]string{"istio": "eastwestgateway"}, 443); svc != nil {
+		t.Errorf("gatewayService() = %v, want none", svc)
+	}
+}
+
+func TestBundledSampleApps(t *testing.T) {
+	tests := []struct {
+		file            string
+		wantDeployments []string
+	}{
+		{file: "../templates/onlineboutique/onlineboutique.yaml", wantDeployments: []string{"emailservice", "checkoutservice", "recommendationservice", "frontend", "paymentservice", "productcatalogservice", "cartservice", "currencyservice", "shippingservice", "adservice", "redis-cart", "loadgenerator"}},
+		{file: "../templates/helloworld/helloworld.yaml", wantDeployments: []string{"helloworld-v1", "helloworld-v2"}},
+		{file: "../templates/sleep/sleep.yaml", wantDeployments: []string{"sleep"}},
+		{file: "../templates/fortio/fortio.yaml", wantDeployments: []string{"fortio-deploy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			byt, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatalf("failed to read manifest: %v", err)
+			}
+			got := deploymentNames(parseManifestResources(string(byt)))
+			if strings.Join(got, ",") != strings.Join(tt.wantDeployments, ",") {
+				t.Errorf("deployments = %v, want %v", got, tt.wantDeployments)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	"github.com/aspenmesh/istio-vet/pkg/vetter"
+	"github.com/aspenmesh/istio-vet/pkg/vetter/util"
+	networkingapi "istio.io/api/networking/v1beta1"
+	networkingclient "istio.io/client-go/pkg/apis/networking/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1beta1"
+	networkinglisters "istio.io/client-go/pkg/listers/networking/v1beta1"
+	securitylisters "istio.io/client-go/pkg/listers/security/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	nativeVetterVersion = "0.1.0"
+
+	mtlsConflictVetterID = "MTLSConflict"
+
+	istioMutualWithoutSidecarNoteType = "istio-mutual-without-sidecar"
+	istioMutualWithoutSidecarSummary  = "ISTIO_MUTUAL toward workloads without sidecar - ${dr_name}"
+	istioMutualWithoutSidecarMsg      = "The DestinationRule ${dr_name} in namespace ${namespace} sets the TLS mode ISTIO_MUTUAL${port} toward ${host}," +
+		" but the pod(s) ${pods} have no sidecar to terminate mutual TLS and will reset the connections." +
+		" Inject the sidecar in the pods, or set the TLS mode of the DestinationRule to DISABLE."
+
+	disableTowardStrictNoteType = "disable-toward-strict"
+	disableTowardStrictSummary  = "Plaintext toward STRICT mTLS workloads - ${dr_name}"
+	disableTowardStrictMsg      = "The DestinationRule ${dr_name} in namespace ${namespace} sets the TLS mode DISABLE${port} toward ${host}," +
+		" but the PeerAuthentication of the pod(s) ${pods} requires STRICT mutual TLS, so their sidecars reject the plaintext requests." +
+		" Set the TLS mode of the DestinationRule to ISTIO_MUTUAL, or relax the PeerAuthentication to PERMISSIVE."
+
+	istioMutualTowardDisabledNoteType = "istio-mutual-toward-disabled"
+	istioMutualTowardDisabledSummary  = "ISTIO_MUTUAL toward workloads with mTLS disabled - ${dr_name}"
+	istioMutualTowardDisabledMsg      = "The DestinationRule ${dr_name} in namespace ${namespace} sets the TLS mode ISTIO_MUTUAL${port} toward ${host}," +
+		" but the PeerAuthentication of the pod(s) ${pods} disables mutual TLS, so their sidecars cannot accept the connections." +
+		" Set the mode of the PeerAuthentication to PERMISSIVE or STRICT, or the TLS mode of the DestinationRule to DISABLE."
+
+	authorizationSelectorVetterID = "AuthorizationPolicySelector"
+
+	unmatchedAuthorizationPolicyNoteType = "authorization-policy-without-workload"
+	unmatchedAuthorizationPolicySummary  = "AuthorizationPolicy selects no workload - ${policy_name}"
+	unmatchedAuthorizationPolicyMsg      = "The selector ${selector} of the AuthorizationPolicy ${policy_name} in namespace ${namespace}" +
+		" matches no pod, so the policy enforces nothing. Fix the labels of the selector, or remove the selector to apply the policy to the whole namespace."
+
+	unenforcedAuthorizationPolicyNoteType = "authorization-policy-without-sidecar"
+	unenforcedAuthorizationPolicySummary  = "AuthorizationPolicy selects workloads without sidecar - ${policy_name}"
+	unenforcedAuthorizationPolicyMsg      = "The selector ${selector} of the AuthorizationPolicy ${policy_name} in namespace ${namespace}" +
+		" only matches the pod(s) ${pods}, which have no sidecar to enforce the policy. Inject the sidecar in the pods."
+)
+
+// meshRootNamespace returns the root namespace of the mesh config, in which
+// the policies without selector apply to the whole mesh
+func meshRootNamespace(cmLister corelisters.ConfigMapLister) string {
+	cm, err := cmLister.ConfigMaps(meshConfigNamespace).Get(meshConfigMapName)
+	if err != nil {
+		return meshConfigNamespace
+	}
+	mesh := meshConfig{}
+	if err := yaml.Unmarshal([]byte(cm.Data[meshConfigKey]), &mesh); err != nil {
+		return meshConfigNamespace
+	}
+	return mesh.rootNamespace()
+}
+
+// selectPods returns the live pods of the namespace, or of every namespace
+// when empty, matching the labels
+func selectPods(pods []*corev1.Pod, namespace string, matchLabels map[string]string) []*corev1.Pod {
+	selector := labels.SelectorFromSet(matchLabels)
+	var selected []*corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if (namespace == "" || pod.Namespace == namespace) && selector.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected
+}
+
+func podNames(pods []*corev1.Pod) string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// computeNoteIDs sets the ID of the notes the way the istio-vet vetters do
+func computeNoteIDs(notes []*apiv1.Note) []*apiv1.Note {
+	for i := range notes {
+		notes[i].Id = util.ComputeID(notes[i])
+	}
+	return notes
+}
+
+// peerAuthentications resolves the mTLS mode the sidecars of the pods
+// accept, following the precedence of the workload, namespace and mesh
+// PeerAuthentications
+type peerAuthentications struct {
+	rootNamespace string
+	policies      []*securityclient.PeerAuthentication
+}
+
+// mode returns the mode applied on the target port of the pod
+func (p peerAuthentications) mode(pod *corev1.Pod, port uint32) string {
+	var workload, namespace, mesh *securityclient.PeerAuthentication
+	for _, pa := range p.policies {
+		matchLabels := pa.Spec.GetSelector().GetMatchLabels()
+		switch {
+		case pa.Namespace == pod.Namespace && len(matchLabels) > 0:
+			if labels.SelectorFromSet(matchLabels).Matches(labels.Set(pod.Labels)) && olderPolicy(pa, workload) {
+				workload = pa
+			}
+		case pa.Namespace == pod.Namespace && olderPolicy(pa, namespace):
+			namespace = pa
+		case pa.Namespace == p.rootNamespace && len(matchLabels) == 0 && olderPolicy(pa, mesh):
+			mesh = pa
+		}
+	}
+	for _, pa := range []*securityclient.PeerAuthentication{workload, namespace, mesh} {
+		if pa == nil {
+			continue
+		}
+		if portMTLS, ok := pa.Spec.GetPortLevelMtls()[port]; ok && pa == workload && portMTLS.GetMode().String() != mtlsModeUnset {
+			return portMTLS.GetMode().String()
+		}
+		if mode := pa.Spec.GetMtls().GetMode().String(); mode != mtlsModeUnset {
+			return mode
+		}
+	}
+	return mtlsModePermissive
+}
+
+// olderPolicy tells whether the PeerAuthentication takes precedence over the
+// current one, Istio honouring the oldest of the policies of a scope
+func olderPolicy(pa, current *securityclient.PeerAuthentication) bool {
+	if current == nil {
+		return true
+	}
+	if pa.CreationTimestamp.Equal(&current.CreationTimestamp) {
+		return pa.Name < current.Name
+	}
+	return pa.CreationTimestamp.Before(&current.CreationTimestamp)
+}
+
+// destinationTLSMode is a TLS mode set by a DestinationRule, on every port
+// when port is 0
+type destinationTLSMode struct {
+	port uint32
+	mode networkingapi.ClientTLSSettings_TLSmode
+}
+
+func destinationTLSModes(dr *networkingclient.DestinationRule) []destinationTLSMode {
+	var modes []destinationTLSMode
+	policy := dr.Spec.GetTrafficPolicy()
+	if tls := policy.GetTls(); tls != nil {
+		modes = append(modes, destinationTLSMode{mode: tls.GetMode()})
+	}
+	for _, settings := range policy.GetPortLevelSettings() {
+		if tls := settings.GetTls(); tls != nil {
+			modes = append(modes, destinationTLSMode{port: settings.GetPort().GetNumber(), mode: tls.GetMode()})
+		}
+	}
+	return modes
+}
+
+// targetPort returns the port of the pods the port of the service forwards
+// to, which is the one PeerAuthentications refer to
+func targetPort(svc *corev1.Service, port uint32) uint32 {
+	for _, p := range svc.Spec.Ports {
+		if uint32(p.Port) == port && p.TargetPort.IntVal != 0 {
+			return uint32(p.TargetPort.IntVal)
+		}
+	}
+	return port
+}
+
+// mtlsConflictNotes returns the notes of the DestinationRules whose TLS mode
+// toward a service of the cluster cannot be accepted by its pods
+func mtlsConflictNotes(peerAuths peerAuthentications, drs []*networkingclient.DestinationRule, svcs []*corev1.Service, pods []*corev1.Pod) []*apiv1.Note {
+	services := map[string]*corev1.Service{}
+	for _, svc := range svcs {
+		services[qualifiedHost(svc.Name, svc.Namespace)] = svc
+	}
+
+	notes := []*apiv1.Note{}
+	for _, dr := range drs {
+		svc, ok := services[qualifiedHost(dr.Spec.GetHost(), dr.Namespace)]
+		if !ok || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		backends := selectPods(pods, svc.Namespace, svc.Spec.Selector)
+		for _, tls := range destinationTLSModes(dr) {
+			var withoutSidecar, strict, disabled []*corev1.Pod
+			for _, pod := range backends {
+				if !hasSidecar(*pod) {
+					withoutSidecar = append(withoutSidecar, pod)
+					continue
+				}
+				switch peerAuths.mode(pod, targetPort(svc, tls.port)) {
+				case mtlsModeStrict:
+					strict = append(strict, pod)
+				case mtlsModeDisable:
+					disabled = append(disabled, pod)
+				}
+			}
+
+			attr := map[string]string{
+				"dr_name":   dr.Name,
+				"namespace": dr.Namespace,
+				"host":      dr.Spec.GetHost(),
+				"port":      "",
+			}
+			if tls.port != 0 {
+				attr["port"] = fmt.Sprintf(" on port %d", tls.port)
+			}
+			note := func(noteType, summary, msg string, affected []*corev1.Pod) {
+				noteAttr := map[string]string{"pods": podNames(affected)}
+				for k, v := range attr {
+					noteAttr[k] = v
+				}
+				notes = append(notes, &apiv1.Note{
+					Type:    noteType,
+					Summary: summary,
+					Msg:     msg,
+					Level:   apiv1.NoteLevel_ERROR,
+					Attr:    noteAttr,
+				})
+			}
+			switch tls.mode {
+			case networkingapi.ClientTLSSettings_ISTIO_MUTUAL:
+				if len(withoutSidecar) > 0 {
+					note(istioMutualWithoutSidecarNoteType, istioMutualWithoutSidecarSummary, istioMutualWithoutSidecarMsg, withoutSidecar)
+				}
+				if len(disabled) > 0 {
+					note(istioMutualTowardDisabledNoteType, istioMutualTowardDisabledSummary, istioMutualTowardDisabledMsg, disabled)
+				}
+			case networkingapi.ClientTLSSettings_DISABLE:
+				if len(strict) > 0 {
+					note(disableTowardStrictNoteType, disableTowardStrictSummary, disableTowardStrictMsg, strict)
+				}
+			}
+		}
+	}
+	return computeNoteIDs(notes)
+}
+
+// mtlsConflictVetter reports the DestinationRules whose TLS mode conflicts
+// with the PeerAuthentications, or the lack of sidecar, of the pods of the
+// destination
+type mtlsConflictVetter struct {
+	cmLister  corelisters.ConfigMapLister
+	svcLister corelisters.ServiceLister
+	podLister corelisters.PodLister
+	paLister  securitylisters.PeerAuthenticationLister
+	drLister  networkinglisters.DestinationRuleLister
+}
+
+func newMTLSConflictVetter(factory vetter.ResourceListGetter) *mtlsConflictVetter {
+	return &mtlsConflictVetter{
+		cmLister:  factory.K8s().Core().V1().ConfigMaps().Lister(),
+		svcLister: factory.K8s().Core().V1().Services().Lister(),
+		podLister: factory.K8s().Core().V1().Pods().Lister(),
+		paLister:  factory.Istio().Security().V1beta1().PeerAuthentications().Lister(),
+		drLister:  factory.Istio().Networking().V1beta1().DestinationRules().Lister(),
+	}
+}
+
+// Vet returns the notes of the mTLS conflicts
+func (v *mtlsConflictVetter) Vet() ([]*apiv1.Note, error) {
+	svcs, err := v.svcLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := v.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pas, err := v.paLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	drs, err := v.drLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	peerAuths := peerAuthentications{rootNamespace: meshRootNamespace(v.cmLister), policies: pas}
+	return mtlsConflictNotes(peerAuths, drs, svcs, pods), nil
+}
+
+// Info returns the information of the vetter
+func (v *mtlsConflictVetter) Info() *apiv1.Info {
+	return &apiv1.Info{Id: mtlsConflictVetterID, Version: nativeVetterVersion}
+}
+
+// authorizationSelectorNotes returns the notes of the AuthorizationPolicies
+// whose selector matches no pod, or only pods without sidecar
+func authorizationSelectorNotes(rootNamespace string, policies []*securityclient.AuthorizationPolicy, pods []*corev1.Pod) []*apiv1.Note {
+	notes := []*apiv1.Note{}
+	for _, policy := range policies {
+		matchLabels := policy.Spec.GetSelector().GetMatchLabels()
+		if len(matchLabels) == 0 {
+			continue
+		}
+		namespace := policy.Namespace
+		if namespace == rootNamespace {
+			// the policies of the root namespace select the workloads of
+			// every namespace
+			namespace = ""
+		}
+		selected := selectPods(pods, namespace, matchLabels)
+		attr := map[string]string{
+			"policy_name": policy.Name,
+			"namespace":   policy.Namespace,
+			"selector":    formatSelector(matchLabels),
+		}
+		if len(selected) == 0 {
+			notes = append(notes, &apiv1.Note{
+				Type:    unmatchedAuthorizationPolicyNoteType,
+				Summary: unmatchedAuthorizationPolicySummary,
+				Msg:     unmatchedAuthorizationPolicyMsg,
+				Level:   apiv1.NoteLevel_WARNING,
+				Attr:    attr,
+			})
+			continue
+		}
+		enforced := false
+		for _, pod := range selected {
+			enforced = enforced || hasSidecar(*pod)
+		}
+		if !enforced {
+			attr["pods"] = podNames(selected)
+			notes = append(notes, &apiv1.Note{
+				Type:    unenforcedAuthorizationPolicyNoteType,
+				Summary: unenforcedAuthorizationPolicySummary,
+				Msg:     unenforcedAuthorizationPolicyMsg,
+				Level:   apiv1.NoteLevel_WARNING,
+				Attr:    attr,
+			})
+		}
+	}
+	return computeNoteIDs(notes)
+}
+
+// authorizationSelectorVetter reports the AuthorizationPolicies which select
+// no workload enforcing them
+type authorizationSelectorVetter struct {
+	cmLister  corelisters.ConfigMapLister
+	podLister corelisters.PodLister
+	apLister  securitylisters.AuthorizationPolicyLister
+}
+
+func newAuthorizationSelectorVetter(factory vetter.ResourceListGetter) *authorizationSelectorVetter {
+	return &authorizationSelectorVetter{
+		cmLister:  factory.K8s().Core().V1().ConfigMaps().Lister(),
+		podLister: factory.K8s().Core().V1().Pods().Lister(),
+		apLister:  factory.Istio().Security().V1beta1().AuthorizationPolicies().Lister(),
+	}
+}
+
+// Vet returns the notes of the AuthorizationPolicies without workload
+func (v *authorizationSelectorVetter) Vet() ([]*apiv1.Note, error) {
+	pods, err := v.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	policies, err := v.apLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return authorizationSelectorNotes(meshRootNamespace(v.cmLister), policies, pods), nil
+}
+
+// Info returns the information of the vetter
+func (v *authorizationSelectorVetter) Info() *apiv1.Info {
+	return &apiv1.Info{Id: authorizationSelectorVetterID, Version: nativeVetterVersion}
+}
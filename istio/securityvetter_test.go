@@ -0,0 +1,226 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	networkingapi "istio.io/api/networking/v1beta1"
+	securityapi "istio.io/api/security/v1beta1"
+	typeapi "istio.io/api/type/v1beta1"
+	networkingclient "istio.io/client-go/pkg/apis/networking/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testPod(namespace, name string, sidecar bool, labels map[string]string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if sidecar {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: sidecarContainerName})
+	}
+	return pod
+}
+
+func testPeerAuthentication(namespace, name string, selector map[string]string, mode securityapi.PeerAuthentication_MutualTLS_Mode, ports map[uint32]securityapi.PeerAuthentication_MutualTLS_Mode) *securityclient.PeerAuthentication {
+	pa := &securityclient.PeerAuthentication{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, CreationTimestamp: metav1.NewTime(time.Unix(1700000000, 0))},
+		Spec: securityapi.PeerAuthentication{
+			Mtls: &securityapi.PeerAuthentication_MutualTLS{Mode: mode},
+		},
+	}
+	if len(selector) > 0 {
+		pa.Spec.Selector = &typeapi.WorkloadSelector{MatchLabels: selector}
+	}
+	if len(ports) > 0 {
+		pa.Spec.PortLevelMtls = map[uint32]*securityapi.PeerAuthentication_MutualTLS{}
+		for port, portMode := range ports {
+			pa.Spec.PortLevelMtls[port] = &securityapi.PeerAuthentication_MutualTLS{Mode: portMode}
+		}
+	}
+	return pa
+}
+
+func TestPeerAuthentications_mode(t *testing.T) {
+	reviews := testPod("bookinfo", "reviews-v1", true, map[string]string{"app": "reviews"})
+	tests := []struct {
+		name     string
+		policies []*securityclient.PeerAuthentication
+		port     uint32
+		want     string
+	}{
+		{
+			name: "PERMISSIVE without policy",
+			want: mtlsModePermissive,
+		},
+		{
+			name: "mesh policy",
+			policies: []*securityclient.PeerAuthentication{
+				testPeerAuthentication("istio-system", "default", nil, securityapi.PeerAuthentication_MutualTLS_STRICT, nil),
+			},
+			want: mtlsModeStrict,
+		},
+		{
+			name: "namespace policy overrides the mesh",
+			policies: []*securityclient.PeerAuthentication{
+				testPeerAuthentication("istio-system", "default", nil, securityapi.PeerAuthentication_MutualTLS_STRICT, nil),
+				testPeerAuthentication("bookinfo", "default", nil, securityapi.PeerAuthentication_MutualTLS_DISABLE, nil),
+			},
+			want: mtlsModeDisable,
+		},
+		{
+			name: "UNSET workload policy inherits the namespace",
+			policies: []*securityclient.PeerAuthentication{
+				testPeerAuthentication("bookinfo", "default", nil, securityapi.PeerAuthentication_MutualTLS_STRICT, nil),
+				testPeerAuthentication("bookinfo", "reviews", map[string]string{"app": "reviews"}, securityapi.PeerAuthentication_MutualTLS_UNSET, nil),
+			},
+			want: mtlsModeStrict,
+		},
+		{
+			name: "port override of the workload policy",
+			policies: []*securityclient.PeerAuthentication{
+				testPeerAuthentication("bookinfo", "reviews", map[string]string{"app": "reviews"}, securityapi.PeerAuthentication_MutualTLS_STRICT,
+					map[uint32]securityapi.PeerAuthentication_MutualTLS_Mode{9080: securityapi.PeerAuthentication_MutualTLS_PERMISSIVE}),
+			},
+			port: 9080,
+			want: mtlsModePermissive,
+		},
+		{
+			name: "workload policy of other pods",
+			policies: []*securityclient.PeerAuthentication{
+				testPeerAuthentication("bookinfo", "ratings", map[string]string{"app": "ratings"}, securityapi.PeerAuthentication_MutualTLS_STRICT, nil),
+			},
+			want: mtlsModePermissive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := peerAuthentications{rootNamespace: "istio-system", policies: tt.policies}
+			if got := p.mode(reviews, tt.port); got != tt.want {
+				t.Errorf("peerAuthentications.mode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMTLSConflictNotes(t *testing.T) {
+	svcs := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "reviews", Namespace: "bookinfo"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "reviews"},
+				Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(9080)}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "bookinfo"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "legacy"}},
+		},
+	}
+	pods := []*corev1.Pod{
+		testPod("bookinfo", "reviews-v1", true, map[string]string{"app": "reviews"}),
+		testPod("bookinfo", "legacy-0", false, map[string]string{"app": "legacy"}),
+	}
+	strict := peerAuthentications{rootNamespace: "istio-system", policies: []*securityclient.PeerAuthentication{
+		testPeerAuthentication("bookinfo", "reviews", map[string]string{"app": "reviews"}, securityapi.PeerAuthentication_MutualTLS_STRICT,
+			map[uint32]securityapi.PeerAuthentication_MutualTLS_Mode{9080: securityapi.PeerAuthentication_MutualTLS_PERMISSIVE}),
+	}}
+	dr := func(host string, policy *networkingapi.TrafficPolicy) *networkingclient.DestinationRule {
+		return &networkingclient.DestinationRule{
+			ObjectMeta: metav1.ObjectMeta{Name: host, Namespace: "bookinfo"},
+			Spec:       networkingapi.DestinationRule{Host: host, TrafficPolicy: policy},
+		}
+	}
+	tlsMode := func(mode networkingapi.ClientTLSSettings_TLSmode) *networkingapi.TrafficPolicy {
+		return &networkingapi.TrafficPolicy{Tls: &networkingapi.ClientTLSSettings{Mode: mode}}
+	}
+	tests := []struct {
+		name string
+		drs  []*networkingclient.DestinationRule
+		want []string
+	}{
+		{
+			name: "DISABLE toward STRICT",
+			drs:  []*networkingclient.DestinationRule{dr("reviews", tlsMode(networkingapi.ClientTLSSettings_DISABLE))},
+			want: []string{disableTowardStrictNoteType},
+		},
+		{
+			name: "DISABLE on the port left PERMISSIVE",
+			drs: []*networkingclient.DestinationRule{dr("reviews", &networkingapi.TrafficPolicy{PortLevelSettings: []*networkingapi.TrafficPolicy_PortTrafficPolicy{{
+				Port: &networkingapi.PortSelector{Number: 80},
+				Tls:  &networkingapi.ClientTLSSettings{Mode: networkingapi.ClientTLSSettings_DISABLE},
+			}}})},
+		},
+		{
+			name: "ISTIO_MUTUAL toward pods without sidecar",
+			drs:  []*networkingclient.DestinationRule{dr("legacy.bookinfo.svc.cluster.local", tlsMode(networkingapi.ClientTLSSettings_ISTIO_MUTUAL))},
+			want: []string{istioMutualWithoutSidecarNoteType},
+		},
+		{
+			name: "ISTIO_MUTUAL toward STRICT",
+			drs:  []*networkingclient.DestinationRule{dr("reviews", tlsMode(networkingapi.ClientTLSSettings_ISTIO_MUTUAL))},
+		},
+		{
+			name: "host outside the cluster",
+			drs:  []*networkingclient.DestinationRule{dr("api.example.com", tlsMode(networkingapi.ClientTLSSettings_DISABLE))},
+		},
+		{
+			name: "no TLS settings",
+			drs:  []*networkingclient.DestinationRule{dr("reviews", nil)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, note := range mtlsConflictNotes(strict, tt.drs, svcs, pods) {
+				got = append(got, note.Type)
+				if note.Id == "" {
+					t.Errorf("mtlsConflictNotes() note %s has no ID", note.Type)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mtlsConflictNotes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizationSelectorNotes(t *testing.T) {
+	pods := []*corev1.Pod{
+		testPod("bookinfo", "reviews-v1", true, map[string]string{"app": "reviews"}),
+		testPod("bookinfo", "legacy-0", false, map[string]string{"app": "legacy"}),
+		testPod("shop", "cart-0", true, map[string]string{"app": "cart"}),
+	}
+	policy := func(namespace, name string, selector map[string]string) *securityclient.AuthorizationPolicy {
+		ap := &securityclient.AuthorizationPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if selector != nil {
+			ap.Spec.Selector = &typeapi.WorkloadSelector{MatchLabels: selector}
+		}
+		return ap
+	}
+	policies := []*securityclient.AuthorizationPolicy{
+		policy("bookinfo", "reviews", map[string]string{"app": "reviews"}),
+		policy("bookinfo", "namespace-wide", nil),
+		policy("bookinfo", "typo", map[string]string{"app": "reveiws"}),
+		policy("bookinfo", "legacy", map[string]string{"app": "legacy"}),
+		policy("bookinfo", "cart", map[string]string{"app": "cart"}),
+		policy("istio-system", "mesh-cart", map[string]string{"app": "cart"}),
+	}
+	want := map[string]string{
+		"typo":   unmatchedAuthorizationPolicyNoteType,
+		"legacy": unenforcedAuthorizationPolicyNoteType,
+		"cart":   unmatchedAuthorizationPolicyNoteType,
+	}
+	got := map[string]string{}
+	for _, note := range authorizationSelectorNotes("istio-system", policies, pods) {
+		got[note.Attr["policy_name"]] = note.Type
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("authorizationSelectorNotes() = %v, want %v", got, want)
+	}
+}
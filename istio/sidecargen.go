@@ -0,0 +1,514 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Granularities of the generated Sidecars
+const (
+	SidecarGranularityNamespace = "namespace"
+	SidecarGranularityWorkload  = "workload"
+
+	// generatedSidecarLabel marks the Sidecars written by the generation,
+	// which are the ones removed by the delete operation
+	generatedSidecarLabel = "meshery.io/generated-sidecar"
+)
+
+// unroutedDestinations are the destination services reported by the
+// proxies for the traffic which matched no service of the registry
+var unroutedDestinations = map[string]bool{
+	"":                   true,
+	"unknown":            true,
+	"PassthroughCluster": true,
+	"BlackHoleCluster":   true,
+}
+
+// sidecarGeneration are the parameters of the Sidecar generation operation
+type sidecarGeneration struct {
+	// Namespaces whose Sidecars are generated, the namespace of the
+	// operation when empty
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// Granularity is namespace, for one Sidecar per namespace, or workload,
+	// for one Sidecar per workload seen sending traffic
+	Granularity string `yaml:"granularity"`
+	// DryRun only shows the Sidecars and their estimated effect
+	DryRun bool `yaml:"dryRun"`
+	// Window over which the traffic is inspected
+	Window              string `yaml:"window"`
+	PrometheusNamespace string `yaml:"prometheusNamespace"`
+	PrometheusService   string `yaml:"prometheusService"`
+	// ExtraHosts are added to the egress hosts of every Sidecar, in the
+	// namespace/host format of the Sidecar resource
+	ExtraHosts []string `yaml:"extraHosts,omitempty"`
+}
+
+func defaultSidecarGeneration() sidecarGeneration {
+	return sidecarGeneration{
+		Granularity:         SidecarGranularityNamespace,
+		DryRun:              true,
+		Window:              "24h",
+		PrometheusNamespace: "istio-system",
+		PrometheusService:   prometheusAddonService,
+		ExtraHosts:          []string{"istio-system/*"},
+	}
+}
+
+func (g sidecarGeneration) validate() error {
+	if len(g.Namespaces) == 0 {
+		return ErrSidecarGeneration(fmt.Errorf("at least one namespace is required"))
+	}
+	switch g.Granularity {
+	case SidecarGranularityNamespace, SidecarGranularityWorkload:
+	default:
+		return ErrSidecarGeneration(fmt.Errorf("invalid granularity %s, use %s or %s", g.Granularity, SidecarGranularityNamespace, SidecarGranularityWorkload))
+	}
+	if !prometheusDurationRegex.MatchString(g.Window) {
+		return ErrSidecarGeneration(fmt.Errorf("invalid window %s, use a duration such as 1h or 7d", g.Window))
+	}
+	for _, host := range g.ExtraHosts {
+		parts := strings.Split(host, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return ErrSidecarGeneration(fmt.Errorf("invalid extra host %s, use the namespace/host format", host))
+		}
+	}
+	return nil
+}
+
+// outboundTrafficQuery returns the PromQL query of the services each
+// workload of the namespaces sent requests or opened connections to
+func outboundTrafficQuery(namespaces []string, window string) string {
+	selector := fmt.Sprintf(`reporter="source", source_workload_namespace=~"%s"`, promQLNamespaces(namespaces))
+	return fmt.Sprintf(
+		`sum by (source_workload, source_workload_namespace, destination_service) (increase(istio_requests_total{%[1]s}[%[2]s])) > 0 or sum by (source_workload, source_workload_namespace, destination_service) (increase(istio_tcp_connections_opened_total{%[1]s}[%[2]s])) > 0`,
+		selector, window,
+	)
+}
+
+// observedDependencies returns the hosts each workload of the result of the
+// outbound traffic query reached, by namespace and workload
+func observedDependencies(samples []prometheusSample) map[string]map[string]sets.Set[string] {
+	deps := map[string]map[string]sets.Set[string]{}
+	for _, sample := range samples {
+		m := sample.Metric
+		if m["source_workload"] == "" || m["source_workload"] == "unknown" || unroutedDestinations[m["destination_service"]] {
+			continue
+		}
+		ns := m["source_workload_namespace"]
+		if deps[ns] == nil {
+			deps[ns] = map[string]sets.Set[string]{}
+		}
+		if deps[ns][m["source_workload"]] == nil {
+			deps[ns][m["source_workload"]] = sets.New[string]()
+		}
+		deps[ns][m["source_workload"]].Insert(m["destination_service"])
+	}
+	return deps
+}
+
+// meshInventory is the configuration of the mesh the egress hosts of the
+// Sidecars are computed from
+type meshInventory struct {
+	// services maps the fully qualified name of the services to their
+	// namespace
+	services         map[string]string
+	virtualServices  []unstructured.Unstructured
+	destinationRules []unstructured.Unstructured
+}
+
+func getMeshInventory(mclient *mesherykube.Client) (meshInventory, error) {
+	inv := meshInventory{services: map[string]string{}}
+	services, err := mclient.KubeClient.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return inv, err
+	}
+	for _, svc := range services.Items {
+		inv.services[qualifiedHost(svc.Name, svc.Namespace)] = svc.Namespace
+	}
+	vsList, err := mclient.DynamicKubeClient.Resource(virtualServiceGVR).Namespace("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return inv, err
+	}
+	inv.virtualServices = vsList.Items
+	drList, err := mclient.DynamicKubeClient.Resource(destinationRuleGVR).Namespace("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return inv, err
+	}
+	inv.destinationRules = drList.Items
+	return inv, nil
+}
+
+// virtualServiceDestinations returns the hosts the VirtualService routes or
+// mirrors the traffic to
+func virtualServiceDestinations(vs unstructured.Unstructured) []string {
+	var hosts []string
+	for _, protocol := range []string{"http", "tls", "tcp"} {
+		routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", protocol)
+		for _, route := range routes {
+			r, ok := route.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if host, ok, _ := unstructured.NestedString(r, "mirror", "host"); ok {
+				hosts = append(hosts, qualifiedHost(host, vs.GetNamespace()))
+			}
+			destinations, _, _ := unstructured.NestedSlice(r, "route")
+			for _, destination := range destinations {
+				d, ok := destination.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if host, ok, _ := unstructured.NestedString(d, "destination", "host"); ok {
+					hosts = append(hosts, qualifiedHost(host, vs.GetNamespace()))
+				}
+			}
+		}
+	}
+	return hosts
+}
+
+// configuredDependencies returns the hosts the VirtualServices of the
+// namespace route to and the DestinationRules of the namespace apply to
+func (inv meshInventory) configuredDependencies(namespace string) sets.Set[string] {
+	hosts := sets.New[string]()
+	for _, vs := range inv.virtualServices {
+		if vs.GetNamespace() == namespace {
+			hosts.Insert(virtualServiceDestinations(vs)...)
+		}
+	}
+	for _, dr := range inv.destinationRules {
+		if host, ok, _ := unstructured.NestedString(dr.Object, "spec", "host"); ok && dr.GetNamespace() == namespace {
+			hosts.Insert(qualifiedHost(host, namespace))
+		}
+	}
+	return hosts
+}
+
+// withRoutedDestinations adds to the hosts the destinations of the
+// VirtualServices defining them, which the proxies must also know of to
+// follow the routes
+func (inv meshInventory) withRoutedDestinations(hosts sets.Set[string]) sets.Set[string] {
+	out := hosts.Clone()
+	for _, vs := range inv.virtualServices {
+		vsHosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+		for _, host := range vsHosts {
+			if hosts.Has(qualifiedHost(host, vs.GetNamespace())) {
+				out.Insert(virtualServiceDestinations(vs)...)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// egressHosts returns the egress hosts of a Sidecar of the namespace in the
+// namespace/host format, the hosts outside the registry of Kubernetes being
+// looked up in every namespace. The services of the namespace stay visible.
+func (inv meshInventory) egressHosts(namespace string, hosts sets.Set[string], extra []string) []string {
+	egress := sets.New[string](extra...)
+	egress.Insert("./*")
+	for host := range hosts {
+		ns, ok := inv.services[host]
+		switch {
+		case !ok:
+			egress.Insert("*/" + host)
+		case ns == namespace:
+			// already visible through ./*
+		default:
+			egress.Insert(ns + "/" + host)
+		}
+	}
+	return sets.List(egress)
+}
+
+// visibleServices returns how many services of the mesh the egress hosts of
+// a Sidecar of the namespace expose to its proxies
+func (inv meshInventory) visibleServices(namespace string, egress []string) int {
+	visible := sets.New[string]()
+	for _, entry := range egress {
+		parts := strings.SplitN(entry, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ns, host := parts[0], parts[1]
+		if ns == "." {
+			ns = namespace
+		}
+		for svc, svcNs := range inv.services {
+			if (ns == "*" || ns == svcNs) && (host == "*" || host == svc) {
+				visible.Insert(svc)
+			}
+		}
+		if _, ok := inv.services[host]; !ok && host != "*" {
+			visible.Insert(host)
+		}
+	}
+	return visible.Len()
+}
+
+// sizeEstimate describes the share of the services of the mesh the proxies
+// no longer receive the configuration of
+func (inv meshInventory) sizeEstimate(namespace string, egress []string) string {
+	total := len(inv.services)
+	visible := inv.visibleServices(namespace, egress)
+	if total == 0 || visible >= total {
+		return fmt.Sprintf("%d service(s) visible, no reduction", visible)
+	}
+	return fmt.Sprintf("%d of %d service(s) visible, about %d%% less proxy configuration", visible, total, 100*(total-visible)/total)
+}
+
+// generatedSidecar returns the Sidecar restricting the configuration of the
+// proxies selected by the labels, or of every proxy of the namespace, to the
+// egress hosts
+func generatedSidecar(namespace, name string, selector map[string]string, egress []string, outboundTrafficPolicy map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{
+		"egress": []interface{}{
+			map[string]interface{}{"hosts": egress},
+		},
+	}
+	if len(selector) > 0 {
+		spec["workloadSelector"] = map[string]interface{}{"labels": selector}
+	}
+	if len(outboundTrafficPolicy) > 0 {
+		spec["outboundTrafficPolicy"] = outboundTrafficPolicy
+	}
+	return map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       "Sidecar",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{generatedSidecarLabel: "true"},
+		},
+		"spec": spec,
+	}
+}
+
+// replaceableSidecar checks if the Sidecar was created by the adapter, either
+// generated or as the egress lockdown, and can be replaced by a generated one
+func replaceableSidecar(sidecar *unstructured.Unstructured) bool {
+	labels := sidecar.GetLabels()
+	return labels[generatedSidecarLabel] == "true" || labels[egressLockdownLabel] == "true"
+}
+
+// generateSidecars computes the egress hosts of the workloads of the
+// namespaces and shows, or applies, the Sidecars limiting the configuration
+// of their proxies to them
+func (istio *Istio) generateSidecars(namespace string, del bool, generation sidecarGeneration, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if len(generation.Namespaces) == 0 && namespace != "" {
+		generation.Namespaces = []string{namespace}
+	}
+	if err := generation.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			var clusterMsgs []string
+			if del {
+				clusterMsgs, err = istio.removeGeneratedSidecarsOnSingleCluster(generation, mclient)
+			} else {
+				clusterMsgs, err = istio.generateSidecarsOnSingleCluster(generation, mclient)
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return st, msgs, ErrSidecarGeneration(mergeErrors(errs))
+	}
+	switch {
+	case del:
+		return status.Removed, msgs, nil
+	case generation.DryRun:
+		msgs = append(msgs, "dry run, nothing was applied: review the Sidecars and run the operation again with dryRun set to false")
+		return status.Completed, msgs, nil
+	}
+	return status.Deployed, msgs, nil
+}
+
+func (istio *Istio) generateSidecarsOnSingleCluster(generation sidecarGeneration, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	inv, err := getMeshInventory(mclient)
+	if err != nil {
+		return msgs, err
+	}
+	samples, found, err := queryPrometheus(mclient, generation.PrometheusNamespace, generation.PrometheusService, outboundTrafficQuery(generation.Namespaces, generation.Window))
+	if err != nil {
+		return msgs, err
+	}
+	if !found {
+		if generation.Granularity == SidecarGranularityWorkload {
+			return msgs, fmt.Errorf("the %s granularity requires the traffic recorded by Prometheus, which was not found in %s", SidecarGranularityWorkload, generation.PrometheusNamespace)
+		}
+		msgs = append(msgs, fmt.Sprintf("Prometheus was not found in %s, the Sidecars only account for the VirtualServices and DestinationRules", generation.PrometheusNamespace))
+	}
+	observed := observedDependencies(samples)
+
+	var sidecars []map[string]interface{}
+	for _, ns := range generation.Namespaces {
+		if generation.Granularity == SidecarGranularityNamespace {
+			hosts := inv.configuredDependencies(ns)
+			for _, workloadHosts := range observed[ns] {
+				hosts = hosts.Union(workloadHosts)
+			}
+			egress := inv.egressHosts(ns, inv.withRoutedDestinations(hosts), generation.ExtraHosts)
+
+			// a namespace has a single namespace-wide Sidecar. The one created
+			// by the adapter is updated in place, keeping the outbound traffic
+			// policy set by the egress lockdown, the one of the user is left
+			// untouched.
+			name, outboundTrafficPolicy := egressLockdownSidecar, map[string]interface{}(nil)
+			existing, err := namespaceSidecar(mclient, ns)
+			if err != nil {
+				return msgs, err
+			}
+			lockedDown := false
+			if existing != nil {
+				if !replaceableSidecar(existing) {
+					msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s already applies to the whole namespace and was not created by the adapter, it is left untouched and no Sidecar is generated for %s", ns, existing.GetName(), ns))
+					continue
+				}
+				name = existing.GetName()
+				lockedDown = existing.GetLabels()[egressLockdownLabel] == "true"
+				outboundTrafficPolicy, _, _ = unstructured.NestedMap(existing.Object, "spec", "outboundTrafficPolicy")
+			}
+			sidecar := generatedSidecar(ns, name, nil, egress, outboundTrafficPolicy)
+			if lockedDown {
+				if err := unstructured.SetNestedField(sidecar, "true", "metadata", "labels", egressLockdownLabel); err != nil {
+					return msgs, err
+				}
+			}
+			sidecars = append(sidecars, sidecar)
+			msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s for the whole namespace: %s", ns, name, inv.sizeEstimate(ns, egress)))
+			continue
+		}
+
+		workloads := make([]string, 0, len(observed[ns]))
+		for workload := range observed[ns] {
+			workloads = append(workloads, workload)
+		}
+		sort.Strings(workloads)
+		if len(workloads) == 0 {
+			msgs = append(msgs, fmt.Sprintf("no workload of %s sent traffic over the last %s, no Sidecar generated", ns, generation.Window))
+		}
+		for _, workload := range workloads {
+			deployment, err := mclient.KubeClient.AppsV1().Deployments(ns).Get(context.TODO(), workload, metav1.GetOptions{})
+			if kubeerror.IsNotFound(err) {
+				msgs = append(msgs, fmt.Sprintf("workload %s/%s is not a Deployment, no Sidecar generated", ns, workload))
+				continue
+			}
+			if err != nil {
+				return msgs, err
+			}
+			if deployment.Spec.Selector == nil || len(deployment.Spec.Selector.MatchLabels) == 0 {
+				msgs = append(msgs, fmt.Sprintf("Deployment %s/%s has no matchLabels, no Sidecar generated", ns, workload))
+				continue
+			}
+			sidecar, err := mclient.DynamicKubeClient.Resource(sidecarGVR).Namespace(ns).Get(context.TODO(), workload, metav1.GetOptions{})
+			if err != nil && !kubeerror.IsNotFound(err) {
+				return msgs, err
+			}
+			if err == nil && !replaceableSidecar(sidecar) {
+				msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s was not created by the adapter, it is left untouched and no Sidecar is generated for the workload", ns, workload))
+				continue
+			}
+			// the traffic seen over the window misses the calls the workload
+			// did not make then, so the services of its namespace and the
+			// configured dependencies stay visible as well
+			hosts := inv.configuredDependencies(ns).Union(observed[ns][workload])
+			egress := inv.egressHosts(ns, inv.withRoutedDestinations(hosts), generation.ExtraHosts)
+			sidecars = append(sidecars, generatedSidecar(ns, workload, deployment.Spec.Selector.MatchLabels, egress, nil))
+			msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s for the workloads matching %s: %s", ns, workload, formatSelector(deployment.Spec.Selector.MatchLabels), inv.sizeEstimate(ns, egress)))
+		}
+	}
+
+	for _, sidecar := range sidecars {
+		manifest, err := yaml.Marshal(sidecar)
+		if err != nil {
+			return msgs, err
+		}
+		metadata := sidecar["metadata"].(map[string]interface{})
+		if generation.DryRun {
+			msgs = append(msgs, string(manifest))
+			continue
+		}
+		if err := istio.applyManifestOnSingleCluster(manifest, false, metadata["namespace"].(string), mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s applied", metadata["namespace"], metadata["name"]))
+	}
+	return msgs, nil
+}
+
+// removeGeneratedSidecarsOnSingleCluster deletes the generated Sidecars of
+// the namespaces, restoring the egress lockdown of the ones which carried it
+func (istio *Istio) removeGeneratedSidecarsOnSingleCluster(generation sidecarGeneration, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	for _, ns := range generation.Namespaces {
+		client := mclient.DynamicKubeClient.Resource(sidecarGVR).Namespace(ns)
+		list, err := client.List(context.TODO(), metav1.ListOptions{LabelSelector: generatedSidecarLabel + "=true"})
+		if err != nil {
+			return msgs, err
+		}
+		for _, sidecar := range list.Items {
+			if sidecar.GetLabels()[egressLockdownLabel] == "true" {
+				manifest, err := yaml.Marshal(egressLockdown{}.sidecar(ns))
+				if err != nil {
+					return msgs, err
+				}
+				if err := client.Delete(context.TODO(), sidecar.GetName(), metav1.DeleteOptions{}); err != nil {
+					return msgs, err
+				}
+				if err := istio.applyManifestOnSingleCluster(manifest, false, ns, mclient); err != nil {
+					return msgs, err
+				}
+				msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s replaced by the egress lockdown Sidecar %s/%s", ns, sidecar.GetName(), ns, egressLockdownSidecar))
+				continue
+			}
+			if err := client.Delete(context.TODO(), sidecar.GetName(), metav1.DeleteOptions{}); err != nil && !kubeerror.IsNotFound(err) {
+				return msgs, err
+			}
+			msgs = append(msgs, fmt.Sprintf("Sidecar %s/%s deleted", ns, sidecar.GetName()))
+		}
+		if len(list.Items) == 0 {
+			msgs = append(msgs, fmt.Sprintf("no generated Sidecar in %s", ns))
+		}
+	}
+	return msgs, nil
+}
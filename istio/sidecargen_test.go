@@ -0,0 +1,234 @@
+package istio
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestSidecarGeneration_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{
+			name:   "namespace granularity by default",
+			params: "{namespaces: [bookinfo]}",
+		},
+		{
+			name:   "workload granularity",
+			params: "{namespaces: [bookinfo], granularity: workload, window: 7d, extraHosts: [istio-system/*, '*/api.example.com']}",
+		},
+		{
+			name:    "no namespace",
+			wantErr: true,
+		},
+		{
+			name:    "invalid granularity",
+			params:  "{namespaces: [bookinfo], granularity: pod}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid window",
+			params:  "{namespaces: [bookinfo], window: a day}",
+			wantErr: true,
+		},
+		{
+			name:    "extra host without namespace",
+			params:  "{namespaces: [bookinfo], extraHosts: [api.example.com]}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generation := defaultSidecarGeneration()
+			if err := parseOperationParams(tt.params, &generation); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := generation.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("sidecarGeneration.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutboundTrafficQuery(t *testing.T) {
+	query := outboundTrafficQuery([]string{"bookinfo"}, "24h")
+	for _, want := range []string{`istio_requests_total{reporter="source", source_workload_namespace=~"bookinfo"}[24h]`, `istio_tcp_connections_opened_total{`, `by (source_workload, source_workload_namespace, destination_service)`} {
+		if !strings.Contains(query, want) {
+			t.Errorf("outboundTrafficQuery() = %s, missing %s", query, want)
+		}
+	}
+}
+
+func TestObservedDependencies(t *testing.T) {
+	samples, err := parsePrometheusVector([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"source_workload":"productpage-v1","source_workload_namespace":"bookinfo","destination_service":"reviews.bookinfo.svc.cluster.local"},"value":[1700000000,"12"]},
+		{"metric":{"source_workload":"productpage-v1","source_workload_namespace":"bookinfo","destination_service":"details.bookinfo.svc.cluster.local"},"value":[1700000000,"4"]},
+		{"metric":{"source_workload":"reviews-v2","source_workload_namespace":"bookinfo","destination_service":"PassthroughCluster"},"value":[1700000000,"1"]},
+		{"metric":{"source_workload":"unknown","source_workload_namespace":"unknown","destination_service":"reviews.bookinfo.svc.cluster.local"},"value":[1700000000,"2"]}]}}`))
+	if err != nil {
+		t.Fatalf("parsePrometheusVector() error = %v", err)
+	}
+	want := map[string]map[string]sets.Set[string]{
+		"bookinfo": {"productpage-v1": sets.New("reviews.bookinfo.svc.cluster.local", "details.bookinfo.svc.cluster.local")},
+	}
+	if got := observedDependencies(samples); !reflect.DeepEqual(got, want) {
+		t.Errorf("observedDependencies() = %v, want %v", got, want)
+	}
+}
+
+func testMeshInventory() meshInventory {
+	vs := func(namespace string, spec map[string]interface{}) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "vs", "namespace": namespace},
+			"spec":     spec,
+		}}
+	}
+	route := func(hosts ...interface{}) []interface{} {
+		var routes []interface{}
+		for _, host := range hosts {
+			routes = append(routes, map[string]interface{}{"destination": map[string]interface{}{"host": host}})
+		}
+		return []interface{}{map[string]interface{}{"route": routes}}
+	}
+	return meshInventory{
+		services: map[string]string{
+			"productpage.bookinfo.svc.cluster.local": "bookinfo",
+			"reviews.bookinfo.svc.cluster.local":     "bookinfo",
+			"ratings.bookinfo.svc.cluster.local":     "bookinfo",
+			"cart.shop.svc.cluster.local":            "shop",
+			"payments.shop.svc.cluster.local":        "shop",
+			"catalog.shop.svc.cluster.local":         "shop",
+			"istiod.istio-system.svc.cluster.local":  "istio-system",
+		},
+		virtualServices: []unstructured.Unstructured{
+			vs("bookinfo", map[string]interface{}{"hosts": []interface{}{"reviews"}, "http": route("reviews", "cart.shop")}),
+			vs("shop", map[string]interface{}{"hosts": []interface{}{"cart"}, "http": route("cart", "payments"), "tcp": route("api.example.com")}),
+		},
+		destinationRules: []unstructured.Unstructured{
+			{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "ratings", "namespace": "bookinfo"},
+				"spec":     map[string]interface{}{"host": "ratings"},
+			}},
+		},
+	}
+}
+
+func TestMeshInventory_egressHosts(t *testing.T) {
+	inv := testMeshInventory()
+	tests := []struct {
+		name      string
+		namespace string
+		hosts     sets.Set[string]
+		want      []string
+	}{
+		{
+			name:      "configured dependencies of the namespace",
+			namespace: "bookinfo",
+			hosts:     inv.configuredDependencies("bookinfo"),
+			want:      []string{"*/api.example.com", "./*", "istio-system/*", "shop/cart.shop.svc.cluster.local", "shop/payments.shop.svc.cluster.local"},
+		},
+		{
+			name:      "observed dependencies of a workload",
+			namespace: "bookinfo",
+			hosts:     sets.New("cart.shop.svc.cluster.local", "ratings.bookinfo.svc.cluster.local"),
+			want:      []string{"*/api.example.com", "./*", "istio-system/*", "shop/cart.shop.svc.cluster.local", "shop/payments.shop.svc.cluster.local"},
+		},
+		{
+			name:      "configured and observed dependencies of a workload",
+			namespace: "shop",
+			hosts:     inv.configuredDependencies("shop").Union(sets.New("istiod.istio-system.svc.cluster.local")),
+			want:      []string{"*/api.example.com", "./*", "istio-system/*", "istio-system/istiod.istio-system.svc.cluster.local"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inv.egressHosts(tt.namespace, inv.withRoutedDestinations(tt.hosts), []string{"istio-system/*"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("meshInventory.egressHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeshInventory_sizeEstimate(t *testing.T) {
+	inv := testMeshInventory()
+	tests := []struct {
+		name   string
+		egress []string
+		want   string
+	}{
+		{
+			name:   "namespace and one remote service",
+			egress: []string{"./*", "shop/cart.shop.svc.cluster.local"},
+			want:   "4 of 7 service(s) visible, about 42% less proxy configuration",
+		},
+		{
+			name:   "external host",
+			egress: []string{"*/api.example.com", "istio-system/*"},
+			want:   "2 of 7 service(s) visible, about 71% less proxy configuration",
+		},
+		{
+			name:   "whole mesh",
+			egress: []string{"*/*"},
+			want:   "7 service(s) visible, no reduction",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inv.sizeEstimate("bookinfo", tt.egress); got != tt.want {
+				t.Errorf("meshInventory.sizeEstimate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceableSidecar(t *testing.T) {
+	toUnstructured := func(obj map[string]interface{}) *unstructured.Unstructured {
+		byt, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(byt); err != nil {
+			t.Fatalf("UnmarshalJSON() error = %v", err)
+		}
+		return u
+	}
+	// same name and spec as the egress lockdown, without its label
+	userSidecar := egressLockdown{}.sidecar("bookinfo")
+	delete(userSidecar["metadata"].(map[string]interface{}), "labels")
+	tests := []struct {
+		name    string
+		sidecar map[string]interface{}
+		want    bool
+	}{
+		{
+			name:    "generated",
+			sidecar: generatedSidecar("bookinfo", "default", nil, []string{"./*"}, nil),
+			want:    true,
+		},
+		{
+			name:    "egress lockdown",
+			sidecar: egressLockdown{}.sidecar("bookinfo"),
+			want:    true,
+		},
+		{
+			name:    "namespace-wide Sidecar of the user",
+			sidecar: userSidecar,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceableSidecar(toUnstructured(tt.sidecar)); got != tt.want {
+				t.Errorf("replaceableSidecar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package istio
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+)
+
+// Tracing providers which can be registered as extension providers
+const (
+	TracingProviderZipkin        = "zipkin"
+	TracingProviderOpenTelemetry = "opentelemetry"
+
+	telemetryAPIVersion    = "telemetry.istio.io/v1alpha1"
+	tracingTelemetryName   = "meshery-tracing"
+	otelCollectorService   = "opentelemetry-collector.istio-system.svc.cluster.local"
+	otelCollectorGRPCPort  = 4317
+	otelTracingProviderKey = "otel-tracing"
+)
+
+// tracingProvider is an extension provider of the mesh config receiving spans
+type tracingProvider struct {
+	// Name under which the extension provider is registered
+	Name string `yaml:"name,omitempty"`
+	// Type of the extension provider: zipkin or opentelemetry
+	Provider string `yaml:"provider,omitempty"`
+	// Service receiving the spans, e.g. tempo.observability.svc.cluster.local
+	Service string `yaml:"service,omitempty"`
+	Port    int    `yaml:"port,omitempty"`
+}
+
+func (p tracingProvider) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("tracing provider name is required")
+	}
+	switch p.Provider {
+	case TracingProviderZipkin, TracingProviderOpenTelemetry:
+	default:
+		return fmt.Errorf("unsupported tracing provider: %s", p.Provider)
+	}
+	if p.Service == "" {
+		return fmt.Errorf("tracing provider service is required")
+	}
+	if p.Port <= 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid tracing port: %d", p.Port)
+	}
+	return nil
+}
+
+// extensionProvider returns the mesh config extension provider sending
+// spans to the tracing backend
+func (p tracingProvider) extensionProvider() map[string]interface{} {
+	return map[string]interface{}{
+		"name": p.Name,
+		p.Provider: map[string]interface{}{
+			"service": p.Service,
+			"port":    p.Port,
+		},
+	}
+}
+
+// serviceURL returns the address spans are sent to as a URL
+func (p tracingProvider) serviceURL() string {
+	if p.Service == "" {
+		return ""
+	}
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(p.Service, strconv.Itoa(p.Port)))
+}
+
+// customTag is a tag added to the spans, whose value is either a literal,
+// a request header or an environment variable of the proxy
+type customTag struct {
+	Literal      string `yaml:"literal,omitempty"`
+	Header       string `yaml:"header,omitempty"`
+	Environment  string `yaml:"environment,omitempty"`
+	DefaultValue string `yaml:"defaultValue,omitempty"`
+}
+
+func (t customTag) spec() (map[string]interface{}, error) {
+	switch {
+	case t.Literal != "":
+		return map[string]interface{}{"literal": map[string]interface{}{"value": t.Literal}}, nil
+	case t.Header != "":
+		return map[string]interface{}{"header": map[string]interface{}{"name": t.Header, "defaultValue": t.DefaultValue}}, nil
+	case t.Environment != "":
+		return map[string]interface{}{"environment": map[string]interface{}{"name": t.Environment, "defaultValue": t.DefaultValue}}, nil
+	}
+	return nil, fmt.Errorf("custom tag needs one of literal, header or environment")
+}
+
+// telemetryTracing describes the tracing configuration applied through
+// the Telemetry API
+type telemetryTracing struct {
+	Provider tracingProvider `yaml:"provider,omitempty"`
+	// Namespaces to configure, the whole mesh is configured when empty
+	Namespaces         []string             `yaml:"namespaces,omitempty"`
+	SamplingPercentage *float64             `yaml:"samplingPercentage,omitempty"`
+	CustomTags         map[string]customTag `yaml:"customTags,omitempty"`
+}
+
+// defaultTelemetryTracing sends spans to the OpenTelemetry Collector addon
+func defaultTelemetryTracing() telemetryTracing {
+	return telemetryTracing{
+		Provider: tracingProvider{
+			Name:     otelTracingProviderKey,
+			Provider: TracingProviderOpenTelemetry,
+			Service:  otelCollectorService,
+			Port:     otelCollectorGRPCPort,
+		},
+	}
+}
+
+func (t telemetryTracing) validate() error {
+	if err := t.Provider.validate(); err != nil {
+		return ErrTelemetry(err)
+	}
+	if t.SamplingPercentage != nil && (*t.SamplingPercentage < 0 || *t.SamplingPercentage > 100) {
+		return ErrTelemetry(fmt.Errorf("sampling percentage must be between 0 and 100, got %v", *t.SamplingPercentage))
+	}
+	for name, tag := range t.CustomTags {
+		if _, err := tag.spec(); err != nil {
+			return ErrTelemetry(fmt.Errorf("custom tag %s: %w", name, err))
+		}
+	}
+	return nil
+}
+
+// manifest renders the Telemetry resource configuring tracing in the namespace
+func (t telemetryTracing) manifest(namespace string) (string, error) {
+	tracing := map[string]interface{}{
+		"providers": []interface{}{
+			map[string]interface{}{"name": t.Provider.Name},
+		},
+	}
+	if t.SamplingPercentage != nil {
+		tracing["randomSamplingPercentage"] = *t.SamplingPercentage
+	}
+	if len(t.CustomTags) > 0 {
+		tags := map[string]interface{}{}
+		for name, tag := range t.CustomTags {
+			spec, err := tag.spec()
+			if err != nil {
+				return "", ErrTelemetry(err)
+			}
+			tags[name] = spec
+		}
+		tracing["customTags"] = tags
+	}
+
+	telemetry := map[string]interface{}{
+		"apiVersion": telemetryAPIVersion,
+		"kind":       "Telemetry",
+		"metadata": map[string]interface{}{
+			"name":      tracingTelemetryName,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"tracing": []interface{}{tracing},
+		},
+	}
+	byt, err := yaml.Marshal(telemetry)
+	if err != nil {
+		return "", ErrTelemetry(err)
+	}
+	return string(byt), nil
+}
+
+// configureTelemetryTracing registers the tracing provider in the mesh
+// config and creates the Telemetry resources sending spans to it
+func (istio *Istio) configureTelemetryTracing(del bool, tracing telemetryTracing, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := tracing.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureTelemetryTracingOnSingleCluster(del, tracing, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrTelemetry(mergeErrors(errs))
+}
+
+func (istio *Istio) configureTelemetryTracingOnSingleCluster(del bool, tracing telemetryTracing, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+
+	namespaces := tracing.Namespaces
+	if len(namespaces) == 0 {
+		mesh, err := getMeshConfig(mclient)
+		if err != nil {
+			return msgs, err
+		}
+		namespaces = []string{mesh.rootNamespace()}
+	}
+
+	// The provider needs to be known to istiod before Telemetry resources
+	// refer to it, and outlive them on removal
+	if !del {
+		err := updateMeshConfig(mclient, func(mesh meshConfig) error {
+			mesh.setExtensionProvider(tracing.Provider.extensionProvider())
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("extension provider %s registered in the mesh config", tracing.Provider.Name))
+	}
+
+	for _, ns := range namespaces {
+		manifest, err := tracing.manifest(ns)
+		if err != nil {
+			return msgs, err
+		}
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), del, ns, mclient); err != nil {
+			return msgs, ErrTelemetry(err)
+		}
+		msgs = append(msgs, fmt.Sprintf("Telemetry %s/%s %s", ns, tracingTelemetryName, pastTense(del)))
+	}
+
+	if del {
+		err := updateMeshConfig(mclient, func(mesh meshConfig) error {
+			mesh.removeExtensionProvider(tracing.Provider.Name)
+			return nil
+		})
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("extension provider %s removed from the mesh config", tracing.Provider.Name))
+	}
+	return msgs, nil
+}
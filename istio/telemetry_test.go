@@ -0,0 +1,107 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestTelemetryTracing_validate(t *testing.T) {
+	percentage := func(p float64) *float64 { return &p }
+	tests := []struct {
+		name    string
+		mutate  func(*telemetryTracing)
+		wantErr bool
+	}{
+		{
+			name:    "defaults are valid",
+			mutate:  func(*telemetryTracing) {},
+			wantErr: false,
+		},
+		{
+			name: "unsupported provider",
+			mutate: func(tt *telemetryTracing) {
+				tt.Provider.Provider = "datadog"
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid port",
+			mutate: func(tt *telemetryTracing) {
+				tt.Provider.Port = 70000
+			},
+			wantErr: true,
+		},
+		{
+			name: "sampling percentage out of range",
+			mutate: func(tt *telemetryTracing) {
+				tt.SamplingPercentage = percentage(120)
+			},
+			wantErr: true,
+		},
+		{
+			name: "custom tag without value",
+			mutate: func(tt *telemetryTracing) {
+				tt.CustomTags = map[string]customTag{"cluster": {}}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracing := defaultTelemetryTracing()
+			tt.mutate(&tracing)
+			if err := tracing.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("telemetryTracing.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTelemetryTracing_manifest(t *testing.T) {
+	tracing := defaultTelemetryTracing()
+	if err := parseOperationParams(`
+samplingPercentage: 25
+customTags:
+  cluster:
+    literal: east
+  user-agent:
+    header: User-Agent
+    defaultValue: unknown
+`, &tracing); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+
+	manifest, err := tracing.manifest("bookinfo")
+	if err != nil {
+		t.Fatalf("telemetryTracing.manifest() error = %v", err)
+	}
+	got := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(manifest), &got); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "telemetry.istio.io/v1alpha1",
+		"kind":       "Telemetry",
+		"metadata": map[string]interface{}{
+			"name":      "meshery-tracing",
+			"namespace": "bookinfo",
+		},
+		"spec": map[string]interface{}{
+			"tracing": []interface{}{
+				map[string]interface{}{
+					"providers":                []interface{}{map[string]interface{}{"name": "otel-tracing"}},
+					"randomSamplingPercentage": float64(25),
+					"customTags": map[string]interface{}{
+						"cluster":    map[string]interface{}{"literal": map[string]interface{}{"value": "east"}},
+						"user-agent": map[string]interface{}{"header": map[string]interface{}{"name": "User-Agent", "defaultValue": "unknown"}},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("telemetryTracing.manifest() = %v, want %v", got, want)
+	}
+}
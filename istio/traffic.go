@@ -0,0 +1,565 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	networkingAPIVersion = "networking.istio.io/v1beta1"
+
+	// trafficShiftAnnotation records on a DestinationRule or a VirtualService
+	// the subsets and routes added by the traffic shift, so that exactly
+	// those can be reverted
+	trafficShiftAnnotation = "meshery.io/traffic-shift"
+
+	trafficShiftRouteName = "meshery-traffic-shift"
+
+	versionLabel = "version"
+)
+
+var invalidSubsetChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// trafficShift describes how the traffic of a service is split between the
+// versions of its workloads
+type trafficShift struct {
+	// Service whose traffic is shifted
+	Service string `yaml:"service,omitempty"`
+	// Percentage of the traffic sent to each version, e.g. {v1: 80, v2: 20}.
+	// The traffic is split evenly between all the versions when empty.
+	Weights map[string]int `yaml:"weights,omitempty"`
+	// Routes matching a request header, evaluated before the weights
+	HeaderRoutes []headerRoute `yaml:"headerRoutes,omitempty"`
+}
+
+// trafficShiftRecord is what the traffic shift added to a DestinationRule or
+// a VirtualService
+type trafficShiftRecord struct {
+	// The resource was created by the traffic shift
+	Created bool `json:"created,omitempty"`
+	// Subsets added to the DestinationRule
+	Subsets []string `json:"subsets,omitempty"`
+	// Routes added to the VirtualService
+	Routes []string `json:"routes,omitempty"`
+}
+
+// headerRoute sends the requests whose header matches to a single version
+type headerRoute struct {
+	Header string `yaml:"header,omitempty"`
+	// Exact value of the header
+	Value string `yaml:"value,omitempty"`
+	// RE2 regular expression matching the value of the header
+	Regex   string `yaml:"regex,omitempty"`
+	Version string `yaml:"version,omitempty"`
+}
+
+func (t trafficShift) validate() error {
+	if t.Service == "" {
+		return ErrTrafficShift(fmt.Errorf("service is required"))
+	}
+	if len(t.Weights) > 0 {
+		total := 0
+		for version, weight := range t.Weights {
+			if weight < 0 || weight > 100 {
+				return ErrTrafficShift(fmt.Errorf("invalid weight %d for version %s", weight, version))
+			}
+			total += weight
+		}
+		if total != 100 {
+			return ErrTrafficShift(fmt.Errorf("weights add up to %d instead of 100", total))
+		}
+	}
+	for _, route := range t.HeaderRoutes {
+		if route.Header == "" || route.Version == "" {
+			return ErrTrafficShift(fmt.Errorf("header routes need a header and a version"))
+		}
+		if (route.Value == "") == (route.Regex == "") {
+			return ErrTrafficShift(fmt.Errorf("header route on %s needs either a value or a regex", route.Header))
+		}
+	}
+	return nil
+}
+
+// resolveWeights checks that the versions referred to exist and returns the
+// weight of each version
+func (t trafficShift) resolveWeights(versions []string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, v := range versions {
+		known[v] = true
+	}
+	for version := range t.Weights {
+		if !known[version] {
+			return nil, ErrTrafficShift(fmt.Errorf("service %s has no workload with version %s, found: %s", t.Service, version, strings.Join(versions, ", ")))
+		}
+	}
+	for _, route := range t.HeaderRoutes {
+		if !known[route.Version] {
+			return nil, ErrTrafficShift(fmt.Errorf("service %s has no workload with version %s, found: %s", t.Service, route.Version, strings.Join(versions, ", ")))
+		}
+	}
+
+	if len(t.Weights) > 0 {
+		return t.Weights, nil
+	}
+	if len(versions) == 0 {
+		return nil, ErrTrafficShift(fmt.Errorf("no workload of service %s carries a %s label", t.Service, versionLabel))
+	}
+	// split evenly, the first versions getting the remainder
+	weights := map[string]int{}
+	for i, v := range versions {
+		weights[v] = 100 / len(versions)
+		if i < 100%len(versions) {
+			weights[v]++
+		}
+	}
+	return weights, nil
+}
+
+// subsets returns a subset per version
+func (t trafficShift) subsets(versions []string) []interface{} {
+	var subsets []interface{}
+	for _, v := range versions {
+		subsets = append(subsets, map[string]interface{}{
+			"name":   subsetName(v),
+			"labels": map[string]interface{}{versionLabel: v},
+		})
+	}
+	return subsets
+}
+
+// routes returns the named HTTP routes sending the header matches and the
+// weighted split to the subsets of the versions
+func (t trafficShift) routes(weights map[string]int) []interface{} {
+	var routes []interface{}
+	for i, route := range t.HeaderRoutes {
+		match := map[string]interface{}{"exact": route.Value}
+		if route.Regex != "" {
+			match = map[string]interface{}{"regex": route.Regex}
+		}
+		routes = append(routes, map[string]interface{}{
+			"name": fmt.Sprintf("%s-header-%d", trafficShiftRouteName, i),
+			"match": []interface{}{
+				map[string]interface{}{"headers": map[string]interface{}{route.Header: match}},
+			},
+			"route": []interface{}{
+				map[string]interface{}{"destination": map[string]interface{}{"host": t.Service, "subset": subsetName(route.Version)}},
+			},
+		})
+	}
+	var destinations []interface{}
+	for _, v := range sortedKeys(weights) {
+		destinations = append(destinations, map[string]interface{}{
+			"destination": map[string]interface{}{"host": t.Service, "subset": subsetName(v)},
+			"weight":      int64(weights[v]),
+		})
+	}
+	routes = append(routes, map[string]interface{}{"name": trafficShiftRouteName, "route": destinations})
+	return routes
+}
+
+// shiftSubsets adds a subset per version to the DestinationRule, keeping its
+// other subsets and its traffic policy, and records the added subsets. An
+// existing subset of the same name must select the same version.
+func shiftSubsets(dr *unstructured.Unstructured, t trafficShift, versions []string) error {
+	created, err := revertTrafficShift(dr)
+	if err != nil {
+		return err
+	}
+	subsets, _, err := unstructured.NestedSlice(dr.Object, "spec", "subsets")
+	if err != nil {
+		return ErrTrafficShift(err)
+	}
+	existing := map[string]map[string]interface{}{}
+	for _, s := range subsets {
+		subset, _ := s.(map[string]interface{})
+		name, _ := subset["name"].(string)
+		existing[name] = subset
+	}
+
+	record := trafficShiftRecord{Created: created}
+	for _, s := range t.subsets(versions) {
+		subset := s.(map[string]interface{})
+		name := subset["name"].(string)
+		if current, ok := existing[name]; ok {
+			labels, _, _ := unstructured.NestedStringMap(current, "labels")
+			if want := subset["labels"].(map[string]interface{}); len(labels) != 1 || labels[versionLabel] != want[versionLabel] {
+				return ErrTrafficShift(fmt.Errorf("subset %s of DestinationRule %s does not select version %s", name, dr.GetName(), want[versionLabel]))
+			}
+			continue
+		}
+		subsets = append(subsets, subset)
+		record.Subsets = append(record.Subsets, name)
+	}
+	if err := unstructured.SetNestedSlice(dr.Object, subsets, "spec", "subsets"); err != nil {
+		return ErrTrafficShift(err)
+	}
+	return setTrafficShiftRecord(dr, record)
+}
+
+// shiftRoutes sets the routes of the traffic shift on the VirtualService,
+// after its other routes, and records them
+func shiftRoutes(vs *unstructured.Unstructured, t trafficShift, weights map[string]int) error {
+	created, err := revertTrafficShift(vs)
+	if err != nil {
+		return err
+	}
+	routes, _, err := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if err != nil {
+		return ErrTrafficShift(err)
+	}
+
+	record := trafficShiftRecord{Created: created}
+	for _, r := range t.routes(weights) {
+		routes = append(routes, r)
+		record.Routes = append(record.Routes, r.(map[string]interface{})["name"].(string))
+	}
+	if err := unstructured.SetNestedSlice(vs.Object, routes, "spec", "http"); err != nil {
+		return ErrTrafficShift(err)
+	}
+	return setTrafficShiftRecord(vs, record)
+}
+
+// revertTrafficShift removes from the DestinationRule or the VirtualService
+// the subsets and routes the traffic shift added to it. It reports whether
+// the resource was created by the traffic shift.
+func revertTrafficShift(res *unstructured.Unstructured) (bool, error) {
+	annotations := res.GetAnnotations()
+	raw, ok := annotations[trafficShiftAnnotation]
+	if !ok {
+		return false, nil
+	}
+	record := trafficShiftRecord{}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false, ErrTrafficShift(err)
+	}
+
+	for field, names := range map[string][]string{"subsets": record.Subsets, "http": record.Routes} {
+		if len(names) == 0 {
+			continue
+		}
+		items, _, err := unstructured.NestedSlice(res.Object, "spec", field)
+		if err != nil {
+			return false, ErrTrafficShift(err)
+		}
+		added := toSet(names)
+		kept := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			if name, _ := m["name"].(string); added[name] {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		if len(kept) == 0 {
+			unstructured.RemoveNestedField(res.Object, "spec", field)
+			continue
+		}
+		if err := unstructured.SetNestedSlice(res.Object, kept, "spec", field); err != nil {
+			return false, ErrTrafficShift(err)
+		}
+	}
+
+	delete(annotations, trafficShiftAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	res.SetAnnotations(annotations)
+	return record.Created, nil
+}
+
+func setTrafficShiftRecord(res *unstructured.Unstructured, record trafficShiftRecord) error {
+	byt, err := json.Marshal(record)
+	if err != nil {
+		return ErrTrafficShift(err)
+	}
+	annotations := res.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[trafficShiftAnnotation] = string(byt)
+	res.SetAnnotations(annotations)
+	return nil
+}
+
+// hasOnlyHosts checks if the spec of the resource holds nothing but its
+// hosts, once the traffic shift is reverted. Resources created by the
+// traffic shift are only deleted then, the circuit breaker or the fault
+// injection may have been configured on them since.
+func hasOnlyHosts(res *unstructured.Unstructured) bool {
+	spec, _, _ := unstructured.NestedMap(res.Object, "spec")
+	for field, value := range spec {
+		if field == "host" || field == "hosts" {
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			if len(v) > 0 {
+				return false
+			}
+		case map[string]interface{}:
+			if len(v) > 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return len(res.GetAnnotations()) == 0
+}
+
+// newTrafficShiftResource returns an empty DestinationRule or VirtualService
+// named after the service, for services without any yet
+func newTrafficShiftResource(namespace, kind string, t trafficShift) (*unstructured.Unstructured, error) {
+	spec := map[string]interface{}{"host": t.Service}
+	if kind == "VirtualService" {
+		spec = map[string]interface{}{"hosts": []interface{}{t.Service}}
+	}
+	res := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": networkingAPIVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      t.Service,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}}
+	// the record is completed once the subsets or routes are added
+	return res, setTrafficShiftRecord(res, trafficShiftRecord{Created: true})
+}
+
+// trafficShiftManaged returns the resource holding a traffic shift, if any
+func trafficShiftManaged(resources []unstructured.Unstructured) *unstructured.Unstructured {
+	for i := range resources {
+		if _, ok := resources[i].GetAnnotations()[trafficShiftAnnotation]; ok {
+			return &resources[i]
+		}
+	}
+	return nil
+}
+
+// describe reports the routing applied to the service
+func (t trafficShift) describe(weights map[string]int) string {
+	var split []string
+	for _, v := range sortedKeys(weights) {
+		split = append(split, fmt.Sprintf("%s %d%%", v, weights[v]))
+	}
+	msg := fmt.Sprintf("%s: %s", t.Service, strings.Join(split, ", "))
+	for _, route := range t.HeaderRoutes {
+		value := route.Value
+		if route.Regex != "" {
+			value = fmt.Sprintf("~%s", route.Regex)
+		}
+		msg = fmt.Sprintf("%s; %s=%s to %s", msg, route.Header, value, route.Version)
+	}
+	return msg
+}
+
+// configureTrafficShift splits the traffic of the service between its
+// versions as requested
+func (istio *Istio) configureTrafficShift(namespace string, del bool, shift trafficShift, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if err := shift.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			msg, err := istio.configureTrafficShiftOnSingleCluster(namespace, del, shift, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			msgs = append(msgs, msg)
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrTrafficShift(mergeErrors(errs))
+}
+
+func (istio *Istio) configureTrafficShiftOnSingleCluster(namespace string, del bool, shift trafficShift, mclient *mesherykube.Client) (string, error) {
+	drClient := mclient.DynamicKubeClient.Resource(destinationRuleGVR).Namespace(namespace)
+	vsClient := mclient.DynamicKubeClient.Resource(virtualServiceGVR).Namespace(namespace)
+
+	drs, err := destinationRulesForHost(mclient, namespace, shift.Service)
+	if err != nil {
+		return "", ErrTrafficShift(err)
+	}
+	vss, err := virtualServicesForHost(mclient, namespace, shift.Service)
+	if err != nil {
+		return "", ErrTrafficShift(err)
+	}
+
+	if del {
+		reverted := false
+		for _, res := range []struct {
+			items  []unstructured.Unstructured
+			client dynamic.ResourceInterface
+		}{{vss, vsClient}, {drs, drClient}} {
+			for i := range res.items {
+				obj := &res.items[i]
+				if _, ok := obj.GetAnnotations()[trafficShiftAnnotation]; !ok {
+					continue
+				}
+				reverted = true
+				created, err := revertTrafficShift(obj)
+				if err != nil {
+					return "", err
+				}
+				if created && hasOnlyHosts(obj) {
+					err = res.client.Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{})
+				} else {
+					_, err = res.client.Update(context.TODO(), obj, metav1.UpdateOptions{})
+				}
+				if err != nil {
+					return "", ErrTrafficShift(err)
+				}
+			}
+		}
+		if !reverted {
+			return "", ErrTrafficShift(fmt.Errorf("no traffic shift is configured for %s in namespace %s", shift.Service, namespace))
+		}
+		return fmt.Sprintf("routing of %s reset", shift.Service), nil
+	}
+
+	vs := trafficShiftManaged(vss)
+	if vs == nil && len(vss) > 0 {
+		return "", ErrTrafficShift(fmt.Errorf("%s is already routed by VirtualService %s/%s, which was not created by a traffic shift", shift.Service, namespace, vss[0].GetName()))
+	}
+	versions, err := serviceVersions(mclient, namespace, shift.Service)
+	if err != nil {
+		return "", err
+	}
+	weights, err := shift.resolveWeights(versions)
+	if err != nil {
+		return "", err
+	}
+
+	// the subsets are merged into the DestinationRule of the host, if any
+	dr := trafficShiftManaged(drs)
+	if dr == nil && len(drs) > 0 {
+		dr = &drs[0]
+	}
+	if dr == nil {
+		if dr, err = newTrafficShiftResource(namespace, "DestinationRule", shift); err != nil {
+			return "", err
+		}
+		if err := shiftSubsets(dr, shift, versions); err != nil {
+			return "", err
+		}
+		_, err = drClient.Create(context.TODO(), dr, metav1.CreateOptions{})
+	} else {
+		if err := shiftSubsets(dr, shift, versions); err != nil {
+			return "", err
+		}
+		_, err = drClient.Update(context.TODO(), dr, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return "", ErrTrafficShift(err)
+	}
+
+	if vs == nil {
+		if vs, err = newTrafficShiftResource(namespace, "VirtualService", shift); err != nil {
+			return "", err
+		}
+		if err := shiftRoutes(vs, shift, weights); err != nil {
+			return "", err
+		}
+		_, err = vsClient.Create(context.TODO(), vs, metav1.CreateOptions{})
+	} else {
+		if err := shiftRoutes(vs, shift, weights); err != nil {
+			return "", err
+		}
+		_, err = vsClient.Update(context.TODO(), vs, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return "", ErrTrafficShift(err)
+	}
+	return shift.describe(weights), nil
+}
+
+// serviceVersions returns the sorted values of the version label of the
+// Deployments selected by the service
+func serviceVersions(mclient *mesherykube.Client, namespace, service string) ([]string, error) {
+	svc, err := mclient.KubeClient.CoreV1().Services(namespace).Get(context.TODO(), service, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrTrafficShift(err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return nil, ErrTrafficShift(fmt.Errorf("service %s/%s has no selector", namespace, service))
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	deploys, err := mclient.KubeClient.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrTrafficShift(err)
+	}
+	found := map[string]bool{}
+	for _, deploy := range deploys.Items {
+		podLabels := deploy.Spec.Template.Labels
+		if !selector.Matches(labels.Set(podLabels)) {
+			continue
+		}
+		if v := podLabels[versionLabel]; v != "" {
+			found[v] = true
+		}
+	}
+	versions := make([]string, 0, len(found))
+	for v := range found {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// subsetName turns a version label value into a valid subset name
+func subsetName(version string) string {
+	return strings.Trim(invalidSubsetChars.ReplaceAllString(strings.ToLower(version), "-"), "-")
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,216 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestTrafficShift_resolveWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		shift    trafficShift
+		versions []string
+		want     map[string]int
+		wantErr  bool
+	}{
+		{
+			name:     "even split",
+			shift:    trafficShift{Service: "reviews"},
+			versions: []string{"v1", "v2", "v3"},
+			want:     map[string]int{"v1": 34, "v2": 33, "v3": 33},
+		},
+		{
+			name:     "explicit weights",
+			shift:    trafficShift{Service: "reviews", Weights: map[string]int{"v1": 80, "v2": 20}},
+			versions: []string{"v1", "v2", "v3"},
+			want:     map[string]int{"v1": 80, "v2": 20},
+		},
+		{
+			name:     "unknown version",
+			shift:    trafficShift{Service: "reviews", Weights: map[string]int{"v1": 50, "v4": 50}},
+			versions: []string{"v1", "v2", "v3"},
+			wantErr:  true,
+		},
+		{
+			name:     "header route to unknown version",
+			shift:    trafficShift{Service: "reviews", HeaderRoutes: []headerRoute{{Header: "end-user", Value: "jason", Version: "v4"}}},
+			versions: []string{"v1", "v2"},
+			wantErr:  true,
+		},
+		{
+			name:     "no versions",
+			shift:    trafficShift{Service: "reviews"},
+			versions: nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.shift.resolveWeights(tt.versions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("trafficShift.resolveWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trafficShift.resolveWeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficShift_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		shift   trafficShift
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			shift:   trafficShift{Service: "reviews", Weights: map[string]int{"v1": 80, "v2": 20}},
+			wantErr: false,
+		},
+		{
+			name:    "missing service",
+			shift:   trafficShift{Weights: map[string]int{"v1": 100}},
+			wantErr: true,
+		},
+		{
+			name:    "weights not adding up to 100",
+			shift:   trafficShift{Service: "reviews", Weights: map[string]int{"v1": 80, "v2": 30}},
+			wantErr: true,
+		},
+		{
+			name:    "header route with value and regex",
+			shift:   trafficShift{Service: "reviews", HeaderRoutes: []headerRoute{{Header: "end-user", Value: "jason", Regex: "j.*", Version: "v2"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.shift.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("trafficShift.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShiftRoutes(t *testing.T) {
+	shift := trafficShift{
+		Service:      "reviews",
+		Weights:      map[string]int{"v1": 80, "v3": 20},
+		HeaderRoutes: []headerRoute{{Header: "end-user", Value: "jason", Version: "v2"}},
+	}
+	vs, err := newTrafficShiftResource("bookinfo", "VirtualService", shift)
+	if err != nil {
+		t.Fatalf("newTrafficShiftResource() error = %v", err)
+	}
+	if err := shiftRoutes(vs, shift, shift.Weights); err != nil {
+		t.Fatalf("shiftRoutes() error = %v", err)
+	}
+	routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	want := []interface{}{
+		map[string]interface{}{
+			"name":  "meshery-traffic-shift-header-0",
+			"match": []interface{}{map[string]interface{}{"headers": map[string]interface{}{"end-user": map[string]interface{}{"exact": "jason"}}}},
+			"route": []interface{}{map[string]interface{}{"destination": map[string]interface{}{"host": "reviews", "subset": "v2"}}},
+		},
+		map[string]interface{}{
+			"name": "meshery-traffic-shift",
+			"route": []interface{}{
+				map[string]interface{}{"destination": map[string]interface{}{"host": "reviews", "subset": "v1"}, "weight": int64(80)},
+				map[string]interface{}{"destination": map[string]interface{}{"host": "reviews", "subset": "v3"}, "weight": int64(20)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("VirtualService http routes = %v, want %v", routes, want)
+	}
+	if got, want := shift.describe(shift.Weights), "reviews: v1 80%, v3 20%; end-user=jason to v2"; got != want {
+		t.Errorf("trafficShift.describe() = %v, want %v", got, want)
+	}
+
+	// shifting again replaces the routes of the previous shift
+	shift.Weights = map[string]int{"v1": 100}
+	shift.HeaderRoutes = nil
+	if err := shiftRoutes(vs, shift, shift.Weights); err != nil {
+		t.Fatalf("shiftRoutes() error = %v", err)
+	}
+	if routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http"); len(routes) != 1 {
+		t.Errorf("VirtualService has %d routes after a second shift, want 1", len(routes))
+	}
+	created, err := revertTrafficShift(vs)
+	if err != nil || !created || !hasOnlyHosts(vs) {
+		t.Errorf("revertTrafficShift() = %v, %v, hasOnlyHosts() = %v, want true, nil, true", created, err, hasOnlyHosts(vs))
+	}
+}
+
+func TestShiftSubsets(t *testing.T) {
+	shift := trafficShift{Service: "reviews"}
+	policy := map[string]interface{}{"connectionPool": map[string]interface{}{"tcp": map[string]interface{}{"maxConnections": int64(1)}}}
+	dr := func(subsets ...interface{}) *unstructured.Unstructured {
+		spec := map[string]interface{}{"host": "reviews", "trafficPolicy": runtime.DeepCopyJSONValue(policy)}
+		if len(subsets) > 0 {
+			spec["subsets"] = subsets
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": networkingAPIVersion,
+			"kind":       "DestinationRule",
+			"metadata":   map[string]interface{}{"name": "reviews", "namespace": "bookinfo"},
+			"spec":       spec,
+		}}
+	}
+	subset := func(name, version string) interface{} {
+		return map[string]interface{}{"name": name, "labels": map[string]interface{}{versionLabel: version}}
+	}
+	tests := []struct {
+		name    string
+		dr      *unstructured.Unstructured
+		wantErr bool
+	}{
+		{
+			name: "DestinationRule of the user with a circuit breaker",
+			dr:   dr(),
+		},
+		{
+			name: "existing subset of the same version",
+			dr:   dr(subset("v1", "v1"), subset("canary", "v3")),
+		},
+		{
+			name:    "existing subset of another version",
+			dr:      dr(subset("v1", "v2")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.dr.DeepCopy()
+			err := shiftSubsets(tt.dr, shift, []string{"v1", "v2"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shiftSubsets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if subsets, _, _ := unstructured.NestedSlice(tt.dr.Object, "spec", "subsets"); !reflect.DeepEqual(subsets[len(subsets)-1], subset("v2", "v2")) {
+				t.Errorf("shiftSubsets() subsets = %v, want v2 added", subsets)
+			}
+			created, err := revertTrafficShift(tt.dr)
+			if err != nil || created {
+				t.Fatalf("revertTrafficShift() = %v, %v, want false, nil", created, err)
+			}
+			if !reflect.DeepEqual(tt.dr.Object, original.Object) {
+				t.Errorf("revertTrafficShift() = %v, want %v", tt.dr.Object, original.Object)
+			}
+		})
+	}
+}
+
+func TestSubsetName(t *testing.T) {
+	for version, want := range map[string]string{"v1": "v1", "1.0.2": "1-0-2", "V2_beta": "v2-beta"} {
+		if got := subsetName(version); got != want {
+			t.Errorf("subsetName(%s) = %v, want %v", version, got, want)
+		}
+	}
+}
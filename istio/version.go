@@ -0,0 +1,85 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// imageVersionRegex matches the major and minor version at the start of an
+// image tag, e.g. docker.io/istio/proxyv2:1.17.2-distroless
+var imageVersionRegex = regexp.MustCompile(`:v?(\d+)\.(\d+)[^/]*$`)
+
+// minorVersion is the major and minor version of an Istio component
+type minorVersion struct {
+	Major int
+	Minor int
+}
+
+func (v minorVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// atLeast tells whether the version is the same as, or newer than, min
+func (v minorVersion) atLeast(min minorVersion) bool {
+	if v.Major != min.Major {
+		return v.Major > min.Major
+	}
+	return v.Minor >= min.Minor
+}
+
+// parseImageVersion returns the version from the tag of the image, images
+// referenced by digest or with a custom tag have no version
+func parseImageVersion(image string) (minorVersion, bool) {
+	match := imageVersionRegex.FindStringSubmatch(image)
+	if match == nil {
+		return minorVersion{}, false
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return minorVersion{Major: major, Minor: minor}, true
+}
+
+// proxyVersion returns the version of the sidecar, or gateway, proxy of the
+// pod from the image of its istio-proxy container
+func proxyVersion(pod corev1.Pod) (minorVersion, bool) {
+	containers := append(append([]corev1.Container{}, pod.Spec.Containers...), pod.Spec.InitContainers...)
+	for _, c := range containers {
+		if c.Name == sidecarContainerName {
+			return parseImageVersion(c.Image)
+		}
+	}
+	return minorVersion{}, false
+}
+
+// controlPlaneVersion returns the version of the istiod control plane from
+// the image of its discovery container. The oldest one is returned when
+// several revisions are installed, so that rendered configuration suits
+// every proxy.
+func controlPlaneVersion(mclient *mesherykube.Client) (minorVersion, error) {
+	deployments, err := mclient.KubeClient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: "app=istiod"})
+	if err != nil {
+		return minorVersion{}, err
+	}
+	var oldest *minorVersion
+	for _, deploy := range deployments.Items {
+		for _, c := range deploy.Spec.Template.Spec.Containers {
+			if c.Name != "discovery" {
+				continue
+			}
+			version, ok := parseImageVersion(c.Image)
+			if ok && (oldest == nil || !version.atLeast(*oldest)) {
+				oldest = &version
+			}
+		}
+	}
+	if oldest == nil {
+		return minorVersion{}, fmt.Errorf("no istiod deployment with a versioned image found")
+	}
+	return *oldest, nil
+}
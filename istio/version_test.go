@@ -0,0 +1,29 @@
+package istio
+
+import "testing"
+
+func TestParseImageVersion(t *testing.T) {
+	tests := []struct {
+		image  string
+		want   minorVersion
+		wantOk bool
+	}{
+		{image: "docker.io/istio/proxyv2:1.17.2", want: minorVersion{Major: 1, Minor: 17}, wantOk: true},
+		{image: "gcr.io/istio-release/pilot:1.20.0-distroless", want: minorVersion{Major: 1, Minor: 20}, wantOk: true},
+		{image: "localhost:5000/istio/proxyv2:v1.9.5", want: minorVersion{Major: 1, Minor: 9}, wantOk: true},
+		{image: "localhost:5000/istio/proxyv2", wantOk: false},
+		{image: "docker.io/istio/proxyv2@sha256:0123456789abcdef", wantOk: false},
+		{image: "docker.io/istio/proxyv2:latest", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, ok := parseImageVersion(tt.image)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("parseImageVersion() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+	if !(minorVersion{Major: 1, Minor: 20}).atLeast(minorVersion{Major: 1, Minor: 9}) {
+		t.Errorf("1.20 should be newer than 1.9")
+	}
+}
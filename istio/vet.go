@@ -2,6 +2,7 @@ package istio
 
 import (
 	"fmt"
+	"path"
 	"reflect"
 	"strings"
 	"sync"
@@ -41,11 +42,13 @@ func (m *metaInformerFactory) Istio() istioinformer.SharedInformerFactory {
 // RunVet runs istio-vet
 func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []string) {
 	defer close(ch)
+	report := newVetReport()
 	var wg sync.WaitGroup
 	for _, k8sconfig := range kubeconfigs {
 		wg.Add(1)
 		go func(k8sconfig string) {
 			defer wg.Done()
+			cluster := clusterName([]byte(k8sconfig))
 			mclient, err := mesherykube.New([]byte(k8sconfig))
 			if err != nil {
 				e := &meshes.EventsResponse{
@@ -59,6 +62,8 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 				e.ProbableCause = errors.GetCause(err)
 				e.SuggestedRemediation = errors.GetRemedy(err)
 				ch <- e
+				report.fail(cluster, "", err)
+				return
 			}
 			istioClient, err := istioclient.New(&mclient.RestConfig)
 			if err != nil {
@@ -73,6 +78,8 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 				e.ProbableCause = errors.GetCause(err)
 				e.SuggestedRemediation = errors.GetRemedy(err)
 				ch <- e
+				report.fail(cluster, "", err)
+				return
 			}
 
 			kubeInformerFactory := informers.NewSharedInformerFactory(mclient.KubeClient, 0)
@@ -90,7 +97,10 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 				vetter.Vetter(serviceassociation.NewVetter(informerFactory)),
 				vetter.Vetter(danglingroutedestinationhost.NewVetter(informerFactory)),
 				vetter.Vetter(conflictingvirtualservicehost.NewVetter(informerFactory)),
+				vetter.Vetter(newMTLSConflictVetter(informerFactory)),
+				vetter.Vetter(newAuthorizationSelectorVetter(informerFactory)),
 			}
+			vList = append(vList, newGatewayVetters(informerFactory, mclient.KubeClient.CoreV1())...)
 
 			stopCh := make(chan struct{})
 
@@ -110,6 +120,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 				e.ProbableCause = errors.GetCause(err)
 				e.SuggestedRemediation = errors.GetRemedy(err)
 				ch <- e
+				report.fail(cluster, "", fmt.Errorf("%s", e.Summary))
 				close(stopCh)
 				return
 			}
@@ -126,6 +137,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 					e.ProbableCause = errors.GetCause(err)
 					e.SuggestedRemediation = errors.GetRemedy(err)
 					ch <- e
+					report.fail(cluster, "", fmt.Errorf("failed to sync %s", inf))
 					return
 				}
 			}
@@ -146,6 +158,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 				e.ProbableCause = errors.GetCause(err)
 				e.SuggestedRemediation = errors.GetRemedy(err)
 				ch <- e
+				report.fail(cluster, "", fmt.Errorf("%s", e.Summary))
 				close(stopCh)
 				return
 			}
@@ -162,6 +175,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 					e.ProbableCause = errors.GetCause(err)
 					e.SuggestedRemediation = errors.GetRemedy(err)
 					ch <- e
+					report.fail(cluster, "", fmt.Errorf("failed to sync %s", inf))
 					return
 				}
 			}
@@ -175,6 +189,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 					e.Details = err.Error()
 					e.EventType = meshes.EventType_ERROR
 					ch <- e
+					report.fail(cluster, v.Info().GetId(), err)
 					continue
 				}
 				if len(nList) > 0 {
@@ -197,6 +212,7 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 							e.EventType = meshes.EventType_INFO
 						}
 						ch <- e
+						report.add(cluster, v.Info(), nList[i], r)
 					}
 				} else {
 					e := &meshes.EventsResponse{}
@@ -209,6 +225,24 @@ func (istio *Istio) RunVet(ch chan<- *meshes.EventsResponse, kubeconfigs []strin
 			}
 		}(k8sconfig)
 	}
+	wg.Wait()
+
+	e := &meshes.EventsResponse{
+		Component:     internalconfig.ServerConfig["type"],
+		ComponentName: internalconfig.ServerConfig["name"],
+		EventType:     meshes.EventType_INFO,
+	}
+	files, err := report.save(path.Join(internalconfig.RootPath(), vetReportDir))
+	if err != nil {
+		e.EventType = meshes.EventType_ERROR
+		e.Summary = fmt.Sprintf("Vet completed with %s, the report could not be saved", report.countSummary())
+		e.Details = ErrIstioVet(err).Error()
+		ch <- e
+		return
+	}
+	e.Summary = fmt.Sprintf("Vet completed with %s", report.countSummary())
+	e.Details = "Report saved to " + strings.Join(files, " and ")
+	ch <- e
 }
 
 // StreamWarn streams a warning message to the channel
@@ -0,0 +1,317 @@
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	vetReportDir = "vet"
+
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// vetLevels are the levels of the notes, most severe first
+var vetLevels = []string{
+	apiv1.NoteLevel_ERROR.String(),
+	apiv1.NoteLevel_WARNING.String(),
+	apiv1.NoteLevel_INFO.String(),
+}
+
+// sarifLevels map the levels of the notes to the SARIF result levels
+var sarifLevels = map[string]string{
+	apiv1.NoteLevel_ERROR.String():   "error",
+	apiv1.NoteLevel_WARNING.String(): "warning",
+	apiv1.NoteLevel_INFO.String():    "note",
+}
+
+// vetFinding is a note of a vetter on a cluster, with its attributes
+// substituted in the summary and the message
+type vetFinding struct {
+	Cluster       string            `json:"cluster"`
+	VetterID      string            `json:"vetterId"`
+	VetterVersion string            `json:"vetterVersion,omitempty"`
+	NoteID        string            `json:"noteId,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	Level         string            `json:"level"`
+	Summary       string            `json:"summary"`
+	Message       string            `json:"message"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+
+	// rule is the summary of the note before substitution, which describes
+	// every note of the type
+	rule string
+}
+
+// resources returns the resources the finding is about, from the name
+// attributes and the namespace of the note
+func (f vetFinding) resources() []string {
+	var resources []string
+	for _, key := range sortedStringKeys(f.Attributes) {
+		if !strings.HasSuffix(key, "_name") {
+			continue
+		}
+		resource := f.Attributes[key]
+		if ns := f.Attributes["namespace"]; ns != "" && !strings.Contains(resource, "/") {
+			resource = ns + "/" + resource
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// vetFailure is a vetter, or a cluster, which could not be vetted
+type vetFailure struct {
+	Cluster  string `json:"cluster"`
+	VetterID string `json:"vetterId,omitempty"`
+	Error    string `json:"error"`
+}
+
+// vetReport gathers the findings of a vet operation across the clusters
+type vetReport struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Counts      map[string]int `json:"counts"`
+	Findings    []vetFinding   `json:"findings"`
+	Failures    []vetFailure   `json:"failures,omitempty"`
+
+	mx sync.Mutex
+}
+
+func newVetReport() *vetReport {
+	counts := map[string]int{}
+	for _, level := range vetLevels {
+		counts[level] = 0
+	}
+	return &vetReport{
+		GeneratedAt: time.Now().UTC(),
+		Counts:      counts,
+		Findings:    []vetFinding{},
+	}
+}
+
+// add records the note of the vetter, substituting its attributes with the
+// replacer
+func (r *vetReport) add(cluster string, info *apiv1.Info, note *apiv1.Note, replacer *strings.Replacer) {
+	finding := vetFinding{
+		Cluster:       cluster,
+		VetterID:      info.GetId(),
+		VetterVersion: info.GetVersion(),
+		NoteID:        note.GetId(),
+		Type:          note.GetType(),
+		Level:         note.GetLevel().String(),
+		Summary:       replacer.Replace(note.GetSummary()),
+		Message:       replacer.Replace(note.GetMsg()),
+		Attributes:    note.GetAttr(),
+		rule:          note.GetSummary(),
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Findings = append(r.Findings, finding)
+	r.Counts[finding.Level]++
+}
+
+// fail records the error of the vetter, or of the cluster when the vetter
+// ID is empty
+func (r *vetReport) fail(cluster, vetterID string, err error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Failures = append(r.Failures, vetFailure{Cluster: cluster, VetterID: vetterID, Error: err.Error()})
+}
+
+// sort orders the findings by cluster, severity and vetter, so that the
+// reports of the same configuration can be diffed
+func (r *vetReport) sort() {
+	severity := map[string]int{}
+	for i, level := range vetLevels {
+		severity[level] = i
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		switch {
+		case a.Cluster != b.Cluster:
+			return a.Cluster < b.Cluster
+		case a.Level != b.Level:
+			return severity[a.Level] < severity[b.Level]
+		case a.VetterID != b.VetterID:
+			return a.VetterID < b.VetterID
+		}
+		return a.Summary < b.Summary
+	})
+	sort.SliceStable(r.Failures, func(i, j int) bool {
+		return r.Failures[i].Cluster+r.Failures[i].VetterID < r.Failures[j].Cluster+r.Failures[j].VetterID
+	})
+}
+
+// countSummary returns the number of findings of each level
+func (r *vetReport) countSummary() string {
+	counts := make([]string, 0, len(vetLevels))
+	for _, level := range vetLevels {
+		counts = append(counts, fmt.Sprintf("%s: %d", strings.ToLower(level), r.Counts[level]))
+	}
+	summary := strings.Join(counts, ", ")
+	if len(r.Failures) > 0 {
+		summary += fmt.Sprintf(", failures: %d", len(r.Failures))
+	}
+	return summary
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Results     []sarifResult     `json:"results"`
+	Invocations []sarifInvocation `json:"invocations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+// sarif returns the report in the SARIF format, with a rule for each type
+// of note of each vetter
+func (r *vetReport) sarif() sarifLog {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "meshery-istio vet", Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	rules := map[string]int{}
+	for _, finding := range r.Findings {
+		ruleID := finding.VetterID
+		if finding.Type != "" {
+			ruleID += "/" + finding.Type
+		}
+		index, ok := rules[ruleID]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			rules[ruleID] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: ruleID, ShortDescription: sarifMessage{Text: finding.rule}})
+		}
+		result := sarifResult{
+			RuleID:    ruleID,
+			RuleIndex: index,
+			Level:     sarifLevels[finding.Level],
+			Message:   sarifMessage{Text: finding.Message},
+			Properties: map[string]interface{}{
+				"cluster":    finding.Cluster,
+				"attributes": finding.Attributes,
+			},
+		}
+		for _, resource := range finding.resources() {
+			result.Locations = append(result.Locations, sarifLocation{LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: resource, Kind: "resource"}}})
+		}
+		run.Results = append(run.Results, result)
+	}
+	invocation := sarifInvocation{ExecutionSuccessful: len(r.Failures) == 0}
+	for _, failure := range r.Failures {
+		msg := fmt.Sprintf("%s: %s", failure.Cluster, failure.Error)
+		if failure.VetterID != "" {
+			msg = fmt.Sprintf("%s: vetter %s: %s", failure.Cluster, failure.VetterID, failure.Error)
+		}
+		invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{Level: "error", Message: sarifMessage{Text: msg}})
+	}
+	run.Invocations = []sarifInvocation{invocation}
+	return sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}
+}
+
+// save writes the report in the JSON and SARIF formats to the directory,
+// and returns the paths of the files
+func (r *vetReport) save(dir string) ([]string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.sort()
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	name := "vet_" + r.GeneratedAt.Format("20060102T150405Z")
+	var files []string
+	for ext, report := range map[string]interface{}{".json": r, ".sarif": r.sarif()} {
+		byt, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return files, err
+		}
+		file := path.Join(dir, name+ext)
+		if err := os.WriteFile(file, byt, 0600); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// clusterName returns the current context of the kubeconfig, or the address
+// of its API server when it has none
+func clusterName(kubeconfig []byte) string {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return "unknown"
+	}
+	if config.CurrentContext != "" {
+		return config.CurrentContext
+	}
+	names := make([]string, 0, len(config.Clusters))
+	for name := range config.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return config.Clusters[names[0]].Server
+}
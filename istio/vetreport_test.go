@@ -0,0 +1,158 @@
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+)
+
+func testVetReport() *vetReport {
+	report := newVetReport()
+	info := &apiv1.Info{Id: gatewaySelectorVetterID, Version: nativeVetterVersion}
+	for _, name := range []string{"bookinfo-gateway", "httpbin-gateway"} {
+		note := &apiv1.Note{
+			Type:    unmatchedGatewayNoteType,
+			Summary: unmatchedGatewaySummary,
+			Msg:     unmatchedGatewayMsg,
+			Level:   apiv1.NoteLevel_ERROR,
+			Attr:    map[string]string{"gateway_name": name, "namespace": "default", "selector": "istio=ingressgateway"},
+		}
+		report.add("kind-meshery", info, note, strings.NewReplacer("${gateway_name}", name, "${namespace}", "default", "${selector}", "istio=ingressgateway"))
+	}
+	report.add("kind-meshery", &apiv1.Info{Id: "MeshVersion"}, &apiv1.Note{
+		Summary: "Mesh version",
+		Msg:     "Istio 1.20.0",
+		Level:   apiv1.NoteLevel_INFO,
+	}, strings.NewReplacer())
+	report.fail("kind-meshery", mtlsConflictVetterID, fmt.Errorf("the server could not find the requested resource"))
+	return report
+}
+
+func TestVetReport_countSummary(t *testing.T) {
+	want := "error: 2, warning: 0, info: 1, failures: 1"
+	if got := testVetReport().countSummary(); got != want {
+		t.Errorf("vetReport.countSummary() = %s, want %s", got, want)
+	}
+}
+
+func TestVetReport_sarif(t *testing.T) {
+	report := testVetReport()
+	report.sort()
+	run := report.sarif().Runs[0]
+
+	var rules []string
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+	wantRules := []string{gatewaySelectorVetterID + "/" + unmatchedGatewayNoteType, "MeshVersion"}
+	if !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("vetReport.sarif() rules = %v, want %v", rules, wantRules)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("vetReport.sarif() has %d results, want 3", len(run.Results))
+	}
+	first := run.Results[0]
+	if first.Level != "error" || first.RuleIndex != 0 || !strings.Contains(first.Message.Text, "bookinfo-gateway") {
+		t.Errorf("vetReport.sarif() first result = %+v", first)
+	}
+	if len(first.Locations) != 1 || first.Locations[0].LogicalLocations[0].FullyQualifiedName != "default/bookinfo-gateway" {
+		t.Errorf("vetReport.sarif() first result locations = %+v, want default/bookinfo-gateway", first.Locations)
+	}
+	if run.Results[2].Level != "note" {
+		t.Errorf("vetReport.sarif() last result level = %s, want note", run.Results[2].Level)
+	}
+	if invocation := run.Invocations[0]; invocation.ExecutionSuccessful || len(invocation.ToolExecutionNotifications) != 1 {
+		t.Errorf("vetReport.sarif() invocation = %+v, want one failure", invocation)
+	}
+}
+
+func TestVetReport_save(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), vetReportDir)
+	files, err := testVetReport().save(dir)
+	if err != nil {
+		t.Fatalf("vetReport.save() error = %v", err)
+	}
+	if len(files) != 2 || filepath.Ext(files[0]) != ".json" || filepath.Ext(files[1]) != ".sarif" {
+		t.Fatalf("vetReport.save() = %v, want a .json and a .sarif file", files)
+	}
+
+	byt, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved struct {
+		Counts   map[string]int `json:"counts"`
+		Findings []vetFinding   `json:"findings"`
+		Failures []vetFailure   `json:"failures"`
+	}
+	if err := json.Unmarshal(byt, &saved); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if want := map[string]int{"ERROR": 2, "WARNING": 0, "INFO": 1}; !reflect.DeepEqual(saved.Counts, want) {
+		t.Errorf("saved counts = %v, want %v", saved.Counts, want)
+	}
+	if len(saved.Findings) != 3 || saved.Findings[0].Cluster != "kind-meshery" || saved.Findings[0].Attributes["gateway_name"] != "bookinfo-gateway" {
+		t.Errorf("saved findings = %+v", saved.Findings)
+	}
+	if len(saved.Failures) != 1 || saved.Failures[0].VetterID != mtlsConflictVetterID {
+		t.Errorf("saved failures = %+v", saved.Failures)
+	}
+
+	byt, err = os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sarif sarifLog
+	if err := json.Unmarshal(byt, &sarif); err != nil || sarif.Version != sarifVersion {
+		t.Errorf("invalid SARIF report: version %s, error %v", sarif.Version, err)
+	}
+}
+
+func TestClusterName(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeconfig string
+		want       string
+	}{
+		{
+			name: "current context",
+			kubeconfig: `apiVersion: v1
+kind: Config
+current-context: kind-meshery
+contexts:
+- name: kind-meshery
+  context: {cluster: kind-meshery}
+clusters:
+- name: kind-meshery
+  cluster: {server: "https://127.0.0.1:6443"}`,
+			want: "kind-meshery",
+		},
+		{
+			name: "no current context",
+			kubeconfig: `apiVersion: v1
+kind: Config
+clusters:
+- name: kind-meshery
+  cluster: {server: "https://127.0.0.1:6443"}`,
+			want: "https://127.0.0.1:6443",
+		},
+		{
+			name:       "invalid kubeconfig",
+			kubeconfig: "{",
+			want:       "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clusterName([]byte(tt.kubeconfig)); got != tt.want {
+				t.Errorf("clusterName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package istio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	extensionsAPIVersion = "extensions.istio.io/v1alpha1"
+
+	// Annotations of the pod template read by the sidecar injector to
+	// mount extra volumes into the proxy
+	userVolumeAnnotation      = "sidecar.istio.io/userVolume"
+	userVolumeMountAnnotation = "sidecar.istio.io/userVolumeMount"
+
+	// wasmModuleDir is where ConfigMap modules are mounted in the proxy
+	wasmModuleDir = "/var/local/lib/wasm"
+)
+
+// minWasmPluginVersion is the first Istio release serving the WasmPlugin API
+var minWasmPluginVersion = minorVersion{Major: 1, Minor: 12}
+
+// wasmConfigMapModule is a Wasm module stored in a ConfigMap of the
+// namespace, under the key
+type wasmConfigMapModule struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// wasmPlugin are the parameters of the WasmPlugin operation
+type wasmPlugin struct {
+	Name string `yaml:"name"`
+	// URL of the module, either an OCI image (oci://) or a file served
+	// over HTTP(S). Mutually exclusive with ConfigMap.
+	URL             string               `yaml:"url,omitempty"`
+	ConfigMap       *wasmConfigMapModule `yaml:"configMap,omitempty"`
+	SHA256          string               `yaml:"sha256,omitempty"`
+	ImagePullPolicy string               `yaml:"imagePullPolicy,omitempty"`
+	ImagePullSecret string               `yaml:"imagePullSecret,omitempty"`
+	// Selector of the workloads, every workload of the namespace when empty
+	Selector     map[string]string      `yaml:"selector,omitempty"`
+	Phase        string                 `yaml:"phase,omitempty"`
+	Priority     *int                   `yaml:"priority,omitempty"`
+	PluginName   string                 `yaml:"pluginName,omitempty"`
+	PluginConfig map[string]interface{} `yaml:"pluginConfig,omitempty"`
+}
+
+func (w wasmPlugin) validate() error {
+	if errs := validation.IsDNS1123Label(w.Name); len(errs) > 0 {
+		return ErrWasmPlugin(fmt.Errorf("invalid name %q: %s", w.Name, strings.Join(errs, ", ")))
+	}
+	switch {
+	case w.URL == "" && w.ConfigMap == nil:
+		return ErrWasmPlugin(fmt.Errorf("either the url or the configMap of the module is required"))
+	case w.URL != "" && w.ConfigMap != nil:
+		return ErrWasmPlugin(fmt.Errorf("url and configMap are mutually exclusive"))
+	case w.ConfigMap != nil:
+		if w.ConfigMap.Name == "" || w.ConfigMap.Key == "" {
+			return ErrWasmPlugin(fmt.Errorf("the name and key of the module ConfigMap are required"))
+		}
+		if len(w.Selector) == 0 {
+			return ErrWasmPlugin(fmt.Errorf("a selector is required to mount the module ConfigMap into the workloads"))
+		}
+	case !strings.HasPrefix(w.URL, "oci://") && !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://"):
+		return ErrWasmPlugin(fmt.Errorf("unsupported module url %s, use oci://, http:// or https://", w.URL))
+	}
+	switch w.Phase {
+	case "", "UNSPECIFIED_PHASE", "AUTHN", "AUTHZ", "STATS":
+	default:
+		return ErrWasmPlugin(fmt.Errorf("invalid phase %s, use AUTHN, AUTHZ or STATS", w.Phase))
+	}
+	switch w.ImagePullPolicy {
+	case "", "IfNotPresent", "Always":
+	default:
+		return ErrWasmPlugin(fmt.Errorf("invalid image pull policy %s", w.ImagePullPolicy))
+	}
+	return nil
+}
+
+// volumeName is the name of the volume holding the ConfigMap module
+func (w wasmPlugin) volumeName() string {
+	return fmt.Sprintf("wasm-%s", w.Name)
+}
+
+// moduleURL returns the URL the proxies fetch the module from
+func (w wasmPlugin) moduleURL() string {
+	if w.ConfigMap != nil {
+		return fmt.Sprintf("file://%s/%s/%s", wasmModuleDir, w.Name, w.ConfigMap.Key)
+	}
+	return w.URL
+}
+
+func (w wasmPlugin) manifest(namespace string) (string, error) {
+	spec := map[string]interface{}{
+		"url": w.moduleURL(),
+	}
+	if len(w.Selector) > 0 {
+		spec["selector"] = map[string]interface{}{"matchLabels": w.Selector}
+	}
+	optional := map[string]string{
+		"sha256":          w.SHA256,
+		"imagePullPolicy": w.ImagePullPolicy,
+		"imagePullSecret": w.ImagePullSecret,
+		"phase":           w.Phase,
+		"pluginName":      w.PluginName,
+	}
+	for k, v := range optional {
+		if v != "" {
+			spec[k] = v
+		}
+	}
+	if w.Priority != nil {
+		spec["priority"] = *w.Priority
+	}
+	if len(w.PluginConfig) > 0 {
+		spec["pluginConfig"] = w.PluginConfig
+	}
+
+	byt, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": extensionsAPIVersion,
+		"kind":       "WasmPlugin",
+		"metadata": map[string]interface{}{
+			"name":      w.Name,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return "", ErrWasmPlugin(err)
+	}
+	return string(byt), nil
+}
+
+// configureWasmPlugin creates/deletes the WasmPlugin in the namespace
+//
+// The proxies targeted by the plugin are checked to support the WasmPlugin
+// API first. Modules stored in a ConfigMap are mounted into the proxies of
+// the selected Deployments, which restarts their pods.
+func (istio *Istio) configureWasmPlugin(namespace string, del bool, plugin wasmPlugin, kubeconfigs []string) (string, []string, error) {
+	st := status.Deploying
+
+	if del {
+		st = status.Removing
+	}
+
+	if del {
+		if plugin.Name == "" {
+			return st, nil, ErrWasmPlugin(fmt.Errorf("name is required"))
+		}
+	} else if err := plugin.validate(); err != nil {
+		return st, nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	var errs []error
+	var msgs []string
+	for _, k8sconfig := range kubeconfigs {
+		wg.Add(1)
+		go func(k8sconfig string) {
+			defer wg.Done()
+			mclient, err := mesherykube.New([]byte(k8sconfig))
+			if err != nil {
+				mx.Lock()
+				errs = append(errs, err)
+				mx.Unlock()
+				return
+			}
+			clusterMsgs, err := istio.configureWasmPluginOnSingleCluster(namespace, del, plugin, mclient)
+			mx.Lock()
+			defer mx.Unlock()
+			msgs = append(msgs, clusterMsgs...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(k8sconfig)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		if del {
+			return status.Removed, msgs, nil
+		}
+		return status.Deployed, msgs, nil
+	}
+	return st, msgs, ErrWasmPlugin(mergeErrors(errs))
+}
+
+func (istio *Istio) configureWasmPluginOnSingleCluster(namespace string, del bool, plugin wasmPlugin, mclient *mesherykube.Client) ([]string, error) {
+	var msgs []string
+	manifest, err := plugin.manifest(namespace)
+	if err != nil {
+		return msgs, err
+	}
+
+	if del {
+		if err := istio.applyManifestOnSingleCluster([]byte(manifest), true, namespace, mclient); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, fmt.Sprintf("WasmPlugin %s/%s deleted", namespace, plugin.Name))
+		if plugin.ConfigMap != nil {
+			unmounted, err := mountWasmModule(mclient, namespace, plugin, true)
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, unmounted...)
+		}
+		return msgs, nil
+	}
+
+	msg, err := checkWasmPluginSupport(mclient, namespace, plugin.Selector)
+	if err != nil {
+		return msgs, err
+	}
+	msgs = append(msgs, msg)
+
+	if plugin.ConfigMap != nil {
+		if _, err := mclient.KubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), plugin.ConfigMap.Name, metav1.GetOptions{}); err != nil {
+			return msgs, err
+		}
+		mounted, err := mountWasmModule(mclient, namespace, plugin, false)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, mounted...)
+	}
+
+	if err := istio.applyManifestOnSingleCluster([]byte(manifest), false, namespace, mclient); err != nil {
+		return msgs, err
+	}
+	return append(msgs, fmt.Sprintf("WasmPlugin %s/%s loads %s", namespace, plugin.Name, plugin.moduleURL())), nil
+}
+
+// checkWasmPluginSupport verifies that the proxies of the pods matching the
+// selector in the namespace serve the WasmPlugin API
+func checkWasmPluginSupport(mclient *mesherykube.Client, namespace string, selector map[string]string) (string, error) {
+	pods, err := mclient.KubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return wasmPluginSupport(pods.Items)
+}
+
+// wasmPluginSupport returns the versions of the proxies of the pods, or an
+// error naming the pods whose proxy predates the WasmPlugin API
+func wasmPluginSupport(pods []corev1.Pod) (string, error) {
+	versions := map[string]int{}
+	var unsupported, unknown []string
+	for _, pod := range pods {
+		if !hasSidecar(pod) {
+			continue
+		}
+		version, ok := proxyVersion(pod)
+		if !ok {
+			unknown = append(unknown, pod.Name)
+			continue
+		}
+		if !version.atLeast(minWasmPluginVersion) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (%s)", pod.Name, version))
+			continue
+		}
+		versions[version.String()]++
+	}
+	if len(unsupported) > 0 {
+		return "", fmt.Errorf("WasmPlugin requires Istio %s or newer, the proxies of %s are older", minWasmPluginVersion, strings.Join(unsupported, ", "))
+	}
+	if len(versions) == 0 && len(unknown) == 0 {
+		return "no proxy matches the selector yet, the plugin applies to the workloads once they are in the mesh", nil
+	}
+
+	var found []string
+	for _, v := range sortedKeys(versions) {
+		found = append(found, fmt.Sprintf("%d on %s", versions[v], v))
+	}
+	msg := fmt.Sprintf("proxies supporting WasmPlugin: %s", strings.Join(found, ", "))
+	if len(unknown) > 0 {
+		msg = fmt.Sprintf("%s; version of %s unknown", msg, strings.Join(unknown, ", "))
+	}
+	return msg, nil
+}
+
+// mountWasmModule adds, or removes, the volume holding the ConfigMap module
+// to the proxies of the Deployments whose pods match the plugin selector
+func mountWasmModule(mclient *mesherykube.Client, namespace string, plugin wasmPlugin, del bool) ([]string, error) {
+	deployments, err := mclient.KubeClient.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	selector := labels.SelectorFromSet(plugin.Selector)
+	var msgs []string
+	for i := range deployments.Items {
+		deploy := &deployments.Items[i]
+		if !selector.Matches(labels.Set(deploy.Spec.Template.Labels)) {
+			continue
+		}
+		changed, err := setWasmModuleVolume(deploy, plugin, del)
+		if err != nil {
+			return msgs, err
+		}
+		if !changed {
+			continue
+		}
+		if _, err := mclient.KubeClient.AppsV1().Deployments(namespace).Update(context.TODO(), deploy, metav1.UpdateOptions{}); err != nil {
+			return msgs, err
+		}
+		if del {
+			msgs = append(msgs, fmt.Sprintf("module unmounted from Deployment %s/%s", namespace, deploy.Name))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("module mounted into Deployment %s/%s, its pods are restarted", namespace, deploy.Name))
+		}
+	}
+	return msgs, nil
+}
+
+// setWasmModuleVolume adds, or removes, the module volume to the sidecar
+// volume annotations of the pod template, keeping the volumes added by others
+func setWasmModuleVolume(deploy *appsv1.Deployment, plugin wasmPlugin, del bool) (bool, error) {
+	annotations := deploy.Spec.Template.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	volumes := map[string]interface{}{}
+	mounts := map[string]interface{}{}
+	for key, into := range map[string]*map[string]interface{}{userVolumeAnnotation: &volumes, userVolumeMountAnnotation: &mounts} {
+		if value := annotations[key]; value != "" {
+			if err := json.Unmarshal([]byte(value), into); err != nil {
+				return false, fmt.Errorf("invalid %s annotation on Deployment %s: %w", key, deploy.Name, err)
+			}
+		}
+	}
+
+	name := plugin.volumeName()
+	_, mounted := volumes[name]
+	if mounted != del {
+		return false, nil
+	}
+	if del {
+		delete(volumes, name)
+		delete(mounts, name)
+	} else {
+		volumes[name] = map[string]interface{}{"configMap": map[string]interface{}{"name": plugin.ConfigMap.Name}}
+		mounts[name] = map[string]interface{}{"mountPath": fmt.Sprintf("%s/%s", wasmModuleDir, plugin.Name), "readOnly": true}
+	}
+
+	for key, from := range map[string]map[string]interface{}{userVolumeAnnotation: volumes, userVolumeMountAnnotation: mounts} {
+		if len(from) == 0 {
+			delete(annotations, key)
+			continue
+		}
+		byt, err := json.Marshal(from)
+		if err != nil {
+			return false, err
+		}
+		annotations[key] = string(byt)
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	deploy.Spec.Template.Annotations = annotations
+	return true, nil
+}
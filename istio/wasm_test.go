@@ -0,0 +1,155 @@
+package istio
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestWasmPlugin_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{name: "oci module", params: "{name: basic-auth, url: 'oci://ghcr.io/istio-ecosystem/wasm-extensions/basic_auth:1.12.0', phase: AUTHN}", wantErr: false},
+		{name: "http module", params: "{name: rate-limit, url: 'https://example.com/filter.wasm', priority: 10}", wantErr: false},
+		{name: "configmap module", params: "{name: rate-limit, configMap: {name: filters, key: filter.wasm}, selector: {app: api}}", wantErr: false},
+		{name: "no module", params: "{name: rate-limit}", wantErr: true},
+		{name: "both modules", params: "{name: rate-limit, url: 'oci://x', configMap: {name: filters, key: filter.wasm}, selector: {app: api}}", wantErr: true},
+		{name: "configmap without selector", params: "{name: rate-limit, configMap: {name: filters, key: filter.wasm}}", wantErr: true},
+		{name: "unsupported scheme", params: "{name: rate-limit, url: 'ftp://example.com/filter.wasm'}", wantErr: true},
+		{name: "invalid phase", params: "{name: rate-limit, url: 'oci://x', phase: ROUTER}", wantErr: true},
+		{name: "invalid name", params: "{name: Rate_Limit, url: 'oci://x'}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := wasmPlugin{}
+			if err := parseOperationParams(tt.params, &plugin); err != nil {
+				t.Fatalf("parseOperationParams() error = %v", err)
+			}
+			if err := plugin.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wasmPlugin.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWasmPlugin_manifest(t *testing.T) {
+	plugin := wasmPlugin{}
+	params := "{name: rate-limit, configMap: {name: filters, key: filter.wasm}, selector: {app: api}, phase: AUTHZ, priority: 10, pluginConfig: {limits: [{path: /pull, rps: 2}]}}"
+	if err := parseOperationParams(params, &plugin); err != nil {
+		t.Fatalf("parseOperationParams() error = %v", err)
+	}
+	manifest, err := plugin.manifest("imagehub")
+	if err != nil {
+		t.Fatalf("wasmPlugin.manifest() error = %v", err)
+	}
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	spec := obj["spec"].(map[string]interface{})
+	if spec["url"] != "file:///var/local/lib/wasm/rate-limit/filter.wasm" {
+		t.Errorf("url = %v", spec["url"])
+	}
+	if spec["phase"] != "AUTHZ" || spec["priority"] != float64(10) {
+		t.Errorf("phase, priority = %v, %v", spec["phase"], spec["priority"])
+	}
+	if _, ok := spec["pluginConfig"].(map[string]interface{})["limits"]; !ok {
+		t.Errorf("pluginConfig = %v", spec["pluginConfig"])
+	}
+	if obj["apiVersion"] != "extensions.istio.io/v1alpha1" || obj["kind"] != "WasmPlugin" {
+		t.Errorf("manifest = %v", obj)
+	}
+}
+
+func TestSetWasmModuleVolume(t *testing.T) {
+	plugin := wasmPlugin{Name: "rate-limit", ConfigMap: &wasmConfigMapModule{Name: "filters", Key: "filter.wasm"}}
+	original := map[string]string{
+		userVolumeAnnotation:      `{"certs":{"secret":{"secretName":"certs"}}}`,
+		userVolumeMountAnnotation: `{"certs":{"mountPath":"/etc/certs"}}`,
+	}
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api-v1"}}
+	deploy.Spec.Template.Annotations = map[string]string{}
+	for k, v := range original {
+		deploy.Spec.Template.Annotations[k] = v
+	}
+
+	changed, err := setWasmModuleVolume(deploy, plugin, false)
+	if err != nil || !changed {
+		t.Fatalf("setWasmModuleVolume() = %v, %v, want true, nil", changed, err)
+	}
+	for _, key := range []string{userVolumeAnnotation, userVolumeMountAnnotation} {
+		value := deploy.Spec.Template.Annotations[key]
+		if !strings.Contains(value, `"certs"`) || !strings.Contains(value, `"wasm-rate-limit"`) {
+			t.Errorf("%s = %s, want both volumes", key, value)
+		}
+	}
+	if changed, _ := setWasmModuleVolume(deploy, plugin, false); changed {
+		t.Errorf("setWasmModuleVolume() mounted the module twice")
+	}
+
+	if changed, err := setWasmModuleVolume(deploy, plugin, true); err != nil || !changed {
+		t.Fatalf("setWasmModuleVolume(del) = %v, %v, want true, nil", changed, err)
+	}
+	for k, v := range original {
+		if deploy.Spec.Template.Annotations[k] != v {
+			t.Errorf("%s = %s, want %s", k, deploy.Spec.Template.Annotations[k], v)
+		}
+	}
+
+	bare := &appsv1.Deployment{}
+	if _, err := setWasmModuleVolume(bare, plugin, false); err != nil {
+		t.Fatalf("setWasmModuleVolume() error = %v", err)
+	}
+	if _, err := setWasmModuleVolume(bare, plugin, true); err != nil || bare.Spec.Template.Annotations != nil {
+		t.Errorf("setWasmModuleVolume(del) left annotations %v, %v", bare.Spec.Template.Annotations, err)
+	}
+}
+
+func TestWasmPluginSupport(t *testing.T) {
+	pod := func(name, image string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app:2.0"}, {Name: sidecarContainerName, Image: image}}},
+		}
+	}
+	tests := []struct {
+		name    string
+		pods    []corev1.Pod
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "supported proxies",
+			pods: []corev1.Pod{pod("api-1", "docker.io/istio/proxyv2:1.17.2"), pod("api-2", "gcr.io/istio-release/proxyv2:1.20.0-distroless"), pod("api-3", "proxyv2@sha256:abcd")},
+			want: "proxies supporting WasmPlugin: 1 on 1.17, 1 on 1.20; version of api-3 unknown",
+		},
+		{
+			name:    "outdated proxy",
+			pods:    []corev1.Pod{pod("api-1", "docker.io/istio/proxyv2:1.9.5"), pod("api-2", "docker.io/istio/proxyv2:1.17.2")},
+			wantErr: true,
+		},
+		{
+			name: "no proxy",
+			pods: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "api-1"}}},
+			want: "no proxy matches the selector yet, the plugin applies to the workloads once they are in the mesh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wasmPluginSupport(tt.pods)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wasmPluginSupport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("wasmPluginSupport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}